@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gorilla/handlers"
+)
+
+// Access log formats.
+const (
+	// accessLogCommon is the Apache Common Log Format.
+	accessLogCommon = "common"
+	// accessLogCombined is the Apache Combined Log Format, the Common one
+	// with the referer and user agent.
+	accessLogCombined = "combined"
+)
+
+// accessLogSecretParams are the query parameters carrying secrets, eg. the id
+// token of /auth or the token of share links, which are masked in access logs.
+var accessLogSecretParams = []string{"token", "code"}
+
+// originalRequestKey is the context key of the request, before its URI was
+// redacted for the access log.
+type originalRequestKey struct{}
+
+// logAccess wraps the handler to write an access log line for each request,
+// in the access log format, if one is configured.
+func (c *HeadlampConfig) logAccess(next http.Handler) http.Handler {
+	if c.accessLogFormat != accessLogCommon && c.accessLogFormat != accessLogCombined {
+		return next
+	}
+
+	if c.accessLog == nil {
+		out, err := openAccessLog(c.accessLogFile)
+		if err != nil {
+			log.Printf("Error opening access log %s, access logs are disabled: %v", c.accessLogFile, err)
+			return next
+		}
+
+		c.accessLog = out
+	}
+
+	// The logging handlers log the request they get, so they get the redacted
+	// one, and pass the original one on.
+	next = restoreOriginalRequest(next)
+
+	if c.accessLogFormat == accessLogCombined {
+		return redactRequestURI(handlers.CombinedLoggingHandler(c.accessLog, next))
+	}
+
+	return redactRequestURI(handlers.LoggingHandler(c.accessLog, next))
+}
+
+// redactRequestURI passes on a copy of the request, with the secrets of its
+// query masked, and the original request in its context.
+func redactRequestURI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redacted := r.WithContext(context.WithValue(r.Context(), originalRequestKey{}, r))
+
+		u := *r.URL
+		u.RawQuery = redactQuery(u.RawQuery)
+		redacted.URL = &u
+
+		if r.RequestURI != "" {
+			redacted.RequestURI = u.RequestURI()
+		}
+
+		next.ServeHTTP(w, redacted)
+	})
+}
+
+// restoreOriginalRequest passes on the request redactRequestURI redacted.
+func restoreOriginalRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if original, ok := r.Context().Value(originalRequestKey{}).(*http.Request); ok {
+			r = original
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redactQuery replaces the values of the secret parameters of a raw query
+// with "*", eg. token=abc&cluster=x becomes token=*&cluster=x.
+func redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return rawQuery
+	}
+
+	params := strings.Split(rawQuery, "&")
+
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if name, err := url.QueryUnescape(key); err == nil && containsFold(accessLogSecretParams, name) {
+			params[i] = key + "=*"
+		}
+	}
+
+	return strings.Join(params, "&")
+}
+
+// containsFold returns whether the list has the string, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// openAccessLog opens the file access logs are appended to, or returns stdout
+// if there is none.
+func openAccessLog(path string) (io.Writer, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, nil
+	}
+
+	return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+}
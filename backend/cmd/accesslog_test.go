@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+		accessLogFormat: "combined",
+		accessLog:       &logs,
+	}
+
+	handler := createHeadlampHandler(&c)
+
+	req := httptest.NewRequest(http.MethodGet, "/config?x=1", nil)
+	req.Header.Set("Referer", "https://headlamp.example.com/")
+	req.Header.Set("User-Agent", "test-agent")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Regexp(t,
+		`^192\.0\.2\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /config\?x=1 HTTP/1\.1" 200 `+
+			strconv.Itoa(rr.Body.Len())+` "https://headlamp\.example\.com/" "test-agent"\n$`,
+		logs.String())
+
+	// Common Log Format lines are appended to the access log file.
+	file := filepath.Join(t.TempDir(), "access.log")
+
+	c = HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+		accessLogFormat: "common",
+		accessLogFile:   file,
+	}
+
+	handler = createHeadlampHandler(&c)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/no-such-endpoint", nil))
+
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Regexp(t, `^192\.0\.2\.1 - - \[[^]]+\] "GET /no-such-endpoint HTTP/1\.1" 404 \d+\n$`, string(content))
+
+	// Tokens in the query are masked, but handlers get them.
+	logs.Reset()
+
+	c = HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+		accessLogFormat: "common",
+		accessLog:       &logs,
+		shareSecret:     []byte("test-secret"),
+	}
+
+	handler = createHeadlampHandler(&c)
+
+	token, err := signShareToken(c.shareSecret, shareClaims{Cluster: "a", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/share?token="+token+"&x=1", nil))
+	assert.Equal(t, http.StatusFound, rr.Code)
+
+	assert.Contains(t, logs.String(), `"GET /share?token=*&x=1 HTTP/1.1" 302 `)
+	assert.NotContains(t, logs.String(), token)
+}
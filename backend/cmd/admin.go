@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/singleflight"
+)
+
+// addAdminRoutes adds the health, metrics, read-only toggle, debug, log and
+// routing table endpoints to a router. The profiling endpoints are only added
+// to the admin listener.
+func (c *HeadlampConfig) addAdminRoutes(r *mux.Router, adminListener bool) {
+	// Anyone reaching Headlamp reaches the main listener, so changes and debug
+	// information require the backend token there.
+	adminOnly := requireBackendToken
+	if adminListener {
+		adminOnly = func(next http.HandlerFunc) http.HandlerFunc { return next }
+	}
+
+	r.HandleFunc("/healthz", c.handleHealthz).Methods("GET")
+	r.HandleFunc("/healthz/clusters", adminOnly(c.handleClustersHealthz)).Methods("GET")
+	r.HandleFunc("/metrics", c.requireMetricsAuth(c.handleMetrics)).Methods("GET")
+	r.HandleFunc("/read-only", c.handleReadOnly).Methods("GET")
+	r.HandleFunc("/read-only", adminOnly(c.handleReadOnly)).Methods("PUT")
+
+	r.HandleFunc("/debug/logs", adminOnly(c.handleDebugLogs)).Methods("GET")
+	r.HandleFunc("/debug/routes", adminOnly(c.handleDebugRoutes)).Methods("GET")
+
+	c.addSessionRoutes(r)
+
+	// The profiles expose the command line, with its secrets, and profiling
+	// burns CPU, so they are only served on the admin listener.
+	if !adminListener {
+		return
+	}
+
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+}
+
+// createAdminHandler returns the handler for the admin listener.
+func createAdminHandler(config *HeadlampConfig) http.Handler {
+	r := mux.NewRouter()
+
+	if config.sessions == nil {
+		config.sessions = newSessionStore()
+	}
+
+	if config.inflightRequests == nil {
+		config.inflightRequests = &singleflight.Group{}
+	}
+
+	config.addAdminRoutes(r, true)
+
+	return r
+}
+
+func (c *HeadlampConfig) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+
+	if _, err := w.Write([]byte("ok")); err != nil {
+		log.Println("Error writing health response", err)
+	}
+}
+
+// requireMetricsAuth protects a metrics handler with the configured bearer
+// token or basic auth credentials, independently of the API auth. Either one
+// is accepted if both are configured. Without any, metrics are public.
+func (c *HeadlampConfig) requireMetricsAuth(next http.HandlerFunc) http.HandlerFunc {
+	if c.metricsToken == "" && c.metricsUsername == "" {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.metricsToken != "" {
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if found && secretEqual(token, c.metricsToken) {
+				next(w, r)
+				return
+			}
+		}
+
+		if c.metricsUsername != "" {
+			username, password, ok := r.BasicAuth()
+			if ok && secretEqual(username, c.metricsUsername) && secretEqual(password, c.metricsPassword) {
+				next(w, r)
+				return
+			}
+
+			w.Header().Set("WWW-Authenticate", `Basic realm="headlamp-metrics"`)
+		}
+
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}
+}
+
+// secretEqual compares secrets in constant time.
+func secretEqual(given, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// handleMetrics serves metrics in the Prometheus text exposition format.
+func (c *HeadlampConfig) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	metrics := []struct {
+		name  string
+		help  string
+		value int
+	}{
+		{"headlamp_clusters", "Number of clusters known to Headlamp.", len(c.getClusters())},
+		{"go_goroutines", "Number of goroutines that currently exist.", runtime.NumGoroutine()},
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n",
+			m.name, m.help, m.name, m.name, m.value); err != nil {
+			log.Println("Error writing metrics", err)
+			return
+		}
+	}
+}
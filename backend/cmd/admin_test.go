@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminEndpoints(t *testing.T) {
+	t.Run("separate_admin_listener", func(t *testing.T) {
+		c := HeadlampConfig{
+			cache:           cache.New[interface{}](),
+			kubeConfigStore: kubeconfig.NewContextStore(),
+			adminAddr:       "localhost:0",
+		}
+
+		mainServer := httptest.NewServer(createHeadlampHandler(&c))
+		defer mainServer.Close()
+
+		adminServer := httptest.NewServer(createAdminHandler(&c))
+		defer adminServer.Close()
+
+		for _, path := range []string{"/metrics", "/healthz"} {
+			resp, err := http.Get(adminServer.URL + path) //nolint:noctx
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			resp, err = http.Get(mainServer.URL + path) //nolint:noctx
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		}
+
+		resp, err := http.Get(adminServer.URL + "/debug/pprof/cmdline") //nolint:noctx
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("no_profiles_on_main_listener", func(t *testing.T) {
+		c := HeadlampConfig{
+			cache:           cache.New[interface{}](),
+			kubeConfigStore: kubeconfig.NewContextStore(),
+		}
+		handler := createHeadlampHandler(&c)
+
+		for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/profile"} {
+			rr, err := getResponseFromRestrictedEndpoint(handler, "GET", path, nil)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusNotFound, rr.Code, path)
+			assert.NotContains(t, rr.Body.String(), os.Args[0], path)
+		}
+	})
+
+	t.Run("main_listener", func(t *testing.T) {
+		c := HeadlampConfig{
+			cache:           cache.New[interface{}](),
+			kubeConfigStore: kubeconfig.NewContextStore(),
+		}
+
+		rr, err := getResponse(createHeadlampHandler(&c), "GET", "/metrics", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "headlamp_clusters")
+	})
+
+	t.Run("metrics_auth", func(t *testing.T) {
+		c := HeadlampConfig{
+			cache:           cache.New[interface{}](),
+			kubeConfigStore: kubeconfig.NewContextStore(),
+			metricsUsername: "prometheus",
+			metricsPassword: "scrape",
+			metricsToken:    "metrics-token",
+		}
+		handler := createHeadlampHandler(&c)
+
+		tests := []struct {
+			name          string
+			authorize     func(req *http.Request)
+			expectedState int
+		}{
+			{"no_credentials", func(req *http.Request) {}, http.StatusUnauthorized},
+			{"basic_auth", func(req *http.Request) { req.SetBasicAuth("prometheus", "scrape") }, http.StatusOK},
+			{"wrong_password", func(req *http.Request) { req.SetBasicAuth("prometheus", "guess") }, http.StatusUnauthorized},
+			{"bearer_token", func(req *http.Request) {
+				req.Header.Set("Authorization", "Bearer metrics-token")
+			}, http.StatusOK},
+			{"wrong_token", func(req *http.Request) {
+				req.Header.Set("Authorization", "Bearer cluster-token")
+			}, http.StatusUnauthorized},
+		}
+
+		for _, tc := range tests {
+			req, err := http.NewRequestWithContext(context.Background(), "GET", "/metrics", nil)
+			require.NoError(t, err)
+
+			tc.authorize(req)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedState, rr.Code, tc.name)
+		}
+
+		// Only metrics are protected.
+		rr, err := getResponse(handler, "GET", "/healthz", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
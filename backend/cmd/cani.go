@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// maxAccessChecks is the maximum number of checks in a single can-i request.
+const maxAccessChecks = 100
+
+// accessReviewsPath is the API path of the SelfSubjectAccessReviews answering the checks.
+const accessReviewsPath = "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews"
+
+// accessCheck is a single "can I" question, like `kubectl auth can-i`.
+type accessCheck struct {
+	Verb        string `json:"verb"`
+	Group       string `json:"group"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name,omitempty"`
+}
+
+type accessCheckResult struct {
+	accessCheck
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// canI answers the checks with SelfSubjectAccessReviews, which are sent concurrently.
+// A failed review is reported in the result of its check.
+func canI(ctx context.Context, clientset kubernetes.Interface, checks []accessCheck) []accessCheckResult {
+	results := make([]accessCheckResult, len(checks))
+
+	var wg sync.WaitGroup
+
+	for i, check := range checks {
+		wg.Add(1)
+
+		go func(i int, check accessCheck) {
+			defer wg.Done()
+
+			results[i].accessCheck = check
+
+			review := &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Verb:        check.Verb,
+						Group:       check.Group,
+						Resource:    check.Resource,
+						Subresource: check.Subresource,
+						Namespace:   check.Namespace,
+						Name:        check.Name,
+					},
+				},
+			}
+
+			resp, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, v1.CreateOptions{})
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+
+			results[i].Allowed = resp.Status.Allowed
+			results[i].Reason = resp.Status.Reason
+		}(i, check)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// handleCanI answers a list of access checks for the user of the request token
+// in a single round-trip, for the frontend to decide what to show.
+func (c *HeadlampConfig) handleCanI(w http.ResponseWriter, r *http.Request) {
+	var checks []accessCheck
+	if err := json.NewDecoder(r.Body).Decode(&checks); err != nil {
+		http.Error(w, "Error decoding access checks", http.StatusBadRequest)
+		return
+	}
+
+	if len(checks) > maxAccessChecks {
+		http.Error(w, fmt.Sprintf("at most %d access checks are allowed", maxAccessChecks), http.StatusBadRequest)
+		return
+	}
+
+	kContext, err := c.kubeConfigStore.GetContext(mux.Vars(r)["clusterName"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !kContext.IsPathAllowed(accessReviewsPath) {
+		http.Error(w, "path is not allowed for this cluster", http.StatusForbidden)
+		return
+	}
+
+	_, token := parseClusterAndToken(r)
+
+	clientset, err := kContext.ClientSetWithToken(c.clientToken(kContext, token))
+	if err != nil {
+		http.Error(w, "Error getting client", clusterErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(canI(r.Context(), clientset, checks)); err != nil {
+		log.Println("Error encoding access check results", err)
+	}
+}
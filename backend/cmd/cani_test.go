@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCanI(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+			attributes := review.Spec.ResourceAttributes
+
+			if attributes.Resource == "secrets" {
+				return true, nil, errors.New("authorization backend unavailable")
+			}
+
+			review.Status.Allowed = attributes.Verb == "list" && attributes.Namespace == "default"
+			if !review.Status.Allowed {
+				review.Status.Reason = "no RBAC policy matched"
+			}
+
+			return true, review, nil
+		})
+
+	results := canI(context.Background(), clientset, []accessCheck{
+		{Verb: "list", Resource: "pods", Namespace: "default"},
+		{Verb: "delete", Resource: "pods", Namespace: "default"},
+		{Verb: "list", Group: "apps", Resource: "deployments", Namespace: "kube-system"},
+		{Verb: "get", Resource: "secrets", Namespace: "default"},
+	})
+
+	require.Len(t, results, 4)
+
+	assert.Equal(t, "pods", results[0].Resource)
+	assert.True(t, results[0].Allowed)
+
+	assert.False(t, results[1].Allowed)
+	assert.Equal(t, "no RBAC policy matched", results[1].Reason)
+
+	assert.Equal(t, "apps", results[2].Group)
+	assert.False(t, results[2].Allowed)
+
+	assert.False(t, results[3].Allowed)
+	assert.Contains(t, results[3].Error, "authorization backend unavailable")
+}
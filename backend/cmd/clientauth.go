@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+)
+
+// ignoresClientAuth tells whether the Authorization header of clients is
+// ignored for the cluster, so requests always use the context's credentials
+// and clients can't smuggle in other tokens: the setting of the cluster if it
+// has one, otherwise the global one.
+func (c *HeadlampConfig) ignoresClientAuth(kContext *kubeconfig.Context) bool {
+	if info, err := kContext.HeadlampInfo(); err == nil && info.IgnoreClientAuth != nil {
+		return *info.IgnoreClientAuth
+	}
+
+	return c.ignoreClientAuth
+}
+
+// clientToken returns the token a client sent for the cluster, or "" if the
+// cluster ignores client auth, meaning the context's credentials are used.
+func (c *HeadlampConfig) clientToken(kContext *kubeconfig.Context, token string) string {
+	if c.ignoresClientAuth(kContext) {
+		return ""
+	}
+
+	return token
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+//nolint:funlen
+func TestIgnoreClientAuth(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		lastAuth string
+	)
+
+	recordAuth := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastAuth = r.Header.Get("Authorization")
+		mu.Unlock()
+
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	})
+
+	// Credentials are only sent to clusters over TLS.
+	upstream := httptest.NewTLSServer(recordAuth)
+	defer upstream.Close()
+
+	external := httptest.NewServer(recordAuth)
+	defer external.Close()
+
+	newHandler := func(ignoreClientAuth bool) http.Handler {
+		c := HeadlampConfig{
+			cache:            cache.New[interface{}](),
+			kubeConfigStore:  kubeconfig.NewContextStore(),
+			ignoreClientAuth: ignoreClientAuth,
+			enableHelm:       true,
+			proxyURLs:        []string{external.URL + "/*"},
+		}
+
+		for name, info := range map[string]string{
+			"default": "",
+			"ignored": `{"ignoreClientAuth": true}`,
+			"trusted": `{"ignoreClientAuth": false}`,
+		} {
+			extensions := map[string]runtime.Object{}
+			if info != "" {
+				extensions[kubeconfig.HeadlampInfoExtension] = &runtime.Unknown{Raw: []byte(info)}
+			}
+
+			err := c.kubeConfigStore.AddContext(&kubeconfig.Context{
+				Name:        name,
+				KubeContext: &api.Context{Cluster: name, AuthInfo: name, Extensions: extensions},
+				Cluster:     &api.Cluster{Server: upstream.URL, InsecureSkipTLSVerify: true},
+				AuthInfo:    &api.AuthInfo{Token: "context-token"},
+			})
+			require.NoError(t, err)
+		}
+
+		return createHeadlampHandler(&c)
+	}
+
+	authSent := func(handler http.Handler, cluster string) string {
+		req, err := http.NewRequestWithContext(context.Background(), "GET", "/clusters/"+cluster+"/version", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer client-token")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		return rr.Body.String()
+	}
+
+	t.Run("client_auth_used", func(t *testing.T) {
+		handler := newHandler(false)
+
+		assert.Equal(t, "Bearer client-token", authSent(handler, "default"))
+		assert.Equal(t, "Bearer context-token", authSent(handler, "ignored"))
+		assert.Equal(t, "Bearer client-token", authSent(handler, "trusted"))
+	})
+
+	t.Run("client_auth_ignored", func(t *testing.T) {
+		handler := newHandler(true)
+
+		assert.Equal(t, "Bearer context-token", authSent(handler, "default"))
+		assert.Equal(t, "Bearer context-token", authSent(handler, "ignored"))
+		assert.Equal(t, "Bearer client-token", authSent(handler, "trusted"))
+	})
+
+	// The other routes taking a client token use the context's credentials too.
+	lastAuthSent := func(handler http.Handler, method, url string, body interface{}, header http.Header) string {
+		mu.Lock()
+		lastAuth = ""
+		mu.Unlock()
+
+		req, err := makeJSONReq(method, url, body)
+		require.NoError(t, err)
+
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		req.Header.Set("Authorization", "Bearer client-token")
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		return lastAuth
+	}
+
+	t.Run("other_routes", func(t *testing.T) {
+		handler := newHandler(true)
+
+		assert.Equal(t, "Bearer context-token", lastAuthSent(handler, "GET", "/clusters/default/crds", nil, nil))
+
+		assert.Equal(t, "Bearer context-token", lastAuthSent(handler, "GET",
+			"/portforward/check?cluster=default&namespace=default&pod=web&targetPort=80", nil, nil))
+
+		forward := map[string]string{"cluster": "default", "namespace": "default", "pod": "web", "targetPort": "80"}
+		assert.Equal(t, "Bearer context-token", lastAuthSent(handler, "POST", "/portforward", forward, nil))
+
+		assert.Equal(t, "", lastAuthSent(handler, "GET", "/externalproxy", nil,
+			http.Header{"Proxy-To": {external.URL + "/api"}}))
+
+		// Helm always uses the context's credentials.
+		token := uuid.New().String()
+		t.Setenv("HEADLAMP_BACKEND_TOKEN", token)
+
+		assert.Equal(t, "Bearer context-token", lastAuthSent(handler, "GET",
+			"/clusters/trusted/helm/releases/list", nil, http.Header{"X-Headlamp_backend-Token": {token}}))
+	})
+
+	t.Run("other_routes_client_auth_used", func(t *testing.T) {
+		handler := newHandler(false)
+
+		assert.Equal(t, "Bearer client-token", lastAuthSent(handler, "GET", "/clusters/default/crds", nil, nil))
+
+		assert.Equal(t, "Bearer client-token", lastAuthSent(handler, "GET",
+			"/portforward/check?cluster=default&namespace=default&pod=web&targetPort=80", nil, nil))
+
+		forward := map[string]string{"cluster": "default", "namespace": "default", "pod": "web", "targetPort": "80"}
+		assert.Equal(t, "Bearer client-token", lastAuthSent(handler, "POST", "/portforward", forward, nil))
+
+		assert.Equal(t, "Bearer client-token", lastAuthSent(handler, "GET", "/externalproxy", nil,
+			http.Header{"Proxy-To": {external.URL + "/api"}}))
+	})
+}
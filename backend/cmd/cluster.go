@@ -1,14 +1,53 @@
 package main
 
 import (
+	"errors"
+	"net/http"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
 )
 
+// clusterErrorStatus returns the HTTP status of an error of a cluster operation.
+func clusterErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, kubeconfig.ErrClusterNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, kubeconfig.ErrMissingClientKey):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, kubeconfig.ErrCADataUnavailable), errors.Is(err, kubeconfig.ErrProxyNotReady):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, errResponseTooLarge):
+		return http.StatusBadGateway
+	case errors.Is(err, kubeconfig.ErrPathNotAllowed):
+		return http.StatusForbidden
+	}
+
+	return http.StatusInternalServerError
+}
+
+// addClusterErrorStatus returns the HTTP status of errors loading added
+// clusters: the kubeconfig is unprocessable if a context has no cluster,
+// otherwise it is a bad request.
+func addClusterErrorStatus(errs []error) int {
+	if errors.Is(errors.Join(errs...), kubeconfig.ErrClusterNotFound) {
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusBadRequest
+}
+
 type Cluster struct {
 	Name     string                 `json:"name"`
 	Server   string                 `json:"server,omitempty"`
 	AuthType string                 `json:"auth_type"`
 	Metadata map[string]interface{} `json:"meta_data"`
+	// AuthMethod is "oidc", "token", "clientcert" or "anonymous", see
+	// kubeconfig.Context.AuthMethod. Unlike AuthType, it is set for every cluster.
+	AuthMethod string `json:"authMethod"`
+	// Status is "ok", or "error" if the last proxy setup or request failed.
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
 }
 
 type ClusterReq struct {
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestClusterAuthMethod(t *testing.T) {
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+	}
+	handler := createHeadlampHandler(&c)
+
+	for name, authInfo := range map[string]*api.AuthInfo{
+		"oidc":  {AuthProvider: &api.AuthProviderConfig{Name: "oidc"}},
+		"token": {Token: "token"},
+	} {
+		err := c.kubeConfigStore.AddContext(&kubeconfig.Context{
+			Name:        name,
+			KubeContext: &api.Context{Cluster: name, AuthInfo: name},
+			Cluster:     &api.Cluster{Server: "https://127.0.0.1:6443"},
+			AuthInfo:    authInfo,
+		})
+		require.NoError(t, err)
+	}
+
+	rr, err := getResponse(handler, "GET", "/config", nil)
+	require.NoError(t, err)
+
+	var config struct {
+		Clusters []map[string]interface{} `json:"clusters"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &config))
+
+	clusters := map[string]map[string]interface{}{}
+	for _, cluster := range config.Clusters {
+		clusters[cluster["name"].(string)] = cluster
+	}
+
+	// The auth type is kept as is, the auth method is reported next to it.
+	assert.Equal(t, "oidc", clusters["oidc"]["auth_type"])
+	assert.Equal(t, kubeconfig.AuthMethodOIDC, clusters["oidc"]["authMethod"])
+	assert.Equal(t, "", clusters["token"]["auth_type"])
+	assert.Equal(t, kubeconfig.AuthMethodToken, clusters["token"]["authMethod"])
+}
+
+func TestClusterStatus(t *testing.T) {
+	c, handler, _ := newTestCluster(t, "up", func(w http.ResponseWriter, r *http.Request) {}, nil)
+
+	unreachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	unreachable.Close()
+	addTestCluster(t, c, "down", unreachable.URL, "")
+
+	for _, name := range []string{"up", "down"} {
+		_, err := getResponse(handler, "GET", "/clusters/"+name+"/version", nil)
+		require.NoError(t, err)
+	}
+
+	rr, err := getResponse(handler, "GET", "/config", nil)
+	require.NoError(t, err)
+
+	var config clientConfig
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &config))
+
+	statuses := map[string]Cluster{}
+	for _, cluster := range config.Clusters {
+		statuses[cluster.Name] = cluster
+	}
+
+	assert.Equal(t, kubeconfig.StatusOK, statuses["up"].Status)
+	assert.Empty(t, statuses["up"].Error)
+	assert.Equal(t, kubeconfig.StatusError, statuses["down"].Status)
+	assert.Contains(t, statuses["down"].Error, "connection refused")
+}
+
+func TestClusterErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not_found", fmt.Errorf("getting context: %w", kubeconfig.ErrClusterNotFound), http.StatusNotFound},
+		{"missing_client_key", fmt.Errorf("%w for context", kubeconfig.ErrMissingClientKey), http.StatusUnprocessableEntity},
+		{"ca_unavailable", kubeconfig.ErrCADataUnavailable, http.StatusServiceUnavailable},
+		{"proxy_not_ready", kubeconfig.ErrProxyNotReady, http.StatusServiceUnavailable},
+		{"other", errors.New("boom"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, clusterErrorStatus(tt.err))
+		})
+	}
+
+	assert.Equal(t, http.StatusUnprocessableEntity,
+		addClusterErrorStatus([]error{errors.New("boom"), fmt.Errorf("%w", kubeconfig.ErrClusterNotFound)}))
+	assert.Equal(t, http.StatusBadRequest, addClusterErrorStatus([]error{errors.New("boom")}))
+
+	// A cluster whose client certificate has no key can't be used.
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+	}
+
+	require.NoError(t, c.kubeConfigStore.AddContext(&kubeconfig.Context{
+		Name:        "nokey",
+		KubeContext: &api.Context{Cluster: "nokey", AuthInfo: "nokey"},
+		Cluster:     &api.Cluster{Server: "https://127.0.0.1:6443"},
+		AuthInfo:    &api.AuthInfo{ClientCertificateData: []byte("cert")},
+	}))
+
+	handler := createHeadlampHandler(&c)
+
+	req := httptest.NewRequest(http.MethodPost, "/clusters/nokey/can-i", strings.NewReader(`[]`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/clusters/missing/can-i", strings.NewReader(`[]`))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+)
+
+const (
+	// clusterProbeTimeout is how long checking that a cluster is reachable may take.
+	clusterProbeTimeout = 5 * time.Second
+	// clusterHealthCacheTTL is how long the result of checking a cluster is
+	// reused, so frequent health checks don't request every cluster each time.
+	clusterHealthCacheTTL       = 10 * time.Second
+	clusterHealthCacheKeyPrefix = "CLUSTER_HEALTH_"
+)
+
+// clusterHealth is the result of checking that a cluster is reachable.
+type clusterHealth struct {
+	Healthy bool   `json:"healthy"`
+	Path    string `json:"path"`
+	Status  int    `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// probeCluster requests the health check path of the cluster, with the
+// credentials of its context. The cluster is healthy if it answers with 2xx.
+func probeCluster(ctx context.Context, kContext *kubeconfig.Context) clusterHealth {
+	health := clusterHealth{Path: kContext.HealthCheckPath()}
+
+	ctx, cancel := context.WithTimeout(ctx, clusterProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, health.Path, nil)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	resp := &bufferedResponse{header: http.Header{}}
+
+	if err := kContext.ProxyRequest(resp, req); err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	health.Status = resp.status
+	health.Healthy = resp.status >= 200 && resp.status < 300
+
+	if !health.Healthy {
+		health.Error = fmt.Sprintf("%s returned %d", health.Path, resp.status)
+	}
+
+	return health
+}
+
+// cachedClusterHealth returns the recent result of checking the cluster, or
+// checks it. Concurrent checks of a cluster share a single probe.
+func (c *HeadlampConfig) cachedClusterHealth(kContext *kubeconfig.Context) clusterHealth {
+	key := clusterHealthCacheKeyPrefix + kContext.Name
+
+	if cached, err := c.cache.Get(context.Background(), key); err == nil {
+		if health, ok := cached.(clusterHealth); ok {
+			return health
+		}
+	}
+
+	value, _, _ := c.inflightRequests.Do(key, func() (interface{}, error) {
+		// Not bound to a request, as other requests may wait for the result.
+		health := probeCluster(context.Background(), kContext)
+		_ = c.cache.SetWithTTL(context.Background(), key, health, clusterHealthCacheTTL)
+
+		return health, nil
+	})
+
+	health, _ := value.(clusterHealth)
+
+	return health
+}
+
+// handleClustersHealthz checks that the clusters are reachable, concurrently,
+// reusing recent results. It answers 503 if any of them is not.
+func (c *HeadlampConfig) handleClustersHealthz(w http.ResponseWriter, r *http.Request) {
+	contexts, err := c.kubeConfigStore.GetContexts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var (
+		lock sync.Mutex
+		wg   sync.WaitGroup
+	)
+
+	clusters := map[string]clusterHealth{}
+
+	for _, kContext := range contexts {
+		if kContext.Internal || kubeconfig.IsWildcardName(kContext.Name) {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(kContext *kubeconfig.Context) {
+			defer wg.Done()
+
+			health := c.cachedClusterHealth(kContext)
+
+			lock.Lock()
+			clusters[kContext.Name] = health
+			lock.Unlock()
+		}(kContext)
+	}
+
+	wg.Wait()
+
+	status := http.StatusOK
+
+	for _, health := range clusters {
+		if !health.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"clusters": clusters}); err != nil {
+		log.Println("Error encoding clusters health", err)
+	}
+}
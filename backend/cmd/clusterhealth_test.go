@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClustersHealthz(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		paths []string
+	)
+
+	// The API server restricts /version.
+	c, handler, upstream := newTestCluster(t, "default", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		paths = append(paths, r.URL.Path)
+		lock.Unlock()
+
+		if r.URL.Path == "/version" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		_, _ = w.Write([]byte("ok"))
+	}, nil)
+
+	// Leaves out the clusters of the default kubeconfig.
+	c.kubeConfigStore = kubeconfig.NewContextStore()
+
+	addTestCluster(t, c, "custom", upstream.URL, `{"healthCheckPath": "livez"}`)
+
+	// The clusters are only checked for admins on the main listener.
+	rr, err := getResponse(handler, "GET", "/healthz/clusters", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Empty(t, paths)
+
+	rr, err = getResponseFromRestrictedEndpoint(handler, "GET", "/healthz/clusters", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"clusters": {"custom": {"healthy": true, "path": "/livez", "status": 200}}}`, rr.Body.String())
+	assert.Equal(t, []string{"/livez"}, paths)
+
+	// Recent results are reused.
+	rr, err = getResponseFromRestrictedEndpoint(handler, "GET", "/healthz/clusters", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{"/livez"}, paths)
+
+	addTestCluster(t, c, "default", upstream.URL, "")
+
+	rr, err = getResponseFromRestrictedEndpoint(handler, "GET", "/healthz/clusters", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	var health struct {
+		Clusters map[string]clusterHealth `json:"clusters"`
+	}
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &health))
+	assert.True(t, health.Clusters["custom"].Healthy)
+	assert.False(t, health.Clusters["default"].Healthy)
+	assert.Equal(t, "/version", health.Clusters["default"].Path)
+	assert.Equal(t, http.StatusForbidden, health.Clusters["default"].Status)
+}
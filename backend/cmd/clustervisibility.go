@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+)
+
+// verifiedIdentity returns the identity of the request if its bearer token is
+// the ID token of an OIDC session, which was verified on login. Other requests
+// are anonymous, as their tokens, eg. unsigned JWTs, can claim any groups.
+func (c *HeadlampConfig) verifiedIdentity(r *http.Request) identity {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if found && token != "" && c.sessions != nil {
+		if id, ok := c.sessions.identity(token); ok {
+			return id
+		}
+	}
+
+	return identity{Type: "anonymous"}
+}
+
+// visibleClusters returns the clusters listed to the identity, if clusters are
+// filtered by group. This only hides clusters, the clusters still authorize
+// the requests made to them.
+func (c *HeadlampConfig) visibleClusters(clusters []Cluster, id identity) []Cluster {
+	if !c.filterClustersByGroup {
+		return clusters
+	}
+
+	visible := []Cluster{}
+
+	for _, cluster := range clusters {
+		kContext, err := c.kubeConfigStore.GetContext(cluster.Name)
+		if err == nil && isClusterVisible(kContext, id) {
+			visible = append(visible, cluster)
+		}
+	}
+
+	return visible
+}
+
+// visibleContexts returns the contexts listed to the identity, if clusters are
+// filtered by group.
+func (c *HeadlampConfig) visibleContexts(contexts []kubeconfig.Context, id identity) []kubeconfig.Context {
+	if !c.filterClustersByGroup {
+		return contexts
+	}
+
+	visible := []kubeconfig.Context{}
+
+	for i := range contexts {
+		if isClusterVisible(&contexts[i], id) {
+			visible = append(visible, contexts[i])
+		}
+	}
+
+	return visible
+}
+
+// isClusterVisible tells whether the cluster is listed to the identity: public
+// clusters are listed to anyone, others to verified identities in one of their
+// allowed groups, if they have any.
+func isClusterVisible(kContext *kubeconfig.Context, id identity) bool {
+	info, err := kContext.HeadlampInfo()
+	if err != nil {
+		return false
+	}
+
+	if info.Public {
+		return true
+	}
+
+	if id.Type == "anonymous" {
+		return false
+	}
+
+	if len(info.AllowedGroups) == 0 {
+		return true
+	}
+
+	for _, group := range id.Groups {
+		for _, allowed := range info.AllowedGroups {
+			if group == allowed {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterClustersByGroup(t *testing.T) {
+	c := HeadlampConfig{
+		cache:                 cache.New[interface{}](),
+		kubeConfigStore:       kubeconfig.NewContextStore(),
+		filterClustersByGroup: true,
+	}
+
+	handler := createHeadlampHandler(&c)
+
+	// Only the clusters of the test, not the ones of the default kubeconfig.
+	c.kubeConfigStore = kubeconfig.NewContextStore()
+
+	for name, info := range map[string]string{
+		"any":    "",
+		"public": `{"public": true}`,
+		"dev":    `{"allowedGroups": ["dev"]}`,
+		"ops":    `{"allowedGroups": ["ops", "admins"]}`,
+	} {
+		addTestCluster(t, &c, name, "https://"+name+".example.com", info)
+	}
+
+	// sessionToken returns the ID token of a session in the groups, as
+	// verified on login.
+	sessionToken := func(groups ...string) string {
+		claims, err := json.Marshal(map[string]interface{}{"sub": "user", "groups": groups})
+		require.NoError(t, err)
+
+		token := "header." + base64.RawURLEncoding.EncodeToString(claims) + ".signature"
+		c.sessions.add("user", "dev", token, groups)
+
+		return token
+	}
+
+	listedClusters := func(token string) []string {
+		req, err := http.NewRequestWithContext(context.Background(), "GET", "/config", nil)
+		require.NoError(t, err)
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var config clientConfig
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &config))
+
+		names := []string{}
+		for _, cluster := range config.Clusters {
+			names = append(names, cluster.Name)
+		}
+
+		return names
+	}
+
+	assert.ElementsMatch(t, []string{"public"}, listedClusters(""), "anonymous")
+	assert.ElementsMatch(t, []string{"any", "public"}, listedClusters(sessionToken()), "no groups")
+	assert.ElementsMatch(t, []string{"any", "public", "dev"}, listedClusters(sessionToken("dev")))
+	assert.ElementsMatch(t, []string{"any", "public", "dev", "ops"}, listedClusters(sessionToken("dev", "admins")))
+
+	// Tokens which are not the ones of sessions are not verified, whatever they claim.
+	claims, err := json.Marshal(map[string]interface{}{"sub": "user", "groups": []string{"admins"}})
+	require.NoError(t, err)
+
+	unsigned := "header." + base64.RawURLEncoding.EncodeToString(claims) + ".signature"
+	assert.ElementsMatch(t, []string{"public"}, listedClusters(unsigned), "unverified JWT")
+	assert.ElementsMatch(t, []string{"public"}, listedClusters("x"), "opaque token")
+
+	c.filterClustersByGroup = false
+	assert.ElementsMatch(t, []string{"any", "public", "dev", "ops"}, listedClusters(""), "not filtered")
+}
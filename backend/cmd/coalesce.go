@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+)
+
+// coalescedRequestTimeout bounds the upstream requests shared by coalesced
+// requests, which outlive their clients.
+var coalescedRequestTimeout = time.Minute
+
+// isCoalescableRequest returns true if the request is a GET to a discovery or
+// version endpoint, whose identical concurrent requests can share a response:
+// /api, /api/{version}, /apis, /apis/{group}/{version}, /openapi/... and /version.
+func isCoalescableRequest(r *http.Request, apiPath string) bool {
+	if r.Method != http.MethodGet || isStreamingRequest(r) {
+		return false
+	}
+
+	segments := strings.Split(strings.Trim(apiPath, "/"), "/")
+
+	switch segments[0] {
+	case "api":
+		return len(segments) <= 2
+	case "apis":
+		return len(segments) == 1 || len(segments) == 3
+	case "openapi":
+		return true
+	case "version":
+		return len(segments) == 1
+	default:
+		return false
+	}
+}
+
+// proxyCoalesced proxies a request, sharing the upstream request and its
+// response with the concurrent requests of the same key. The key must
+// identify the cluster, request and credentials, like discoveryCacheKey does.
+func (c *HeadlampConfig) proxyCoalesced(kContext *kubeconfig.Context, w http.ResponseWriter, r *http.Request,
+	key string,
+) error {
+	value, err, _ := c.inflightRequests.Do(key, func() (interface{}, error) {
+		// The response is shared, so it must not be cut short by the first
+		// client going away, but a hung cluster must not hold it forever.
+		ctx, cancel := context.WithTimeout(context.Background(), coalescedRequestTimeout)
+		defer cancel()
+
+		sharedRequest := r.Clone(ctx)
+
+		resp := &bufferedResponse{header: http.Header{}}
+		if err := kContext.ProxyRequest(resp, sharedRequest); err != nil {
+			return nil, err
+		}
+
+		return resp, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, _ := value.(*bufferedResponse)
+	writeBufferedResponse(w, resp)
+
+	return nil
+}
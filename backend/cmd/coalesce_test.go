@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalesceDiscoveryRequests(t *testing.T) {
+	const clients = 10
+
+	var requests int32
+
+	release := make(chan struct{})
+
+	_, handler, _ := newTestCluster(t, "test", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+
+		_, _ = w.Write([]byte(`{"kind": "APIGroupList"}`))
+	}, nil)
+
+	responses := make(chan *httptest.ResponseRecorder, clients)
+
+	for i := 0; i < clients; i++ {
+		go func() {
+			rr, err := getResponse(handler, "GET", "/clusters/test/apis", nil)
+			assert.NoError(t, err)
+
+			responses <- rr
+		}()
+	}
+
+	// Let the first request reach the cluster and the others join it.
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&requests) == 1
+	}, time.Second, time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < clients; i++ {
+		rr := <-responses
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"kind": "APIGroupList"}`, rr.Body.String())
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// Requests which are not for discovery are not coalesced.
+	assert.True(t, isCoalescableRequest(httptest.NewRequest("GET", "/apis/apps/v1", nil), "/apis/apps/v1"))
+	assert.False(t, isCoalescableRequest(httptest.NewRequest("GET", "/apis/apps/v1/deployments", nil),
+		"/apis/apps/v1/deployments"))
+	assert.False(t, isCoalescableRequest(httptest.NewRequest("POST", "/apis", nil), "/apis"))
+}
+
+func TestCoalescedRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	_, handler, _ := newTestCluster(t, "hung", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}, nil)
+
+	timeout := coalescedRequestTimeout
+	coalescedRequestTimeout = 100 * time.Millisecond
+
+	t.Cleanup(func() { coalescedRequestTimeout = timeout })
+
+	// The shared request gives up on a cluster which never answers.
+	start := time.Now()
+
+	rr, err := getResponse(handler, "GET", "/clusters/hung/apis", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+)
+
+// kubeContext is a context of the kubeconfig files listed by /contexts.
+type kubeContext struct {
+	Name    string `json:"name"`
+	Cluster string `json:"cluster"`
+	Server  string `json:"server"`
+	// AuthType is "oidc", "token", "clientcert" or "anonymous", see
+	// kubeconfig.Context.AuthMethod.
+	AuthType string `json:"authType"`
+}
+
+// handleListContexts lists the contexts of the kubeconfig files, whether or
+// not Headlamp proxies requests to them. The files are parsed on each request
+// and no proxies are set up, so it is cheap even for many contexts. As the
+// contexts are not meant to all be exposed, it requires the backend token.
+func (c *HeadlampConfig) handleListContexts(w http.ResponseWriter, r *http.Request) {
+	contexts, err := kubeconfig.ListContextsFromFiles(c.kubeConfigPath)
+	if err != nil {
+		// The contexts which could be loaded are still listed.
+		log.Printf("Error listing kubeconfig contexts: %v", err)
+	}
+
+	contexts = c.visibleContexts(contexts, c.verifiedIdentity(r))
+
+	list := make([]kubeContext, 0, len(contexts))
+
+	for _, context := range contexts {
+		context := context
+
+		list = append(list, kubeContext{
+			Name:     context.Name,
+			Cluster:  context.KubeContext.Cluster,
+			Server:   context.Cluster.Server,
+			AuthType: context.AuthMethod(),
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		log.Println("Error encoding contexts", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestListContexts(t *testing.T) {
+	extraKubeConfig := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, clientcmd.WriteToFile(api.Config{
+		Clusters:  map[string]*api.Cluster{"staging": {Server: "https://staging.example.com"}},
+		AuthInfos: map[string]*api.AuthInfo{"staging": {Token: "token"}},
+		Contexts:  map[string]*api.Context{"staging": {Cluster: "staging", AuthInfo: "staging"}},
+	}, extraKubeConfig))
+
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+		kubeConfigPath:  "./headlamp_testdata/kubeconfig" + string(os.PathListSeparator) + extraKubeConfig,
+	}
+
+	rr := httptest.NewRecorder()
+	c.handleListContexts(rr, httptest.NewRequest(http.MethodGet, "/contexts", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var contexts []kubeContext
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&contexts))
+
+	assert.Equal(t, []kubeContext{
+		{
+			Name: "docker-desktop", Cluster: "docker-desktop",
+			Server: "https://kubernetes.docker.internal:6443", AuthType: kubeconfig.AuthMethodClientCert,
+		},
+		{Name: "minikube", Cluster: "minikube", Server: "https://127.0.0.1:60279", AuthType: kubeconfig.AuthMethodClientCert},
+		{Name: "staging", Cluster: "staging", Server: "https://staging.example.com", AuthType: kubeconfig.AuthMethodToken},
+	}, contexts)
+
+	// Listing contexts doesn't register them.
+	stored, err := c.kubeConfigStore.GetContexts()
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+
+	handler := createHeadlampHandler(&HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+		kubeConfigPath:  extraKubeConfig,
+	})
+
+	rr, err = getResponse(handler, "GET", "/contexts", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rr.Code, "requires the backend token")
+	assert.NotContains(t, rr.Body.String(), "staging")
+
+	rr, err = getResponseFromRestrictedEndpoint(handler, "GET", "/contexts", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "https://staging.example.com")
+
+	// Contexts are filtered like the clusters of /config.
+	c.filterClustersByGroup = true
+	rr = httptest.NewRecorder()
+	c.handleListContexts(rr, httptest.NewRequest(http.MethodGet, "/contexts", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[]`, rr.Body.String())
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// authCookie returns a cookie holding credentials, with the configured
+// attributes. It is always HttpOnly, so scripts can't read it.
+func (c *HeadlampConfig) authCookie(name, value string, expires time.Time) *http.Cookie {
+	path := c.cookiePath
+	if path == "" {
+		path = frontendBaseURL(c.baseURL)
+	}
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.cookieDomain,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   c.cookieSecure,
+		SameSite: sameSiteMode(c.cookieSameSite),
+	}
+}
+
+// sameSiteMode returns the SameSite mode of a cookie-samesite value, Lax by default.
+func sameSiteMode(mode string) http.SameSite {
+	switch strings.ToLower(mode) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
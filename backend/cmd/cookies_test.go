@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthCookieAttributes(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		config HeadlampConfig
+		want   []string
+	}{
+		{
+			name:   "defaults",
+			config: HeadlampConfig{cookieSecure: true, baseURL: "/headlamp"},
+			want:   []string{"Path=/headlamp", "HttpOnly", "Secure", "SameSite=Lax"},
+		},
+		{
+			name: "custom",
+			config: HeadlampConfig{
+				cookieSecure: true, cookieSameSite: "none", cookieDomain: "example.com", cookiePath: "/",
+			},
+			want: []string{"Path=/", "Domain=example.com", "HttpOnly", "Secure", "SameSite=None"},
+		},
+		{
+			name:   "insecure_strict",
+			config: HeadlampConfig{cookieSameSite: "Strict"},
+			want:   []string{"Path=/", "HttpOnly", "SameSite=Strict"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			http.SetCookie(rr, tc.config.authCookie(ShareCookieName, "token", expires))
+
+			setCookie := rr.Header().Get("Set-Cookie")
+			for _, attribute := range tc.want {
+				assert.Contains(t, setCookie, "; "+attribute)
+			}
+
+			assert.Equal(t, tc.config.cookieSecure, strings.Contains(setCookie, "; Secure"))
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/handlers"
+)
+
+// corsOrigins returns the origins allowed to make cross-origin requests. On dev
+// mode we're loose about where connections come from.
+func (c *HeadlampConfig) corsOrigins() []string {
+	if c.devMode {
+		return []string{"*"}
+	}
+
+	origins := []string{}
+
+	for _, origin := range c.corsAllowedOrigins {
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	return origins
+}
+
+// corsHandler answers cross-origin requests from the origins with the
+// Access-Control-* headers. Preflight requests get a 204 without reaching the
+// handler, so they don't fall through to the frontend.
+func corsHandler(handler http.Handler, origins []string) http.Handler {
+	headers := handlers.AllowedHeaders([]string{
+		"X-HEADLAMP_BACKEND-TOKEN", "X-Requested-With", "Content-Type",
+		"Authorization", "Forward-To",
+		"KUBECONFIG", "X-HEADLAMP-USER-ID", MethodOverrideHeader,
+	})
+	methods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "HEAD", "DELETE", "PATCH", "OPTIONS"})
+
+	return handlers.CORS(headers, methods, handlers.AllowedOrigins(origins),
+		handlers.OptionStatusCode(http.StatusNoContent))(handler)
+}
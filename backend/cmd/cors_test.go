@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	handler := createHeadlampHandler(&HeadlampConfig{
+		cache:              cache.New[interface{}](),
+		kubeConfigStore:    kubeconfig.NewContextStore(),
+		staticDir:          copyStaticFiles(t),
+		corsAllowedOrigins: []string{"https://app.example.com"},
+	})
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodOptions, "/config", nil)
+		require.NoError(t, err)
+
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+		req.Header.Set("Access-Control-Request-Headers", "Authorization")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := preflight("https://app.example.com")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, rr.Header().Get("Access-Control-Allow-Methods"), http.MethodDelete)
+	assert.Equal(t, "Authorization", rr.Header().Get("Access-Control-Allow-Headers"))
+	assert.Empty(t, rr.Body.String(), "preflights don't fall through to the frontend")
+
+	rr = preflight("https://other.example.com")
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rr.Body.String())
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/config", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", "https://app.example.com")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+}
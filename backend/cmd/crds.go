@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+)
+
+const (
+	crdCacheKeyPrefix = "CRDS_"
+	crdListPath       = "/apis/apiextensions.k8s.io/v1/customresourcedefinitions"
+)
+
+// crdCacheKey returns the cache key of the CRD list of a cluster. The key
+// includes a hash of the credentials, so lists are only served to the same caller.
+func crdCacheKey(clusterName string, r *http.Request) string {
+	hash := sha256.Sum256([]byte(r.Header.Get("Authorization")))
+
+	return crdCacheKeyPrefix + clusterName + "#" + hex.EncodeToString(hash[:])
+}
+
+// handleCRDs serves the CustomResourceDefinitions of a cluster, fetched with
+// the token of the request and cached for the CRD cache TTL (0 disables the
+// cache). A request with the X-Refresh header skips the cache.
+func (c *HeadlampConfig) handleCRDs(w http.ResponseWriter, r *http.Request) {
+	clusterName := mux.Vars(r)["clusterName"]
+
+	kContext, err := c.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !kContext.IsPathAllowed(crdListPath) {
+		http.Error(w, "path is not allowed for this cluster", http.StatusForbidden)
+		return
+	}
+
+	if c.ignoresClientAuth(kContext) {
+		r.Header.Del("Authorization")
+	}
+
+	key := crdCacheKey(clusterName, r)
+
+	if r.Header.Get("X-Refresh") == "" {
+		if value, err := c.cache.Get(context.Background(), key); err == nil {
+			if body, ok := value.([]byte); ok {
+				writeCRDList(w, body)
+				return
+			}
+		}
+	}
+
+	resp, err := fetchCRDList(kContext, r)
+	if errors.Is(err, kubeconfig.ErrProxyNotReady) {
+		w.Header().Set("Retry-After", strconv.Itoa(ProxyNotReadyRetryAfter))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error: failed to fetch CRDs of %s: %s", clusterName, err)
+		http.Error(w, err.Error(), clusterErrorStatus(err))
+
+		return
+	}
+
+	if resp.status != http.StatusOK {
+		writeBufferedResponse(w, resp)
+		return
+	}
+
+	body := resp.body.Bytes()
+
+	if c.crdCacheTTL > 0 {
+		_ = c.cache.SetWithTTL(context.Background(), key, body, c.crdCacheTTL)
+	}
+
+	writeCRDList(w, body)
+}
+
+// fetchCRDList lists the CustomResourceDefinitions through the cluster proxy,
+// with the credentials of the request.
+func fetchCRDList(kContext *kubeconfig.Context, r *http.Request) (*bufferedResponse, error) {
+	clusterURL, err := url.Parse(kContext.Cluster.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	listRequest := r.Clone(r.Context())
+	listRequest.Method = http.MethodGet
+	listRequest.Body = http.NoBody
+	listRequest.ContentLength = 0
+	listRequest.Host = clusterURL.Host
+	listRequest.URL.Path = crdListPath
+	listRequest.URL.RawPath = ""
+	listRequest.URL.RawQuery = ""
+	listRequest.Header.Set("Accept", "application/json")
+	listRequest.Header.Del("X-Refresh")
+	// The list is cached decoded, so let the transport handle the encoding.
+	listRequest.Header.Del("Accept-Encoding")
+
+	resp := &bufferedResponse{header: http.Header{}}
+	if err := kContext.ProxyRequest(resp, listRequest); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func writeCRDList(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, err := w.Write(body); err != nil {
+		log.Println("Error writing CRD list", err)
+	}
+}
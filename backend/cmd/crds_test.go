@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRDCache(t *testing.T) {
+	var requests int32
+
+	_, handler, _ := newTestCluster(t, "test", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		assert.Equal(t, "/apis/apiextensions.k8s.io/v1/customresourcedefinitions", r.URL.Path)
+		assert.Equal(t, "Bearer user-token", r.Header.Get("Authorization"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind": "CustomResourceDefinitionList",
+			"items": [{"metadata": {"name": "foos.example.com"}}]}`))
+	}, &HeadlampConfig{
+		crdCacheTTL: time.Minute,
+	})
+
+	getCRDs := func(refresh bool) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(context.Background(), "GET", "/clusters/test/crds", nil)
+		require.NoError(t, err)
+
+		req.Header.Set("Authorization", "Bearer user-token")
+
+		if refresh {
+			req.Header.Set("X-Refresh", "true")
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	for i := 0; i < 3; i++ {
+		rr := getCRDs(false)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "foos.example.com")
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	rr := getCRDs(true)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
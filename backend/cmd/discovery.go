@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/utils"
+)
+
+const discoveryCacheKeyPrefix = "DISCOVERY_"
+
+// discoveryPaths are the Kubernetes API discovery endpoints whose responses can be cached.
+var discoveryPaths = []string{"/api", "/apis", "/openapi/v2"}
+
+// cachedResponse is a discovery response stored in the cache.
+type cachedResponse struct {
+	Header http.Header
+	Body   []byte
+}
+
+// responseCapture is a http.ResponseWriter that keeps a copy of what is written.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rc *responseCapture) WriteHeader(status int) {
+	rc.status = status
+	rc.ResponseWriter.WriteHeader(status)
+}
+
+func (rc *responseCapture) Write(b []byte) (int, error) {
+	if rc.status == 0 {
+		rc.status = http.StatusOK
+	}
+
+	rc.body.Write(b)
+
+	return rc.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (rc *responseCapture) Unwrap() http.ResponseWriter {
+	return rc.ResponseWriter
+}
+
+// isDiscoveryRequest returns true if the request is a GET to one of the discovery endpoints.
+func isDiscoveryRequest(r *http.Request, apiPath string) bool {
+	return r.Method == http.MethodGet && utils.Contains(discoveryPaths, "/"+strings.Trim(apiPath, "/"))
+}
+
+// discoveryCacheKey returns the cache key for a discovery request. The key includes
+// a hash of the credentials, so cached responses are only served to the same caller.
+func discoveryCacheKey(contextKey string, r *http.Request, apiPath string) string {
+	hash := sha256.Sum256([]byte(r.Header.Get("Authorization")))
+
+	return discoveryCacheKeyPrefix + contextKey + "/" + strings.Trim(apiPath, "/") + "?" + r.URL.RawQuery +
+		"#" + r.Header.Get("Accept") + "#" + r.Header.Get("Accept-Encoding") + "#" + hex.EncodeToString(hash[:])
+}
+
+// serveCachedDiscovery writes a cached discovery response for the request if there is one.
+// It returns true if the response was served from the cache.
+func (c *HeadlampConfig) serveCachedDiscovery(w http.ResponseWriter, r *http.Request, key string) bool {
+	if r.Header.Get("X-Refresh") != "" {
+		return false
+	}
+
+	value, err := c.cache.Get(context.Background(), key)
+	if err != nil {
+		return false
+	}
+
+	resp, ok := value.(cachedResponse)
+	if !ok {
+		return false
+	}
+
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(resp.Body); err != nil {
+		log.Println("Error writing cached discovery response", err)
+	}
+
+	return true
+}
+
+// cacheDiscoveryResponse stores a successful discovery response in the cache.
+func (c *HeadlampConfig) cacheDiscoveryResponse(key string, rc *responseCapture) {
+	if rc.status != http.StatusOK {
+		return
+	}
+
+	resp := cachedResponse{
+		Header: rc.Header().Clone(),
+		Body:   rc.body.Bytes(),
+	}
+
+	// The plugin reload signal is meant for a single response only.
+	resp.Header.Del("X-Reload")
+
+	_ = c.cache.SetWithTTL(context.Background(), key, resp, c.discoveryCacheTTL)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoveryCache(t *testing.T) {
+	upstreamHits := 0
+
+	_, handler, _ := newTestCluster(t, "discovery", func(w http.ResponseWriter, r *http.Request) {
+		upstreamHits++
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"kind":"APIVersions"}`))
+		require.NoError(t, err)
+	}, &HeadlampConfig{
+		discoveryCacheTTL: time.Minute,
+	})
+
+	getAPI := func(token string, refresh bool) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(context.Background(), "GET", "/clusters/discovery/api", nil)
+		require.NoError(t, err)
+
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		if refresh {
+			req.Header.Set("X-Refresh", "true")
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := getAPI("token-a", false)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 1, upstreamHits)
+
+	// The second request is served from the cache.
+	rr = getAPI("token-a", false)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"kind":"APIVersions"}`, rr.Body.String())
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, 1, upstreamHits)
+
+	// Other credentials are not served the cached response.
+	getAPI("token-b", false)
+	assert.Equal(t, 2, upstreamHits)
+
+	// X-Refresh bypasses the cache.
+	getAPI("token-a", true)
+	assert.Equal(t, 3, upstreamHits)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	zlog "github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// errorReportsPerMinute is how many frontend error reports are logged per
+	// minute, so a broken or malicious client can't flood the logs.
+	errorReportsPerMinute = 30
+	// maxErrorReportSize is the maximum size in bytes of an error report.
+	maxErrorReportSize = 64 * 1024
+)
+
+// RequestIDHeader is the header carrying the ID of a request, which is
+// generated if the client did not send one.
+const RequestIDHeader = "X-Request-Id"
+
+// errorReport is an error of the frontend, as reported to /telemetry/error.
+type errorReport struct {
+	Message string `json:"message"`
+	Stack   string `json:"stack"`
+	Cluster string `json:"cluster"`
+	Version string `json:"version"`
+}
+
+func newErrorReportLimiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Every(time.Minute/errorReportsPerMinute), errorReportsPerMinute)
+}
+
+// handleErrorReport logs an error reported by the frontend.
+func (c *HeadlampConfig) handleErrorReport(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Header.Get(RequestIDHeader)
+	if requestID == "" {
+		requestID = uuid.New().String()
+	}
+
+	w.Header().Set(RequestIDHeader, requestID)
+
+	if !c.errorReportLimiter.Allow() {
+		http.Error(w, "too many error reports", http.StatusTooManyRequests)
+		return
+	}
+
+	var report errorReport
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxErrorReportSize)).Decode(&report); err != nil {
+		http.Error(w, "invalid error report: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	zlog.Error().
+		Str("action", "frontend_error").
+		Str("requestID", requestID).
+		Str("cluster", report.Cluster).
+		Str("version", report.Version).
+		Str("stack", report.Stack).
+		Msg(report.Message)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	zlog "github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestErrorReport(t *testing.T) {
+	logger := zlog.Logger
+	defer func() { zlog.Logger = logger }()
+
+	var logs bytes.Buffer
+	zlog.Logger = zlog.Output(&logs)
+
+	c := HeadlampConfig{
+		cache:              cache.New[interface{}](),
+		kubeConfigStore:    kubeconfig.NewContextStore(),
+		enableErrorReports: true,
+		errorReportLimiter: rate.NewLimiter(0, 1),
+	}
+	handler := createHeadlampHandler(&c)
+
+	report := errorReport{Message: "Cannot read properties of undefined", Stack: "at render", Cluster: "main"}
+
+	rr, err := getResponse(handler, "POST", "/telemetry/error", report)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	requestID := rr.Header().Get(RequestIDHeader)
+	assert.NotEmpty(t, requestID)
+	assert.Contains(t, logs.String(), "Cannot read properties of undefined")
+	assert.Contains(t, logs.String(), requestID)
+
+	// The limiter allows a single report.
+	rr, err = getResponse(handler, "POST", "/telemetry/error", report)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+}
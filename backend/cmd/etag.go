@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// contentETag returns a strong ETag of the body, which changes with its content.
+func contentETag(body []byte) string {
+	hash := sha256.Sum256(body)
+
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// etagMatches returns whether the If-None-Match header lists the ETag, or is "*".
+// Weak ETags match too, as they do for GET requests.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeWithETag writes the body with its ETag, or only a 304 if the client
+// already has it, so clients polling for changes don't download it again.
+func writeWithETag(w http.ResponseWriter, r *http.Request, body []byte) {
+	etag := contentETag(body)
+
+	w.Header().Set("ETag", etag)
+	// Clients must check with us before using their copy.
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		// A 304 has no body, nor a Content-Type.
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	if _, err := w.Write(body); err != nil {
+		log.Println("Error writing response", err)
+	}
+}
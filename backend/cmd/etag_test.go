@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigETag(t *testing.T) {
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+	}
+	handler := createHeadlampHandler(&c)
+	c.kubeConfigStore = kubeconfig.NewContextStore()
+
+	getConfig := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/config", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := getConfig("")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	etag := rr.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// Unchanged config.
+	rr = getConfig(etag)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.String())
+	assert.Equal(t, etag, rr.Header().Get("ETag"))
+
+	rr = getConfig(`"other", W/` + etag)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	addTestCluster(t, &c, "added", "https://added.example.com", "")
+
+	// The added cluster changes the config.
+	rr = getConfig(etag)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"added"`)
+
+	newETag := rr.Header().Get("ETag")
+	assert.NotEmpty(t, newETag)
+	assert.NotEqual(t, etag, newETag)
+
+	rr = getConfig(newETag)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	require.NoError(t, c.kubeConfigStore.RemoveContext("added"))
+
+	rr = getConfig(newETag)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), `"added"`)
+}
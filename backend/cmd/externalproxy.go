@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// maxProxyRedirects is the number of redirects external proxy requests follow.
+const maxProxyRedirects = 10
+
+// errRedirectNotAllowed is returned when an external proxy URL redirects to a
+// URL requests can't be proxied to.
+var errRedirectNotAllowed = errors.New("redirect to a URL which is not allowed")
+
+// isProxyURLAllowed tells whether requests can be proxied to u: it is an http
+// or https URL matching one of the proxyURLs globs.
+func isProxyURLAllowed(proxyURLs []string, u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	for _, proxyURL := range proxyURLs {
+		g := glob.MustCompile(proxyURL)
+		if g.Match(u.String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// externalProxyClient returns the client of external proxy requests, with
+// transport. It only follows redirects to URLs requests can be proxied to, so
+// an allowed URL can't redirect to eg. a file:// or gopher:// one, or to
+// another host.
+func externalProxyClient(transport http.RoundTripper, proxyURLs []string) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxProxyRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxProxyRedirects)
+			}
+
+			if !isProxyURLAllowed(proxyURLs, req.URL) {
+				return fmt.Errorf("%w: %s", errRedirectNotAllowed, req.URL.Redacted())
+			}
+
+			return nil
+		},
+	}
+}
+
+// dropDisallowedLocation removes the Location header of a response if it is
+// not a URL requests can be proxied to, so it isn't passed to the client.
+func dropDisallowedLocation(resp *http.Response, proxyURLs []string) {
+	location, err := resp.Location()
+	if errors.Is(err, http.ErrNoLocation) {
+		return
+	}
+
+	if err != nil || !isProxyURLAllowed(proxyURLs, location) {
+		resp.Header.Del("Location")
+	}
+}
+
+// keepProxyOrigin is the origin of a proxy-url-origins entry forwarding the
+// client's Origin and Referer unchanged.
+const keepProxyOrigin = "keep"
+
+// setProxyOrigin sets the Origin and Referer of a request to an external
+// proxy URL. The first "<glob>=<origin>" entry of proxyOrigins matching the
+// URL decides them: "keep" forwards the client's, any other origin replaces
+// them. Without a matching entry they are stripped, so the Headlamp origin
+// does not leak to the upstream.
+func setProxyOrigin(header http.Header, proxyOrigins []string, targetURL string) {
+	for _, entry := range proxyOrigins {
+		pattern, origin, found := strings.Cut(entry, "=")
+		if !found {
+			continue
+		}
+
+		g, err := glob.Compile(pattern)
+		if err != nil || !g.Match(targetURL) {
+			continue
+		}
+
+		if origin == keepProxyOrigin {
+			return
+		}
+
+		header.Set("Origin", origin)
+		header.Set("Referer", strings.TrimSuffix(origin, "/")+"/")
+
+		return
+	}
+
+	header.Del("Origin")
+	header.Del("Referer")
+}
+
+// grpcWebContentType is the prefix of the content types of gRPC-Web
+// responses, eg. application/grpc-web+proto or application/grpc-web-text.
+const grpcWebContentType = "application/grpc-web"
+
+// grpcWebBufferSize is the size of the chunks gRPC-Web responses are
+// streamed in.
+const grpcWebBufferSize = 32 * 1024
+
+// hopHeaders are the headers of a connection, not of the response, so they
+// are not passed through.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Connection",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// isGRPCWeb tells whether a response is a gRPC-Web one.
+func isGRPCWeb(resp *http.Response) bool {
+	return strings.HasPrefix(strings.ToLower(resp.Header.Get("Content-Type")), grpcWebContentType)
+}
+
+// copyGRPCWebResponse passes a gRPC-Web response through unmodified: its
+// status, headers, body and trailers. The body is flushed as it arrives, so
+// server streaming calls work.
+func copyGRPCWebResponse(w http.ResponseWriter, resp *http.Response) error {
+	for h, val := range resp.Header {
+		w.Header()[h] = val
+	}
+
+	for _, h := range hopHeaders {
+		w.Header().Del(h)
+	}
+
+	// Announce the trailers the upstream announced.
+	for h := range resp.Trailer {
+		w.Header().Add("Trailer", h)
+	}
+
+	w.WriteHeader(resp.StatusCode)
+
+	rc := http.NewResponseController(w)
+	buf := make([]byte, grpcWebBufferSize)
+
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return writeErr
+			}
+
+			if flushErr := rc.Flush(); flushErr != nil && !errors.Is(flushErr, http.ErrNotSupported) {
+				return flushErr
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// Trailers are only known once the body was read.
+	for h, val := range resp.Trailer {
+		w.Header()[http.TrailerPrefix+h] = val
+	}
+
+	return nil
+}
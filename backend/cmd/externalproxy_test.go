@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExternalProxyGzip tests that gzip responses of the external proxy are
+// passed through by default, and decompressed when enabled.
+func TestExternalProxyGzip(t *testing.T) {
+	var compressed bytes.Buffer
+
+	gz := gzip.NewWriter(&compressed)
+	_, err := gz.Write([]byte("decompressed"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(compressed.Bytes())
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name     string
+		gunzip   bool
+		body     []byte
+		encoding string
+	}{
+		{name: "passthrough", body: compressed.Bytes(), encoding: "gzip"},
+		{name: "gunzip", gunzip: true, body: []byte("decompressed")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := createHeadlampHandler(&HeadlampConfig{
+				proxyURLs:           []string{upstream.URL},
+				gunzipExternalProxy: tc.gunzip,
+				cache:               cache.New[interface{}](),
+				kubeConfigStore:     kubeconfig.NewContextStore(),
+			})
+
+			req, err := http.NewRequestWithContext(context.Background(), "GET", "/externalproxy", nil)
+			require.NoError(t, err)
+			req.Header.Set("proxy-to", upstream.URL)
+			req.Header.Set("Accept-Encoding", "gzip")
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tc.body, rr.Body.Bytes())
+			assert.Equal(t, tc.encoding, rr.Header().Get("Content-Encoding"))
+		})
+	}
+}
+
+func TestExternalProxyGRPCWeb(t *testing.T) {
+	// A length-prefixed gRPC-Web data frame.
+	frame := []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x08, 0x01}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		w.Header().Set("Grpc-Accept-Encoding", "identity")
+		w.WriteHeader(http.StatusOK)
+
+		_, err := w.Write(frame)
+		require.NoError(t, err)
+
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "done")
+	}))
+	defer upstream.Close()
+
+	handler := createHeadlampHandler(&HeadlampConfig{
+		proxyURLs:       []string{upstream.URL + "*"},
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+	})
+
+	req, err := http.NewRequestWithContext(context.Background(), "POST", "/externalproxy",
+		strings.NewReader("\x00\x00\x00\x00\x00"))
+	require.NoError(t, err)
+	req.Header.Set("proxy-to", upstream.URL+"/echo.Echo/Echo")
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	resp := rr.Result()
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/grpc-web+proto", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "identity", resp.Header.Get("Grpc-Accept-Encoding"))
+	assert.Equal(t, frame, rr.Body.Bytes())
+	assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+	assert.Equal(t, "done", resp.Trailer.Get("Grpc-Message"))
+}
+
+func TestExternalProxyOrigin(t *testing.T) {
+	var origin, referer string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin, referer = r.Header.Get("Origin"), r.Header.Get("Referer")
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name         string
+		proxyOrigins []string
+		wantOrigin   string
+		wantReferer  string
+	}{
+		{name: "stripped_by_default", proxyOrigins: []string{""}},
+		{
+			name:         "rewritten",
+			proxyOrigins: []string{upstream.URL + "*=https://headlamp.example.com"},
+			wantOrigin:   "https://headlamp.example.com",
+			wantReferer:  "https://headlamp.example.com/",
+		},
+		{
+			name:         "kept",
+			proxyOrigins: []string{"https://other.example.com/*=https://headlamp.example.com", upstream.URL + "*=keep"},
+			wantOrigin:   "http://localhost:4466",
+			wantReferer:  "http://localhost:4466/c/main/",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			handler := createHeadlampHandler(&HeadlampConfig{
+				proxyURLs:       []string{upstream.URL + "*"},
+				proxyOrigins:    tt.proxyOrigins,
+				cache:           cache.New[interface{}](),
+				kubeConfigStore: kubeconfig.NewContextStore(),
+			})
+
+			req, err := http.NewRequestWithContext(context.Background(), "GET", "/externalproxy", nil)
+			require.NoError(t, err)
+			req.Header.Set("proxy-to", upstream.URL+"/api")
+			req.Header.Set("Origin", "http://localhost:4466")
+			req.Header.Set("Referer", "http://localhost:4466/c/main/")
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.wantOrigin, origin)
+			assert.Equal(t, tt.wantReferer, referer)
+		})
+	}
+}
+
+func TestExternalProxyRedirect(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("other host"))
+	}))
+	defer other.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gopher":
+			http.Redirect(w, r, "gopher://127.0.0.1:70/secret", http.StatusFound)
+		case "/file":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		case "/other":
+			http.Redirect(w, r, other.URL, http.StatusFound)
+		case "/allowed":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		default:
+			_, _ = w.Write([]byte("target"))
+		}
+	}))
+	defer upstream.Close()
+
+	handler := createHeadlampHandler(&HeadlampConfig{
+		proxyURLs:       []string{upstream.URL + "/*"},
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+	})
+
+	proxy := func(path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(context.Background(), "GET", "/externalproxy", nil)
+		require.NoError(t, err)
+		req.Header.Set("proxy-to", upstream.URL+path)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	for _, path := range []string{"/gopher", "/file", "/other"} {
+		rr := proxy(path)
+		assert.Equal(t, http.StatusBadGateway, rr.Code, path)
+		assert.Contains(t, rr.Body.String(), errRedirectNotAllowed.Error(), path)
+		assert.NotContains(t, rr.Body.String(), "other host", path)
+	}
+
+	rr := proxy("/allowed")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "target", rr.Body.String())
+}
+
+func TestDropDisallowedLocation(t *testing.T) {
+	proxyURLs := []string{"https://example.com/*"}
+
+	for location, kept := range map[string]bool{
+		"https://example.com/next": true,
+		"gopher://example.com/":    false,
+		"https://evil.com/":        false,
+		"":                         true,
+	} {
+		resp := &http.Response{Header: http.Header{}, Request: &http.Request{
+			URL: &url.URL{Scheme: "https", Host: "example.com", Path: "/"},
+		}}
+		if location != "" {
+			resp.Header.Set("Location", location)
+		}
+
+		dropDisallowedLocation(resp, proxyURLs)
+		assert.Equal(t, kept, resp.Header.Get("Location") == location, location)
+	}
+}
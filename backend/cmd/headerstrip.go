@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+)
+
+// headerStripWriter is a http.ResponseWriter removing some headers from the
+// response before it is sent, eg. those of upstream servers.
+type headerStripWriter struct {
+	http.ResponseWriter
+	headers     []string
+	wroteHeader bool
+}
+
+// WriteHeader removes the headers, each time as informational responses can
+// come before the final one.
+func (hw *headerStripWriter) WriteHeader(statusCode int) {
+	hw.wroteHeader = true
+
+	for _, header := range hw.headers {
+		hw.ResponseWriter.Header().Del(header)
+	}
+
+	hw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (hw *headerStripWriter) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+
+	return hw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (hw *headerStripWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
+
+// stripResponseHeaders returns w wrapped so that the configured response
+// headers are removed, or w itself if none are configured.
+func (c *HeadlampConfig) stripResponseHeaders(w http.ResponseWriter) http.ResponseWriter {
+	if len(c.strippedHeaders) == 0 {
+		return w
+	}
+
+	return &headerStripWriter{ResponseWriter: w, headers: c.strippedHeaders}
+}
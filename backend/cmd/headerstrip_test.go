@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripResponseHeaders(t *testing.T) {
+	_, handler, _ := newTestCluster(t, "test", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "apiserver")
+		w.Header().Set("X-Debug-Info", "internal")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}"))
+	}, &HeadlampConfig{
+		strippedHeaders: []string{"Server", "X-Debug-Info"},
+	})
+
+	rr, err := getResponse(handler, "GET", "/clusters/test/api/v1/pods", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "{}", rr.Body.String())
+	assert.Empty(t, rr.Header().Get("Server"))
+	assert.Empty(t, rr.Header().Get("X-Debug-Info"))
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+}
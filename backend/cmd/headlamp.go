@@ -12,6 +12,7 @@ import (
 	"io"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -19,26 +20,31 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	oidc "github.com/coreos/go-oidc"
 	"github.com/gobwas/glob"
 	"github.com/google/uuid"
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
 	"github.com/headlamp-k8s/headlamp/backend/pkg/helm"
 	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
 	"github.com/headlamp-k8s/headlamp/backend/pkg/plugins"
 	"github.com/headlamp-k8s/headlamp/backend/pkg/portforward"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/utils"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 
 	zlog "github.com/rs/zerolog/log"
+	"golang.org/x/net/netutil"
 	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 )
 
 type HeadlampConfig struct {
@@ -60,25 +66,148 @@ type HeadlampConfig struct {
 	proxyURLs             []string
 	cache                 cache.Cache[interface{}]
 	kubeConfigStore       kubeconfig.ContextStore
+	portForwardKeepAlive  time.Duration
+	userAgent             string
+	discoveryCacheTTL     time.Duration
+	adminAddr             string
+	portForwardBufferSize int
+	kubectlProxyPath      string
+	baseURLRedirectCode   int
+	redirectToBaseURL     bool
+	portForwardJitter     float64
+	errorPage             string
+	disablePluginWatch    bool
+	proxyMaxResponseSize  int64
+	shareSecret           []byte
+	shareTTL              time.Duration
+	portForwardAddress    string
+	enableTracing         bool
+	tracingEndpoint       string
+	maxLogStreams         int
+	logStreams            *streamLimiter
+	oidcDiscoveryTTL      time.Duration
+	oidcProviders         *oidcProviderCache
+	forbidInsecure        bool
+	upgradeIdleTimeout    time.Duration
+	readOnly              *readOnlyMode
+	crdCacheTTL           time.Duration
+	proxyRequestLog       string
+	metricsUsername       string
+	metricsPassword       string
+	metricsToken          string
+	inClusterOptions      kubeconfig.InClusterOptions
+	inflightRequests      *singleflight.Group
+	maxURLLength          int
+	logBufferLines        int
+	logBuffer             *logBuffer
+	clusterSetupRetry     time.Duration
+	methodOverride        bool
+	inClusterCARefresh    time.Duration
+	noAPIIndexFallback    bool
+	strippedHeaders       []string
+	oidcRequiredClaims    []string
+	enableErrorReports    bool
+	errorReportLimiter    *rate.Limiter
+	portForwardTimeout    time.Duration
+	extraCADir            string
+	ignoreClientAuth      bool
+	proxyRetries          uint
+	proxyRetryBackoff     time.Duration
+	maxWatches            int
+	watches               *streamLimiter
+	sessions              *sessionStore
+	cookieSecure          bool
+	cookieSameSite        string
+	cookieDomain          string
+	cookiePath            string
+	maxPlugins            int
+	portForwardGrace      time.Duration
+	oidcMaxLogins         int
+	oidcClockSkew         time.Duration
+	enableTLSInfo         bool
+	portForwardSetups     int
+	portForwardQueueWait  time.Duration
+	portForwardQueue      *portforward.SetupQueue
+	oidcAuthPath          string
+	dnsCacheTTL           time.Duration
+	accessLogFormat       string
+	accessLogFile         string
+	maxConnections        int
+	filterClustersByGroup bool
+	headlessRoot          string
+	proxyMaxConnsPerHost  int
+	proxyMaxIdleConns     int
+	proxyNoKeepAlives     bool
+	lazyProxySetup        bool
+	keepProxyBaseURL      bool
+	maxPluginListSize     int
+	// gunzipExternalProxy makes the external proxy send gzip responses
+	// decompressed instead of passing them through.
+	gunzipExternalProxy bool
+	// corsAllowedOrigins are the origins allowed to make cross-origin requests
+	// outside dev mode, which allows any.
+	corsAllowedOrigins []string
+	// router is the main router, once set up, whose routes /debug/routes lists.
+	router *mux.Router
+	// accessLog is where access logs are written, accessLogFile once opened.
+	accessLog io.Writer
+	// proxyOrigins are "<glob>=<origin>" entries setting the Origin sent to
+	// external proxy URLs matching the glob, see setProxyOrigin.
+	proxyOrigins []string
+	// RegisterRoutes, if set, is called with the router once the built-in
+	// routes are added, so programs embedding Headlamp can add their own.
+	// Routes match in the order they are added, so a built-in route wins over
+	// a custom one matching the same request. The frontend catch-all is added
+	// after it, so custom routes win over it.
+	RegisterRoutes func(r *mux.Router)
+	// ClusterTransport, if set, returns the transport requests to a cluster are
+	// proxied with, eg. to inject credentials or to mock clusters in tests. It
+	// replaces the transport built from the kubeconfig, TLS settings and
+	// credentials included. Returning nil uses the built one.
+	ClusterTransport func(cluster *Cluster) http.RoundTripper
 }
 
 const DrainNodeCacheTTL = 20 // seconds
 
+const ProxyNotReadyRetryAfter = 1 // seconds
+
 const isWindows = runtime.GOOS == "windows"
 
+// defaultOidcAuthPath is the frontend route OIDC logins redirect to.
+const defaultOidcAuthPath = "auth"
+
 const ContextCacheTTL = 5 * time.Minute // minutes
 
+// maxWildcardContexts is the maximum number of contexts built from wildcard
+// contexts kept in the store. Clusters matched past it are not kept.
+const maxWildcardContexts = 100
+
 const ContextUpdateChacheTTL = 20 * time.Second // seconds
 
 type clientConfig struct {
 	Clusters                []Cluster `json:"clusters"`
 	IsDyanmicClusterEnabled bool      `json:"isDynamicClusterEnabled"`
+	ReadOnly                bool      `json:"readOnly"`
+	// BaseURL is the base path the frontend is served from, as set in the
+	// index, for client-side routing.
+	BaseURL string `json:"baseURL"`
 }
 
 type spaHandler struct {
 	staticPath string
 	indexPath  string
 	baseURL    string
+	errorPage  string
+	// apiPrefixes are paths, eg. "/clusters", below which missing files are
+	// not found instead of served the index, as they are not frontend routes.
+	apiPrefixes []string
+}
+
+// apiPathPrefixes are the prefixes of the backend endpoints, which unknown
+// paths get a 404 for if the index fallback is disabled for API paths.
+var apiPathPrefixes = []string{
+	"/clusters", "/cluster", "/portforward", "/plugins", "/static-plugins", "/externalproxy",
+	"/drain-node", "/drain-node-status", "/debug", "/telemetry", "/admin", "/plugin-manifest", "/contexts", "/schema",
 }
 
 type OauthConfig struct {
@@ -88,6 +217,12 @@ type OauthConfig struct {
 }
 
 func (h spaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// HEAD requests get the headers a GET would, without a body, including for
+	// the not found and error responses written here.
+	if r.Method == http.MethodHead {
+		w = headResponseWriter{w}
+	}
+
 	// Clean the path to prevent directory traversal
 	path := filepath.Clean(r.URL.Path)
 	path = strings.TrimPrefix(path, h.baseURL)
@@ -98,13 +233,18 @@ func (h spaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// check whether a file exists at the given path
 	_, err := os.Stat(path)
 	if os.IsNotExist(err) {
+		if h.isAPIPath(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+
 		// file does not exist, serve index.html
 		http.ServeFile(w, r, filepath.Join(h.staticPath, h.indexPath))
 		return
 	} else if err != nil {
 		// if we got an error (that wasn't that the file doesn't exist) stating the
 		// file, return a 500 internal server error and stop
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.serveError(w, err)
 		return
 	}
 
@@ -112,6 +252,50 @@ func (h spaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, path)
 }
 
+// headResponseWriter drops the body written to it, for responses to HEAD requests.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// isAPIPath returns true if the path is one of the API prefixes or below one.
+func (h spaHandler) isAPIPath(urlPath string) bool {
+	urlPath = strings.TrimPrefix(path.Clean(urlPath), h.baseURL)
+
+	for _, prefix := range h.apiPrefixes {
+		if urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serveError writes a 500 internal server error, using the custom error page
+// if one is configured and falling back to plain text otherwise.
+func (h spaHandler) serveError(w http.ResponseWriter, err error) {
+	if h.errorPage != "" {
+		page, readErr := os.ReadFile(h.errorPage)
+		if readErr == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+
+			if _, err := w.Write(page); err != nil {
+				log.Println("Error writing error page", err)
+			}
+
+			return
+		}
+
+		log.Printf("Error reading error page %s: %s", h.errorPage, readErr)
+	}
+
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
 // returns True if a file exists.
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
@@ -147,13 +331,10 @@ func baseURLReplace(staticDir string, baseURL string) {
 	indexBaseURL := path.Join(staticDir, "index.baseUrl.html")
 	index := path.Join(staticDir, "index.html")
 
-	replaceURL := baseURL
-	if baseURL == "" {
-		// We have to do the replace when baseURL == "" because of the case when
-		//   someone first does a different baseURL. If we didn't it would stay stuck
-		//   on that previous baseURL.
-		replaceURL = "/"
-	}
+	// We have to do the replace when baseURL == "" because of the case when
+	//   someone first does a different baseURL. If we didn't it would stay stuck
+	//   on that previous baseURL.
+	replaceURL := frontendBaseURL(baseURL)
 
 	if !fileExists(indexBaseURL) {
 		copyReplace(index, indexBaseURL, []byte(""), []byte(""), []byte(""), []byte(""))
@@ -167,6 +348,39 @@ func baseURLReplace(staticDir string, baseURL string) {
 		[]byte("headlampBaseUrl=\""+replaceURL+"\""))
 }
 
+// frontendBaseURL returns the base URL the frontend is told about: the base
+// URL, or "/" if there is none.
+func frontendBaseURL(baseURL string) string {
+	if baseURL == "" {
+		return "/"
+	}
+
+	return baseURL
+}
+
+// oidcAuthRedirectURL returns the frontend URL a successful OIDC login redirects
+// to, which gets the cluster and token in its query.
+func (c *HeadlampConfig) oidcAuthRedirectURL(cluster, rawIDToken string) string {
+	var redirectURL string
+	if c.devMode {
+		redirectURL = "http://localhost:3000/"
+	} else {
+		redirectURL = "/"
+	}
+
+	baseURL := strings.Trim(c.baseURL, "/")
+	if baseURL != "" {
+		redirectURL += baseURL + "/"
+	}
+
+	authPath := strings.Trim(c.oidcAuthPath, "/")
+	if authPath == "" {
+		authPath = defaultOidcAuthPath
+	}
+
+	return redirectURL + fmt.Sprintf("%s?cluster=%s&token=%s", authPath, url.QueryEscape(cluster), rawIDToken)
+}
+
 func getOidcCallbackURL(r *http.Request, config *HeadlampConfig) string {
 	urlScheme := r.URL.Scheme
 	if urlScheme == "" {
@@ -242,18 +456,27 @@ func defaultKubeConfigPersistenceFile() (string, error) {
 
 // addPluginRoutes adds plugin routes to a router.
 // It serves plugin list base paths as json at “/plugins”.
+// It serves the found plugins, with whether they are loaded, as json at “/plugin-manifest”.
+// Both lists are paged with “?limit=” and “?offset=”.
 // It serves plugin static files at “/plugins/” and “/static-plugins/”.
 // It disables caching and reloads plugin list base paths if not in-cluster.
 func addPluginRoutes(config *HeadlampConfig, r *mux.Router) {
 	r.HandleFunc("/plugins", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
 		pluginsList, err := config.cache.Get(context.Background(), plugins.PluginListKey)
-		if err != nil && err == cache.ErrNotFound {
-			pluginsList = []string{}
+		if err != nil && err != cache.ErrNotFound {
+			log.Println("Error getting plugins base paths list", err)
 		}
-		if err := json.NewEncoder(w).Encode(pluginsList); err != nil {
-			log.Println("Error encoding plugins base paths list", err)
+		pluginPaths, _ := pluginsList.([]string)
+		writePluginPage(w, r, pluginPaths, config.maxPluginListSize)
+	}).Methods("GET")
+
+	r.HandleFunc("/plugin-manifest", func(w http.ResponseWriter, r *http.Request) {
+		manifest, err := config.cache.Get(context.Background(), plugins.PluginManifestKey)
+		if err != nil && err != cache.ErrNotFound {
+			log.Println("Error getting plugin manifest", err)
 		}
+		pluginStatuses, _ := manifest.([]plugins.PluginStatus)
+		writePluginPage(w, r, pluginStatuses, config.maxPluginListSize)
 	}).Methods("GET")
 
 	// Serve plugins
@@ -273,6 +496,13 @@ func addPluginRoutes(config *HeadlampConfig, r *mux.Router) {
 	}
 }
 
+// watchPlugins returns true if the plugin directory should be watched for changes.
+// In-cluster mode is unlikely to want reloading plugins, and on some network
+// filesystems watching does not work, so it can be disabled.
+func (c *HeadlampConfig) watchPlugins() bool {
+	return !c.useInCluster && !c.disablePluginWatch
+}
+
 //nolint:gocognit,funlen,gocyclo
 func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 	kubeConfigPath := config.kubeConfigPath
@@ -285,13 +515,22 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 	log.Printf("Helm support: %v\n", config.enableHelm)
 	log.Printf("Proxy URLs: %+v\n", config.proxyURLs)
 
+	plugins.SetMaxPlugins(config.maxPlugins)
 	plugins.PopulatePluginsCache(config.baseURL, config.staticPluginDir, config.pluginDir, config.cache)
 
-	if !config.useInCluster {
-		// in-cluster mode is unlikely to want reloading plugins.
+	if config.watchPlugins() {
 		pluginEventChan := make(chan string)
 		go plugins.Watch(config.pluginDir, pluginEventChan)
 		go plugins.HandlePluginEvents(config.baseURL, config.staticPluginDir, config.pluginDir, pluginEventChan, config.cache)
+	} else if config.disablePluginWatch {
+		log.Println("Plugin watcher is disabled")
+	}
+
+	if config.extraCADir != "" {
+		go kubeconfig.WatchExtraCADir(config.kubeConfigStore, config.extraCADir)
+	}
+
+	if !config.useInCluster {
 		// in-cluster mode is unlikely to want reloading kubeconfig.
 		go kubeconfig.LoadAndWatchFiles(config.kubeConfigStore, kubeConfigPath, kubeconfig.KubeConfig)
 	}
@@ -300,37 +539,61 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 	if config.useInCluster {
 		context, err := kubeconfig.GetInClusterContext(config.oidcIdpIssuerURL,
 			config.oidcClientID, config.oidcClientSecret,
-			strings.Join(config.oidcScopes, ","))
+			strings.Join(config.oidcScopes, ","), config.inClusterOptions)
 		if err != nil {
 			log.Println("Failed to get in-cluster config", err)
 		}
 
 		context.Source = kubeconfig.InCluster
 
+		// The context is stored first, so its proxy is set up with the options of the store.
+		err = config.kubeConfigStore.AddContext(context)
+		if err != nil {
+			log.Println("Failed to add in-cluster context", err)
+		}
+
 		err = context.SetupProxy()
 		if err != nil {
 			log.Println("Failed to setup proxy for in-cluster context", err)
 		}
 
-		err = config.kubeConfigStore.AddContext(context)
-		if err != nil {
-			log.Println("Failed to add in-cluster context", err)
+		if config.inClusterCARefresh > 0 {
+			go reloadCAPeriodically(context, config.inClusterCARefresh)
 		}
 	}
 
+	if config.staticDir != "" && !fileExists(filepath.Join(config.staticDir, "index.html")) {
+		log.Printf("Warning: static dir %q has no index.html, serving the API only, without the frontend",
+			config.staticDir)
+
+		config.staticDir = ""
+	}
+
 	if config.staticDir != "" {
 		baseURLReplace(config.staticDir, config.baseURL)
 	}
 
 	// For when using a base-url, like "/headlamp" with a reverse proxy.
+	// Routes are matched on the escaped path, so escaped slashes in cluster names,
+	// eg. "arn:aws:eks:region:account:cluster%2Fname", don't split path segments.
 	var r *mux.Router
 	if config.baseURL == "" {
-		r = mux.NewRouter()
+		r = mux.NewRouter().UseEncodedPath()
 	} else {
-		baseRoute := mux.NewRouter()
+		baseRoute := mux.NewRouter().UseEncodedPath()
 		r = baseRoute.PathPrefix(config.baseURL).Subrouter()
 	}
 
+	config.router = r
+
+	r.Use(unescapeRouteVars)
+	r.Use(config.restrictSharedSessions)
+	r.Use(config.rejectRevokedSessions)
+
+	if config.enableTracing {
+		r.Use(tracingMiddleware)
+	}
+
 	fmt.Println("*** Headlamp Server ***")
 	fmt.Println("  API Routers:")
 
@@ -353,9 +616,39 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 
 	addPluginRoutes(config, r)
 
+	if config.oidcProviders == nil {
+		config.oidcProviders = newOidcProviderCache(config.oidcDiscoveryTTL, config.kubeConfigStore.Options())
+	}
+
+	if config.portForwardSetups > 0 {
+		config.portForwardQueue = portforward.NewSetupQueue(config.portForwardSetups, config.portForwardQueueWait)
+	}
+
+	if config.maxLogStreams > 0 {
+		config.logStreams = newStreamLimiter(config.maxLogStreams)
+	}
+
+	if config.readOnly == nil {
+		config.readOnly = newReadOnlyMode(false)
+	}
+
+	if config.watches == nil {
+		config.watches = newStreamLimiter(config.maxWatches)
+	}
+
+	if config.sessions == nil {
+		config.sessions = newSessionStore()
+	}
+
+	if config.inflightRequests == nil {
+		config.inflightRequests = &singleflight.Group{}
+	}
+
 	config.handleClusterRequests(r)
 
 	r.HandleFunc("/externalproxy", func(w http.ResponseWriter, r *http.Request) {
+		w = config.stripResponseHeaders(w)
+
 		proxyURL := r.Header.Get("proxy-to")
 		if proxyURL == "" && r.Header.Get("Forward-to") != "" {
 			proxyURL = r.Header.Get("Forward-to")
@@ -377,22 +670,14 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 			http.Error(w, fmt.Sprintf("The provided proxy URL is invalid: %v", err), http.StatusBadRequest)
 			return
 		}
-		isURLContainedInProxyURLs := false
-		for _, proxyURL := range config.proxyURLs {
-			g := glob.MustCompile(proxyURL)
-			if g.Match(url.String()) {
-				isURLContainedInProxyURLs = true
-				break
-			}
-		}
-		if !isURLContainedInProxyURLs {
+		if !isProxyURLAllowed(config.proxyURLs, url) {
 			zlog.Error().Err(err).Str("action", "externalproxy").Msg("no allowed proxy url match, request denied")
 			http.Error(w, "no allowed proxy url match, request denied ", http.StatusBadRequest)
 			return
 		}
 
-		ctx := context.Background()
-		proxyReq, err := http.NewRequestWithContext(ctx, r.Method, proxyURL, r.Body)
+		// The upstream request is cancelled when the client goes away.
+		proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, proxyURL, r.Body)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -403,30 +688,57 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 			proxyReq.Header[h] = val
 		}
 
+		// Clients can't smuggle in credentials when client auth is ignored.
+		if config.ignoreClientAuth {
+			proxyReq.Header.Del("Authorization")
+		}
+
+		setProxyOrigin(proxyReq.Header, config.proxyOrigins, url.String())
+
 		// Disable caching
 		w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
 		w.Header().Set("Expires", time.Unix(0, 0).Format(http.TimeFormat))
 		w.Header().Set("Pragma", "no-cache")
 		w.Header().Set("X-Accel-Expires", "0")
 
-		client := http.Client{}
+		client := externalProxyClient(config.kubeConfigStore.Options().DefaultTransport(), config.proxyURLs)
+
 		resp, err := client.Do(proxyReq)
 		if err != nil {
+			if errors.Is(err, errRedirectNotAllowed) {
+				zlog.Error().Err(err).Str("action", "externalproxy").Msg("redirect denied")
+			}
 			http.Error(w, err.Error(), http.StatusBadGateway)
 			return
 		}
 		defer resp.Body.Close()
 
-		// Check that the server actually sent compressed data
+		dropDisallowedLocation(resp, config.proxyURLs)
+
+		// gRPC-Web needs its headers and trailers, and has its own framing.
+		if isGRPCWeb(resp) {
+			if err := copyGRPCWebResponse(w, resp); err != nil {
+				zlog.Error().Err(err).Str("action", "externalproxy").Msg("copying gRPC-Web response")
+			}
+
+			return
+		}
+
+		// Compressed responses are passed through with their encoding, unless
+		// decompressing them is enabled for clients which mishandle gzip.
 		var reader io.ReadCloser
-		switch resp.Header.Get("Content-Encoding") {
-		case "gzip":
+		switch encoding := resp.Header.Get("Content-Encoding"); {
+		case encoding == "gzip" && config.gunzipExternalProxy:
 			reader, err = gzip.NewReader(resp.Body)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 			defer reader.Close()
+		case encoding != "":
+			w.Header().Set("Content-Encoding", encoding)
+
+			reader = resp.Body
 		default:
 			reader = resp.Body
 		}
@@ -446,20 +758,46 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 	// Configuration
 	r.HandleFunc("/config", config.getConfig).Methods("GET")
 
+	// Contexts of the kubeconfig files, including the ones not proxied to
+	r.HandleFunc("/contexts", requireBackendToken(config.handleListContexts)).Methods("GET")
+
+	// JSON Schema of the request and response types, as API documentation
+	r.HandleFunc("/schema", handleSchema).Methods("GET")
+
+	// Identity of the request, to help debugging access issues
+	r.HandleFunc("/whoami", handleWhoami).Methods("GET")
+
+	// Errors reported by the frontend
+	if config.enableErrorReports {
+		if config.errorReportLimiter == nil {
+			config.errorReportLimiter = newErrorReportLimiter()
+		}
+
+		r.HandleFunc("/telemetry/error", config.handleErrorReport).Methods("POST")
+	}
+
+	// Read-only share links
+	if len(config.shareSecret) == 0 {
+		config.shareSecret = newShareSecret()
+	}
+
+	config.addShareRoutes(r)
+
 	config.addClusterSetupRoute(r)
 
-	oauthRequestMap := make(map[string]*OauthConfig)
+	// Health, metrics and debug endpoints go on the admin listener if there is one.
+	if config.adminAddr == "" {
+		config.addAdminRoutes(r, false)
+	}
+
+	oidcLogins := newOidcLoginStore(config.oidcMaxLogins, oidcLoginTTL)
 
 	r.HandleFunc("/oidc", func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.Background()
+		r, span := config.startSpan(r, "oidc.login")
+		defer span.End()
+
+		ctx := oidcClientContext(context.Background(), config.kubeConfigStore.Options(), config.insecure)
 		cluster := r.URL.Query().Get("cluster")
-		if config.insecure {
-			tr := &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
-			}
-			insecureClient := &http.Client{Transport: tr}
-			ctx = oidc.ClientContext(ctx, insecureClient)
-		}
 
 		kContext, err := config.kubeConfigStore.GetContext(cluster)
 		if err != nil {
@@ -474,15 +812,17 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		provider, err := oidc.NewProvider(ctx, oidcAuthConfig.IdpIssuerURL)
+		provider, err := config.oidcProviders.get(oidcAuthConfig.IdpIssuerURL, config.insecure)
 		if err != nil {
 			log.Printf("Error while fetching the provider from %s error %s", oidcAuthConfig.IdpIssuerURL, err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		// verifyIDToken checks the expiry, allowing for clock skew.
 		oidcConfig := &oidc.Config{
-			ClientID: oidcAuthConfig.ClientID,
+			ClientID:        oidcAuthConfig.ClientID,
+			SkipExpiryCheck: true,
 		}
 
 		verifier := provider.Verifier(oidcConfig)
@@ -493,19 +833,38 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 			RedirectURL:  getOidcCallbackURL(r, config),
 			Scopes:       append([]string{oidc.ScopeOpenID}, oidcAuthConfig.Scopes...),
 		}
-		/* we encode the cluster to base64 and set it as state so that when getting redirected
-		by oidc we can use this state value to get cluster name
-		*/
-		state := base64.StdEncoding.EncodeToString([]byte(cluster))
-		oauthRequestMap[state] = &OauthConfig{Config: oauthConfig, Verifier: verifier, Ctx: ctx}
+		// The callback gets the cluster from the login of the state.
+		state, err := newOidcState()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = oidcLogins.add(state, cluster, &OauthConfig{Config: oauthConfig, Verifier: verifier, Ctx: ctx})
+		if err != nil {
+			log.Printf("Error starting OIDC login to cluster %s: %s", cluster, err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
 		http.Redirect(w, r, oauthConfig.AuthCodeURL(state), http.StatusFound)
 	}).Queries("cluster", "{cluster}")
 
 	r.HandleFunc("/portforward", func(w http.ResponseWriter, r *http.Request) {
-		portforward.StartPortForward(config.kubeConfigStore, config.cache, w, r)
+		r, span := config.startSpan(r, "portforward.start")
+		defer span.End()
+
+		if !config.checkReadOnly(w) {
+			return
+		}
+
+		portforward.StartPortForward(config.kubeConfigStore, config.cache, config.portForwardConfig(), w, r)
 	}).Methods("POST")
 
 	r.HandleFunc("/portforward", func(w http.ResponseWriter, r *http.Request) {
+		r, span := config.startSpan(r, "portforward.stop")
+		defer span.End()
+
 		portforward.StopOrDeletePortForward(config.cache, w, r)
 	}).Methods("DELETE")
 
@@ -513,6 +872,22 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 		portforward.GetPortForwards(config.cache, w, r)
 	})
 
+	r.HandleFunc("/portforward/logs", func(w http.ResponseWriter, r *http.Request) {
+		portforward.GetPortForwardLogs(config.cache, w, r)
+	}).Methods("GET")
+
+	r.HandleFunc("/portforward/summary", func(w http.ResponseWriter, r *http.Request) {
+		portforward.GetPortForwardSummary(config.cache, w, r)
+	}).Methods("GET")
+
+	r.HandleFunc("/portforward/status", func(w http.ResponseWriter, r *http.Request) {
+		portforward.GetPortForwardStatus(config.cache, config.portForwardConfig(), w, r)
+	}).Methods("GET")
+
+	r.HandleFunc("/portforward/check", func(w http.ResponseWriter, r *http.Request) {
+		portforward.CheckPortForward(config.kubeConfigStore, config.portForwardConfig(), w, r)
+	}).Methods("GET")
+
 	r.HandleFunc("/drain-node", config.handleNodeDrain).Methods("POST")
 	r.HandleFunc("/drain-node-status",
 		config.handleNodeDrainStatus).Methods("GET").Queries("cluster", "{cluster}", "nodeName", "{node}")
@@ -521,17 +896,18 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 	}).Methods("GET")
 
 	r.HandleFunc("/oidc-callback", func(w http.ResponseWriter, r *http.Request) {
+		r, span := config.startSpan(r, "oidc.callback")
+		defer span.End()
+
 		state := r.URL.Query().Get("state")
-		decodedState, err := base64.StdEncoding.DecodeString(state)
-		if err != nil {
-			http.Error(w, "wrong state set, invalid request "+err.Error(), http.StatusBadRequest)
-		}
 		if state == "" {
 			http.Error(w, "invalid request state is empty", http.StatusBadRequest)
 			return
 		}
 		//nolint:nestif
-		if oauthConfig, ok := oauthRequestMap[state]; ok {
+		if login, ok := oidcLogins.take(state); ok {
+			cluster, oauthConfig := login.cluster, login.config
+
 			oauth2Token, err := oauthConfig.Config.Exchange(oauthConfig.Ctx, r.URL.Query().Get("code"))
 			if err != nil {
 				http.Error(w, "Failed to exchange token: "+err.Error(), http.StatusInternalServerError)
@@ -544,16 +920,25 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 				return
 			}
 
+			idToken, err := verifyIDToken(oauthConfig.Ctx, oauthConfig.Verifier, rawIDToken,
+				oauthConfig.Config.ClientID, config.oidcRequiredClaims, config.oidcClockSkew)
+			if err != nil {
+				http.Error(w, "Failed to verify ID Token: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+
 			if err := config.cache.Set(context.Background(),
 				fmt.Sprintf("oidc-token-%s", rawIDToken), oauth2Token.RefreshToken); err != nil {
 				http.Error(w, "Failed to cache refresh token: "+err.Error(), http.StatusInternalServerError)
 				return
 			}
-			idToken, err := oauthConfig.Verifier.Verify(oauthConfig.Ctx, rawIDToken)
-			if err != nil {
-				http.Error(w, "Failed to verify ID Token: "+err.Error(), http.StatusInternalServerError)
+			var claims map[string]interface{}
+			if err := idToken.Claims(&claims); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+
+			config.sessions.add(idToken.Subject, cluster, rawIDToken, claimStrings(claims, "groups"))
 			resp := struct {
 				OAuth2Token   *oauth2.Token
 				IDTokenClaims *json.RawMessage // ID Token payload is just JSON.
@@ -564,26 +949,17 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 				return
 			}
 
-			var redirectURL string
-			if config.devMode {
-				redirectURL = "http://localhost:3000/"
-			} else {
-				redirectURL = "/"
-			}
-
-			baseURL := strings.Trim(config.baseURL, "/")
-			if baseURL != "" {
-				redirectURL += baseURL + "/"
-			}
-
-			redirectURL += fmt.Sprintf("auth?cluster=%1s&token=%2s", decodedState, rawIDToken)
-			http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+			http.Redirect(w, r, config.oidcAuthRedirectURL(cluster, rawIDToken), http.StatusSeeOther)
 		} else {
 			http.Error(w, "invalid request", http.StatusBadRequest)
 			return
 		}
 	})
 
+	if config.RegisterRoutes != nil {
+		config.RegisterRoutes(r)
+	}
+
 	// Serve the frontend if needed
 	if config.staticDir != "" {
 		staticPath := config.staticDir
@@ -595,26 +971,99 @@ func createHeadlampHandler(config *HeadlampConfig) http.Handler {
 			}
 		}
 
-		spa := spaHandler{staticPath: staticPath, indexPath: "index.html", baseURL: config.baseURL}
+		spa := spaHandler{
+			staticPath: staticPath,
+			indexPath:  "index.html",
+			baseURL:    config.baseURL,
+			errorPage:  config.errorPage,
+		}
+
+		if config.noAPIIndexFallback {
+			spa.apiPrefixes = apiPathPrefixes
+			if config.kubectlProxyPath != "" {
+				spa.apiPrefixes = append([]string{config.kubectlProxyPath}, apiPathPrefixes...)
+			}
+		}
+
 		r.PathPrefix("/").Handler(spa)
 
 		http.Handle("/", r)
+	} else {
+		config.addHeadlessRootRoute(r)
 	}
 
-	// On dev mode we're loose about where connections come from
-	if config.devMode {
-		headers := handlers.AllowedHeaders([]string{
-			"X-HEADLAMP_BACKEND-TOKEN", "X-Requested-With", "Content-Type",
-			"Authorization", "Forward-To",
-			"KUBECONFIG", "X-HEADLAMP-USER-ID",
-		})
-		methods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "HEAD", "DELETE", "PATCH", "OPTIONS"})
-		origins := handlers.AllowedOrigins([]string{"*"})
+	var handler http.Handler = r
+
+	if config.methodOverride {
+		handler = methodOverride(handler)
+	}
 
-		return handlers.CORS(headers, methods, origins)(r)
+	if origins := config.corsOrigins(); len(origins) > 0 {
+		handler = corsHandler(handler, origins)
 	}
 
-	return r
+	return config.logAccess(baseURLRedirect(handler, config.baseURL, config.baseURLRedirectCode,
+		config.redirectToBaseURL))
+}
+
+// MethodOverrideHeader carries the intended method of a POST request, for
+// clients behind proxies which block other methods.
+const MethodOverrideHeader = "X-HTTP-Method-Override"
+
+// overridableMethods are the methods a POST can be overridden with.
+var overridableMethods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// methodOverride changes the method of POST requests to the one of their
+// MethodOverrideHeader, if it is one of the overridable methods, before they
+// are routed.
+func methodOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		override := strings.ToUpper(r.Header.Get(MethodOverrideHeader))
+
+		if r.Method == http.MethodPost && override != "" {
+			if !utils.Contains(overridableMethods, override) {
+				http.Error(w, "method override is not allowed", http.StatusBadRequest)
+				return
+			}
+
+			r.Method = override
+			r.Header.Del(MethodOverrideHeader)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// baseURLRedirect redirects requests to the base URL without a trailing slash
+// to "{baseURL}/", so relative asset paths resolve, and if outside is set the
+// requests outside of the base URL to the same path under it. Otherwise they
+// are left to next, which doesn't find them. A 308 code keeps the method and body.
+func baseURLRedirect(next http.Handler, baseURL string, code int, outside bool) http.Handler {
+	if baseURL == "" {
+		return next
+	}
+
+	if code == 0 {
+		code = http.StatusFound
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, baseURL+"/") || (!outside && r.URL.Path != baseURL) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		target := baseURL + "/"
+		if r.URL.Path != baseURL {
+			target = baseURL + "/" + strings.TrimPrefix(r.URL.Path, "/")
+		}
+
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+
+		http.Redirect(w, r, target, code)
+	})
 }
 
 func parseClusterAndToken(r *http.Request) (string, string) {
@@ -624,7 +1073,7 @@ func parseClusterAndToken(r *http.Request) (string, string) {
 
 	matches := re.FindStringSubmatch(urlString)
 	if len(matches) > 1 {
-		cluster = matches[1]
+		cluster = unescapePathSegment(matches[1])
 	}
 
 	// get token
@@ -634,6 +1083,25 @@ func parseClusterAndToken(r *http.Request) (string, string) {
 	return cluster, token
 }
 
+// reloadCAPeriodically reloads the CA of the context every interval, so the
+// proxy keeps working once the CA file is rotated.
+func reloadCAPeriodically(kContext *kubeconfig.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reloaded, err := kContext.ReloadCA()
+		if err != nil {
+			log.Printf("Error: reloading CA of context %q: %v", kContext.Name, err)
+			continue
+		}
+
+		if reloaded {
+			log.Printf("Reloaded CA of context %q", kContext.Name)
+		}
+	}
+}
+
 func isTokenAboutToExpire(token string) bool {
 	const TokenParts = 3
 
@@ -667,13 +1135,28 @@ func isTokenAboutToExpire(token string) bool {
 	return time.Until(expTime) <= time.Second*10
 }
 
+// oidcClientContext returns a context carrying the HTTP client used for
+// requests to the OIDC provider, with the transport and User-Agent of options.
+func oidcClientContext(ctx context.Context, options *kubeconfig.Options, insecure bool) context.Context {
+	tr := options.DefaultTransport()
+	if insecure {
+		tr = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+		}
+	}
+
+	return oidc.ClientContext(ctx, &http.Client{Transport: options.UserAgentRoundTripper(tr)})
+}
+
 func refreshAndCacheNewToken(oidcAuthConfig *kubeconfig.OidcConfig,
-	cache cache.Cache[interface{}], token string,
+	cache cache.Cache[interface{}], providers *oidcProviderCache, token string,
 ) (string, error) {
 	const ExtendRefreshTokenTTL = 10 // seconds
 
+	ctx := oidcClientContext(context.Background(), providers.options, false)
+
 	// get provider
-	provider, err := oidc.NewProvider(context.Background(), oidcAuthConfig.IdpIssuerURL)
+	provider, err := providers.get(oidcAuthConfig.IdpIssuerURL, false)
 	if err != nil {
 		return "", err
 	}
@@ -697,7 +1180,7 @@ func refreshAndCacheNewToken(oidcAuthConfig *kubeconfig.OidcConfig,
 	}
 
 	// get new token using refresh token
-	ts := oauth2Config.TokenSource(context.Background(), &oauth2.Token{
+	ts := oauth2Config.TokenSource(ctx, &oauth2.Token{
 		RefreshToken: rToken,
 	})
 
@@ -763,11 +1246,12 @@ func (c *HeadlampConfig) OIDCTokenRefreshMiddleware(next http.Handler) http.Hand
 		}
 
 		// refresh and cache new token
-		newToken, err := refreshAndCacheNewToken(oidcAuthConfig, c.cache, token)
+		newToken, err := refreshAndCacheNewToken(oidcAuthConfig, c.cache, c.oidcProviders, token)
 		if err != nil {
 			log.Printf("Error refreshing token %s", err)
 		}
 		if newToken != "" {
+			c.sessions.refreshed(token, newToken)
 			w.Header().Set("X-Authorization", newToken)
 		}
 		next.ServeHTTP(w, r)
@@ -775,18 +1259,58 @@ func (c *HeadlampConfig) OIDCTokenRefreshMiddleware(next http.Handler) http.Hand
 }
 
 func StartHeadlampServer(config *HeadlampConfig) {
+	if config.logBufferLines > 0 {
+		config.logBuffer = setupLogBuffer(config.logBufferLines)
+	}
+
+	if config.enableTracing {
+		shutdown, err := setupTracing(context.Background(), config.tracingEndpoint)
+		if err != nil {
+			log.Fatalf("Error setting up tracing: %v", err)
+		}
+
+		defer shutdown(context.Background()) //nolint:errcheck
+	}
+
 	handler := createHeadlampHandler(config)
 
 	handler = config.OIDCTokenRefreshMiddleware(handler)
 
+	if config.adminAddr != "" {
+		go func() {
+			log.Printf("Admin endpoints listening on %s\n", config.adminAddr)
+			log.Fatal(http.ListenAndServe(config.adminAddr, createAdminHandler(config))) //nolint:gosec
+		}()
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.port))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Start server
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", config.port), handler)) //nolint:gosec
+	log.Fatal(http.Serve(limitListener(listener, config.maxConnections), handler)) //nolint:gosec
+}
+
+// limitListener returns a listener accepting at most max connections at once,
+// further ones waiting until others are closed, or the listener if max is not
+// positive. Idle keep-alive connections count towards max.
+func limitListener(listener net.Listener, max int) net.Listener {
+	if max <= 0 {
+		return listener
+	}
+
+	return netutil.LimitListener(listener, max)
 }
 
 // Returns the helm.Handler given the config and request. Writes http.NotFound if clusterName is not there.
 func getHelmHandler(c *HeadlampConfig, w http.ResponseWriter, r *http.Request) (*helm.Handler, error) {
 	clusterName := mux.Vars(r)["clusterName"]
 
+	if isMutatingMethod(r.Method) && !c.checkReadOnly(w) {
+		return nil, errors.New("request not allowed in read-only mode")
+	}
+
 	context, err := c.kubeConfigStore.GetContext(clusterName)
 	if err != nil {
 		http.NotFound(w, r)
@@ -795,7 +1319,7 @@ func getHelmHandler(c *HeadlampConfig, w http.ResponseWriter, r *http.Request) (
 
 	namespace := r.URL.Query().Get("namespace")
 
-	helmHandler, err := helm.NewHandler(context.ClientConfig(), c.cache, namespace)
+	helmHandler, err := helm.NewHandler(context.RestrictedClientConfig(), c.cache, namespace)
 	if err != nil {
 		log.Printf("Error: failed to create helm handler: %s", err)
 		http.Error(w, "failed to create helm handler", http.StatusInternalServerError)
@@ -891,46 +1415,303 @@ func handleClusterHelm(c *HeadlampConfig, router *mux.Router) {
 	})
 }
 
+// unescapeRouteVars unescapes the route variables of requests, which are
+// matched on the escaped path.
+func unescapeRouteVars(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		for name, value := range vars {
+			vars[name] = unescapePathSegment(value)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unescapePathSegment unescapes a path segment, eg. a cluster name.
+// Invalid escapes are kept as is.
+func unescapePathSegment(segment string) string {
+	unescaped, err := url.PathUnescape(segment)
+	if err != nil {
+		return segment
+	}
+
+	return unescaped
+}
+
 // handleClusterAPI handles cluster API requests. It is responsible for
 // all the requests made to /clusters/{clusterName}/{api:.*} endpoint.
 // It parses the request and creates a proxy request to the cluster.
 // That proxy is saved in the cache with the context key.
 func handleClusterAPI(c *HeadlampConfig, router *mux.Router) {
-	router.PathPrefix("/clusters/{clusterName}/{api:.*}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		contextKey, err := c.getContextKeyForRequest(r)
-		if err != nil {
-			log.Printf("Error: failed to get context key: %s", err)
-			http.NotFound(w, r)
+	router.PathPrefix("/clusters/{clusterName}/{api:.*}").HandlerFunc(c.limitURLLength(c.proxyClusterAPI))
+
+	// Clients joining the base URL twice, eg. "/headlamp/headlamp/clusters/...",
+	// get the same cluster API instead of the frontend.
+	if c.baseURL != "" && !c.keepProxyBaseURL {
+		router.PathPrefix(c.baseURL + "/clusters/{clusterName}/{api:.*}").
+			HandlerFunc(c.limitURLLength(c.proxyClusterAPI))
+	}
+}
+
+// handleKubectlProxy serves each cluster's API at the root of
+// {kubectlProxyPath}/{clusterName}/, the way `kubectl proxy` does,
+// so existing tools can point at Headlamp.
+func handleKubectlProxy(c *HeadlampConfig, router *mux.Router) {
+	if c.kubectlProxyPath == "" {
+		return
+	}
+
+	prefix := "/" + strings.Trim(c.kubectlProxyPath, "/")
+	router.PathPrefix(prefix + "/{clusterName}/{api:.*}").HandlerFunc(c.limitURLLength(c.proxyClusterAPI))
+}
+
+// limitURLLength rejects requests whose URL (path and query) is longer than
+// the maximum URL length with a 414, before they are proxied.
+func (c *HeadlampConfig) limitURLLength(next http.HandlerFunc) http.HandlerFunc {
+	if c.maxURLLength <= 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.RequestURI()) > c.maxURLLength {
+			http.Error(w, http.StatusText(http.StatusRequestURITooLong), http.StatusRequestURITooLong)
 			return
 		}
 
-		kContext, err := c.kubeConfigStore.GetContext(contextKey)
-		if err != nil {
-			log.Printf("Error: failed to get context: %s", err)
-			http.NotFound(w, r)
+		next(w, r)
+	}
+}
+
+// stripBaseURL returns the API path without the base URL leaked into it, eg.
+// "/api/v1/pods" for "headlamp/api/v1/pods" with the base URL "/headlamp". The
+// base URL is only stripped when an API path follows it, so paths of clusters
+// that happen to start like the base URL are kept.
+func stripBaseURL(apiPath, baseURL string) string {
+	prefix := strings.Trim(baseURL, "/")
+	if prefix == "" {
+		return apiPath
+	}
+
+	for {
+		rest, found := strings.CutPrefix(strings.TrimPrefix(apiPath, "/"), prefix)
+		if !found || !isKubernetesAPIPath(rest) {
+			return apiPath
+		}
+
+		apiPath = rest
+	}
+}
+
+// isKubernetesAPIPath returns whether the path is below the core or group API
+// roots of Kubernetes, eg. "/api/v1" or "/apis/apps".
+func isKubernetesAPIPath(apiPath string) bool {
+	root, _, _ := strings.Cut(strings.TrimPrefix(apiPath, "/"), "/")
+
+	return strings.HasPrefix(apiPath, "/") && (root == "api" || root == "apis")
+}
+
+// proxyClusterAPI proxies a request to the cluster named by the "clusterName"
+// route variable, using the "api" route variable as the upstream path.
+func (c *HeadlampConfig) proxyClusterAPI(w http.ResponseWriter, r *http.Request) {
+	contextKey, err := c.getContextKeyForRequest(r)
+	if err != nil {
+		log.Printf("Error: failed to get context key: %s", err)
+		http.NotFound(w, r)
+		return
+	}
+
+	kContext, err := c.kubeConfigStore.GetContext(contextKey)
+	if err != nil {
+		kContext, err = c.getWildcardContext(contextKey)
+	}
+
+	if err != nil {
+		log.Printf("Error: failed to get context: %s", err)
+		http.NotFound(w, r)
+		return
+	}
+
+	clusterURL, err := url.Parse(kContext.Cluster.Server)
+	if err != nil {
+		log.Printf("Error: failed to parse cluster URL: %s", err)
+		http.NotFound(w, r)
+	}
+
+	r.Host = clusterURL.Host
+	r.Header.Set("X-Forwarded-Host", r.Header.Get("Host"))
+	r.URL.Host = clusterURL.Host
+	apiPath := mux.Vars(r)["api"]
+	if !c.keepProxyBaseURL {
+		apiPath = stripBaseURL(apiPath, c.baseURL)
+	}
+
+	r.URL.Path = kContext.NormalizeAPIPath(apiPath)
+	// The raw path is the one requested from Headlamp, with the base URL and cluster.
+	r.URL.RawPath = ""
+	r.URL.Scheme = clusterURL.Scheme
+
+	if !kContext.IsPathAllowed(r.URL.Path) {
+		http.Error(w, "path is not allowed for this cluster", http.StatusForbidden)
+		return
+	}
+
+	if !c.checkReadOnlyAPIRequest(w, r, r.URL.Path) {
+		return
+	}
+
+	if c.ignoresClientAuth(kContext) {
+		r.Header.Del("Authorization")
+	}
+
+	c.logProxyRequest(kContext, contextKey, r)
+
+	plugins.HandlePluginReload(c.cache, w)
+
+	c.injectTraceContext(r)
+
+	if c.logStreams != nil && isLogStreamRequest(r, r.URL.Path) {
+		if !c.logStreams.acquire(contextKey) {
+			http.Error(w, "too many concurrent log streams for this cluster", http.StatusTooManyRequests)
 			return
 		}
 
-		clusterURL, err := url.Parse(kContext.Cluster.Server)
-		if err != nil {
-			log.Printf("Error: failed to parse cluster URL: %s", err)
-			http.NotFound(w, r)
+		// The proxy returns once the stream ends or the client disconnects.
+		defer c.logStreams.release(contextKey)
+	}
+
+	if limit := c.watchLimit(kContext); limit > 0 && isWatchRequest(r) {
+		if !c.watches.acquireUpTo(contextKey, limit) {
+			http.Error(w, "too many concurrent watches for this cluster", http.StatusTooManyRequests)
+			return
 		}
 
-		r.Host = clusterURL.Host
-		r.Header.Set("X-Forwarded-Host", r.Header.Get("Host"))
-		r.URL.Host = clusterURL.Host
-		r.URL.Path = mux.Vars(r)["api"]
-		r.URL.Scheme = clusterURL.Scheme
+		defer c.watches.release(contextKey)
+	}
+
+	w = c.stripResponseHeaders(w)
 
-		plugins.HandlePluginReload(c.cache, w)
+	var discoveryKey string
 
+	var capture *responseCapture
+
+	if c.discoveryCacheTTL > 0 && isDiscoveryRequest(r, r.URL.Path) {
+		discoveryKey = discoveryCacheKey(contextKey, r, r.URL.Path)
+		if c.serveCachedDiscovery(w, r, discoveryKey) {
+			return
+		}
+
+		capture = &responseCapture{ResponseWriter: w}
+		w = capture
+	}
+
+	if c.upgradeIdleTimeout > 0 && r.Header.Get("Upgrade") != "" {
+		w = &idleTimeoutWriter{ResponseWriter: w, timeout: c.upgradeIdleTimeout, path: r.URL.Path}
+	}
+
+	var limited *limitedResponseWriter
+
+	if c.proxyMaxResponseSize > 0 && !isStreamingRequest(r) {
+		limited = &limitedResponseWriter{ResponseWriter: w, limit: c.proxyMaxResponseSize, path: r.URL.Path}
+		w = limited
+	}
+
+	if pageSize := listPageSize(r); pageSize > 0 {
+		err = proxyPagedList(kContext, w, r, pageSize, c.proxyMaxResponseSize)
+	} else if isCoalescableRequest(r, r.URL.Path) {
+		err = c.proxyCoalesced(kContext, w, r, discoveryCacheKey(contextKey, r, r.URL.Path))
+	} else {
 		err = kContext.ProxyRequest(w, r)
+	}
+
+	if capture != nil && err == nil && (limited == nil || !limited.exceeded) {
+		c.cacheDiscoveryResponse(discoveryKey, capture)
+	}
+
+	if errors.Is(err, kubeconfig.ErrProxyNotReady) {
+		w.Header().Set("Retry-After", strconv.Itoa(ProxyNotReadyRetryAfter))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error: failed to proxy request: %s", err)
+		http.Error(w, err.Error(), clusterErrorStatus(err))
+	}
+}
+
+// getWildcardContext returns a context for clusterName built from the wildcard
+// context whose name pattern matches it. Patterns are tried in name order.
+// The built context is stored under clusterName, so later requests match exactly,
+// unless maxWildcardContexts are stored already.
+func (c *HeadlampConfig) getWildcardContext(clusterName string) (*kubeconfig.Context, error) {
+	contexts, err := c.kubeConfigStore.GetContexts()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(contexts, func(i, j int) bool {
+		return contexts[i].Name < contexts[j].Name
+	})
+
+	for _, kContext := range contexts {
+		if !kubeconfig.IsWildcardName(kContext.Name) {
+			continue
+		}
+
+		g, err := glob.Compile(kContext.Name)
+		if err != nil || !g.Match(clusterName) {
+			continue
+		}
+
+		matched, err := kContext.ForClusterName(clusterName)
 		if err != nil {
-			log.Printf("Error: failed to proxy request: %s", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, err
 		}
-	})
+
+		// Any name matching a pattern builds a context, so only so many are kept.
+		if stored := countWildcardContexts(contexts); stored >= maxWildcardContexts {
+			log.Printf("Not keeping the context of cluster %q, there are %d already", clusterName, stored)
+			return matched, nil
+		}
+
+		if err := c.kubeConfigStore.AddContextWithKeyAndTTL(matched, clusterName, ContextCacheTTL); err != nil {
+			return nil, err
+		}
+
+		return matched, nil
+	}
+
+	return nil, fmt.Errorf("no context matches cluster %q", clusterName)
+}
+
+// countWildcardContexts returns the number of contexts built from wildcard contexts.
+func countWildcardContexts(contexts []*kubeconfig.Context) int {
+	count := 0
+
+	for _, kContext := range contexts {
+		if kContext.WildcardOf() != "" {
+			count++
+		}
+	}
+
+	return count
+}
+
+// portForwardConfig returns the settings used for new port forwards.
+func (c *HeadlampConfig) portForwardConfig() portforward.Config {
+	return portforward.Config{
+		KeepAliveInterval:       c.portForwardKeepAlive,
+		OutputBufferSize:        c.portForwardBufferSize,
+		AvailabilityCheckJitter: c.portForwardJitter,
+		Address:                 c.portForwardAddress,
+		SetupTimeout:            c.portForwardTimeout,
+		InCluster:               c.useInCluster,
+		PodRestartGrace:         c.portForwardGrace,
+		SetupQueue:              c.portForwardQueue,
+		IgnoreClientAuth:        c.ignoresClientAuth,
+	}
 }
 
 func (c *HeadlampConfig) handleClusterRequests(router *mux.Router) {
@@ -938,7 +1719,16 @@ func (c *HeadlampConfig) handleClusterRequests(router *mux.Router) {
 		handleClusterHelm(c, router)
 	}
 
+	router.HandleFunc("/clusters/{clusterName}/can-i", c.handleCanI).Methods("POST")
+	router.HandleFunc("/clusters/{clusterName}/crds", c.handleCRDs).Methods("GET")
+	router.HandleFunc("/clusters/{clusterName}/token-check", c.handleTokenCheck).Methods("POST")
+
+	if c.enableTLSInfo {
+		router.HandleFunc("/clusters/{clusterName}/tls-info", c.handleTLSInfo).Methods("GET")
+	}
+
 	handleClusterAPI(c, router)
+	handleKubectlProxy(c, router)
 }
 
 func (c *HeadlampConfig) getClusters() []Cluster {
@@ -958,20 +1748,78 @@ func (c *HeadlampConfig) getClusters() []Cluster {
 			continue
 		}
 
+		// Wildcard contexts are templates for other clusters.
+		if kubeconfig.IsWildcardName(context.Name) {
+			continue
+		}
+
 		clusters = append(clusters, Cluster{
-			Name:     context.Name,
-			Server:   context.Cluster.Server,
-			AuthType: context.AuthType(),
+			Name:       context.Name,
+			Server:     context.Cluster.Server,
+			AuthType:   context.AuthType(),
+			AuthMethod: context.AuthMethod(),
 			Metadata: map[string]interface{}{
 				"source":    context.SourceStr(),
 				"namespace": context.KubeContext.Namespace,
 			},
+			Status: context.Status(),
+			Error:  context.LastError(),
 		})
 	}
 
 	return clusters
 }
 
+// transportFactory returns the factory of the transports of cluster proxies
+// calling ClusterTransport, or nil if it is not set.
+func (c *HeadlampConfig) transportFactory() kubeconfig.TransportFactory {
+	if c.ClusterTransport == nil {
+		return nil
+	}
+
+	return func(kContext *kubeconfig.Context) http.RoundTripper {
+		return c.ClusterTransport(&Cluster{
+			Name:       kContext.Name,
+			Server:     kContext.Cluster.Server,
+			AuthType:   kContext.AuthType(),
+			AuthMethod: kContext.AuthMethod(),
+		})
+	}
+}
+
+// contextOptions returns the options of the contexts of the store of the
+// config, loading the extra certificate authorities if there are any.
+func (c *HeadlampConfig) contextOptions() *kubeconfig.Options {
+	options := &kubeconfig.Options{
+		UserAgent: c.userAgent,
+		RetryPolicy: kubeconfig.RetryPolicy{
+			Retries: int(c.proxyRetries),
+			Backoff: c.proxyRetryBackoff,
+		},
+		DNSCacheTTL: c.dnsCacheTTL,
+		TransportTuning: kubeconfig.TransportTuning{
+			MaxConnsPerHost:   c.proxyMaxConnsPerHost,
+			MaxIdleConns:      c.proxyMaxIdleConns,
+			DisableKeepAlives: c.proxyNoKeepAlives,
+		},
+		TransportFactory: c.transportFactory(),
+		LazyProxySetup:   c.lazyProxySetup,
+	}
+
+	if c.extraCADir != "" {
+		options.ExtraCAs = &kubeconfig.ExtraCAs{}
+
+		count, err := options.ExtraCAs.Load(c.extraCADir)
+		if err != nil {
+			log.Println("Error loading extra CAs:", err)
+		}
+
+		log.Printf("Loaded %d extra CA certificates from %s\n", count, c.extraCADir)
+	}
+
+	return options
+}
+
 // parseClusterFromKubeConfig parses the kubeconfig and returns a list of contexts and errors.
 func parseClusterFromKubeConfig(kubeConfigs []string) ([]Cluster, []error) {
 	clusters := []Cluster{}
@@ -1006,9 +1854,10 @@ func parseClusterFromKubeConfig(kubeConfigs []string) ([]Cluster, []error) {
 		for _, context := range contexts {
 			context := context
 			clusters = append(clusters, Cluster{
-				Name:     context.Name,
-				Server:   context.Cluster.Server,
-				AuthType: context.AuthType(),
+				Name:       context.Name,
+				Server:     context.Cluster.Server,
+				AuthType:   context.AuthType(),
+				AuthMethod: context.AuthMethod(),
 				Metadata: map[string]interface{}{
 					"source": "dynamic_cluster",
 				},
@@ -1025,13 +1874,35 @@ func parseClusterFromKubeConfig(kubeConfigs []string) ([]Cluster, []error) {
 }
 
 func (c *HeadlampConfig) getConfig(w http.ResponseWriter, r *http.Request) {
+	body, err := c.clientConfigJSON(r)
+	if err != nil {
+		log.Println("Error encoding config", err)
+		http.Error(w, "Error encoding config", http.StatusInternalServerError)
+
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 
-	clientConfig := clientConfig{c.getClusters(), c.enableDynamicClusters}
+	// The frontend polls the config, which seldom changes, eg. once clusters
+	// are added, removed or reloaded, which changes its ETag.
+	writeWithETag(w, r, body)
+}
 
-	if err := json.NewEncoder(w).Encode(&clientConfig); err != nil {
-		log.Println("Error encoding config", err)
+// clientConfigJSON returns the config sent to the frontend making the request.
+func (c *HeadlampConfig) clientConfigJSON(r *http.Request) ([]byte, error) {
+	readOnly := c.readOnly.isEnabled()
+	clusters := c.visibleClusters(c.getClusters(), c.verifiedIdentity(r))
+	clientConfig := clientConfig{
+		clusters, c.enableDynamicClusters && !readOnly, readOnly, frontendBaseURL(c.baseURL),
 	}
+
+	body, err := json.Marshal(&clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(body, '\n'), nil
 }
 
 //nolint:funlen,nestif
@@ -1040,6 +1911,10 @@ func (c *HeadlampConfig) addCluster(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !c.checkReadOnly(w) {
+		return
+	}
+
 	clusterReq := ClusterReq{}
 	if err := json.NewDecoder(r.Body).Decode(&clusterReq); err != nil {
 		http.Error(w, "Error decoding cluster info", http.StatusBadRequest)
@@ -1057,6 +1932,10 @@ func (c *HeadlampConfig) addCluster(w http.ResponseWriter, r *http.Request) {
 
 	var setupErrors []error
 
+	// With retries, proxies are set up once the contexts are stored, so failed
+	// setups can be retried on the stored contexts.
+	retrySetup := c.clusterSetupRetry > 0
+
 	if clusterReq.KubeConfig != nil {
 		kubeConfigByte, err := base64.StdEncoding.DecodeString(*clusterReq.KubeConfig)
 		if err != nil {
@@ -1070,6 +1949,11 @@ func (c *HeadlampConfig) addCluster(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if err := c.checkClustersTLS(config); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		kubeConfigPersistenceDir, err := defaultKubeConfigPersistenceDir()
 		if err != nil {
 			http.Error(w, "Error getting default kubeconfig persistence dir", http.StatusInternalServerError)
@@ -1081,7 +1965,8 @@ func (c *HeadlampConfig) addCluster(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		contexts, setupErrors = kubeconfig.LoadContextsFromAPIConfig(config, false)
+		contexts, setupErrors = kubeconfig.LoadContextsFromAPIConfigWithOptions(config, retrySetup,
+			c.kubeConfigStore.Options())
 	} else {
 		conf := &api.Config{
 			Clusters: map[string]*api.Cluster{
@@ -1098,7 +1983,13 @@ func (c *HeadlampConfig) addCluster(w http.ResponseWriter, r *http.Request) {
 			},
 		}
 
-		contexts, setupErrors = kubeconfig.LoadContextsFromAPIConfig(conf, false)
+		if err := c.checkClustersTLS(conf); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		contexts, setupErrors = kubeconfig.LoadContextsFromAPIConfigWithOptions(conf, retrySetup,
+			c.kubeConfigStore.Options())
 	}
 
 	if len(contexts) == 0 {
@@ -1113,18 +2004,56 @@ func (c *HeadlampConfig) addCluster(w http.ResponseWriter, r *http.Request) {
 		err := c.kubeConfigStore.AddContext(&context)
 		if err != nil {
 			setupErrors = append(setupErrors, err)
+			continue
+		}
+
+		if retrySetup {
+			c.setupProxyOrRetry(&context)
 		}
 	}
 
 	if len(setupErrors) > 0 {
 		log.Println("Error setting up contexts from kubeconfig", setupErrors)
-		http.Error(w, "Error setting up contexts from kubeconfig", http.StatusBadRequest)
+		http.Error(w, "Error setting up contexts from kubeconfig", addClusterErrorStatus(setupErrors))
 
 		return
 	}
 
+	body, err := c.clientConfigJSON(r)
+	if err != nil {
+		log.Println("Error encoding config", err)
+		http.Error(w, "Error encoding config", http.StatusInternalServerError)
+
+		return
+	}
+
+	// The created response is not conditional, so it has no ETag.
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	c.getConfig(w, r)
+
+	if _, err := w.Write(body); err != nil {
+		log.Println("Error writing response", err)
+	}
+}
+
+// checkClustersTLS returns an error if insecure clusters are forbidden and one of
+// the clusters skips TLS verification or has no certificate authority.
+func (c *HeadlampConfig) checkClustersTLS(conf *api.Config) error {
+	if !c.forbidInsecure {
+		return nil
+	}
+
+	for name, cluster := range conf.Clusters {
+		if cluster.InsecureSkipTLSVerify {
+			return fmt.Errorf("cluster %q skips TLS verification, which is forbidden", name)
+		}
+
+		if len(cluster.CertificateAuthorityData) == 0 && cluster.CertificateAuthority == "" {
+			return fmt.Errorf("cluster %q has no certificate authority, which is required", name)
+		}
+	}
+
+	return nil
 }
 
 func (c *HeadlampConfig) deleteCluster(w http.ResponseWriter, r *http.Request) {
@@ -1132,6 +2061,10 @@ func (c *HeadlampConfig) deleteCluster(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !c.checkReadOnly(w) {
+		return
+	}
+
 	name := mux.Vars(r)["name"]
 
 	err := c.kubeConfigStore.RemoveContext(name)
@@ -1180,6 +2113,10 @@ func (c *HeadlampConfig) addClusterSetupRoute(r *mux.Router) {
 This function is used to handle the node drain request.
 */
 func (c *HeadlampConfig) handleNodeDrain(w http.ResponseWriter, r *http.Request) {
+	if !c.checkReadOnly(w) {
+		return
+	}
+
 	var drainPayload struct {
 		Cluster  string `json:"cluster"`
 		NodeName string `json:"nodeName"`
@@ -1206,11 +2143,12 @@ func (c *HeadlampConfig) handleNodeDrain(w http.ResponseWriter, r *http.Request)
 	ctxtProxy, err := c.kubeConfigStore.GetContext(drainPayload.Cluster)
 	if err != nil {
 		http.Error(w, "Cluster not found", http.StatusNotFound)
+		return
 	}
 
-	clientset, err := ctxtProxy.ClientSetWithToken(token)
+	clientset, err := ctxtProxy.ClientSetWithToken(c.clientToken(ctxtProxy, token))
 	if err != nil {
-		http.Error(w, "Error getting client", http.StatusInternalServerError)
+		http.Error(w, "Error getting client", clusterErrorStatus(err))
 		return
 	}
 
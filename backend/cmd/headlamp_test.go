@@ -1,16 +1,24 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -20,6 +28,8 @@ import (
 	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd/api"
 )
 
 const (
@@ -97,6 +107,103 @@ func TestSpaHandlerOtherFiles(t *testing.T) {
 	}
 }
 
+// Does not serve the index.html for unknown API paths if asked not to.
+func TestSpaHandlerAPIPaths(t *testing.T) {
+	handler := spaHandler{
+		staticPath:  staticTestPath,
+		indexPath:   "index.html",
+		baseURL:     "/headlamp",
+		apiPrefixes: apiPathPrefixes,
+	}
+
+	for _, path := range []string{"/headlamp/clusters", "/headlamp/portforward/typo", "/headlamp/debug/nothing"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code, path)
+		assert.NotContains(t, rr.Body.String(), "The index.", path)
+	}
+
+	for _, path := range []string{"/headlamp/c/main/pods", "/headlamp/portforwards", "/headlamp/settings/clusters"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code, path)
+		assert.True(t, strings.HasPrefix(rr.Body.String(), "The index."), path)
+	}
+}
+
+// Serves the custom error page when stating a file fails.
+func TestSpaHandlerErrorPage(t *testing.T) {
+	// example.css is a file, so stating a path below it fails with ENOTDIR.
+	req, err := http.NewRequest("GET", "/headlamp/example.css/missing", nil) //nolint:noctx
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := spaHandler{
+		staticPath: staticTestPath,
+		indexPath:  "index.html",
+		baseURL:    "/headlamp",
+		errorPage:  "headlamp_testdata/error_page.html",
+	}
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Something went wrong.")
+	assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+
+	// Falls back to plain text if the error page is missing.
+	rr = httptest.NewRecorder()
+	handler.errorPage = "headlamp_testdata/no_such_page.html"
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "Something went wrong.")
+}
+
+// Answers HEAD requests with the headers of the file or index, without a body.
+func TestSpaHandlerHead(t *testing.T) {
+	handler := spaHandler{
+		staticPath:  staticTestPath,
+		indexPath:   "index.html",
+		baseURL:     "/headlamp",
+		apiPrefixes: apiPathPrefixes,
+		errorPage:   "headlamp_testdata/error_page.html",
+	}
+
+	tests := []struct {
+		path        string
+		file        string
+		code        int
+		contentType string
+	}{
+		{path: "/headlamp/example.css", file: "example.css", code: http.StatusOK, contentType: "text/css"},
+		{path: "/headlamp/c/main/pods", file: "index.html", code: http.StatusOK, contentType: "text/html"},
+		{path: "/headlamp/clusters/typo", code: http.StatusNotFound},
+		{path: "/headlamp/example.css/missing", code: http.StatusInternalServerError},
+	}
+
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodHead, tc.path, nil))
+
+		assert.Equal(t, tc.code, rr.Code, tc.path)
+		assert.Empty(t, rr.Body.String(), tc.path)
+
+		if tc.file == "" {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(staticTestPath, tc.file))
+		require.NoError(t, err)
+
+		assert.Equal(t, strconv.FormatInt(info.Size(), 10), rr.Header().Get("Content-Length"), tc.path)
+		assert.True(t, strings.HasPrefix(rr.Header().Get("Content-Type"), tc.contentType), tc.path)
+	}
+}
+
 func makeJSONReq(method, url string, jsonObj interface{}) (*http.Request, error) {
 	var jsonBytes []byte = nil
 
@@ -144,6 +251,56 @@ func getResponseFromRestrictedEndpoint(handler http.Handler, method, url string,
 	return rr, nil
 }
 
+// newTestCluster starts an upstream API server answering with upstream, and
+// returns the config c, with the cluster name proxying to it, and its handler.
+// A nil c is an empty config; the cache and context store are set if missing.
+func newTestCluster(t *testing.T, name string, upstream http.HandlerFunc,
+	c *HeadlampConfig,
+) (*HeadlampConfig, http.Handler, *httptest.Server) {
+	t.Helper()
+
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	if c == nil {
+		c = &HeadlampConfig{}
+	}
+
+	if c.cache == nil {
+		c.cache = cache.New[interface{}]()
+	}
+
+	if c.kubeConfigStore == nil {
+		c.kubeConfigStore = kubeconfig.NewContextStore()
+	}
+
+	handler := createHeadlampHandler(c)
+
+	addTestCluster(t, c, name, server.URL, "")
+
+	return c, handler, server
+}
+
+// addTestCluster adds the cluster name, with the Headlamp info info if it is
+// not empty, proxying to server, to the store of c. It replaces a cluster of
+// the same name.
+func addTestCluster(t *testing.T, c *HeadlampConfig, name, server, info string) {
+	t.Helper()
+
+	kubeContext := &api.Context{Cluster: name}
+	if info != "" {
+		kubeContext.Extensions = map[string]runtime.Object{
+			kubeconfig.HeadlampInfoExtension: &runtime.Unknown{Raw: []byte(info)},
+		}
+	}
+
+	require.NoError(t, c.kubeConfigStore.AddContext(&kubeconfig.Context{
+		Name:        name,
+		KubeContext: kubeContext,
+		Cluster:     &api.Cluster{Server: server},
+	}))
+}
+
 //nolint:gocognit,funlen
 func TestDynamicClusters(t *testing.T) {
 	if os.Getenv("HEADLAMP_RUN_INTEGRATION_TESTS") != "true" {
@@ -511,3 +668,829 @@ func TestDrainAndCordonNode(t *testing.T) {
 		}
 	}
 }
+
+func TestKubectlProxy(t *testing.T) {
+	var upstreamPath string
+
+	_, handler, _ := newTestCluster(t, "proxied", func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		_, err := w.Write([]byte(`{"kind":"NamespaceList"}`))
+		require.NoError(t, err)
+	}, &HeadlampConfig{
+		kubectlProxyPath: "/kubectl-proxy",
+	})
+
+	rr, err := getResponse(handler, "GET", "/kubectl-proxy/proxied/api/v1/namespaces", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"kind":"NamespaceList"}`, rr.Body.String())
+	assert.Equal(t, "/api/v1/namespaces", upstreamPath)
+
+	rr, err = getResponse(handler, "GET", "/kubectl-proxy/unknown/api/v1/namespaces", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestWildcardClusterProxy(t *testing.T) {
+	newUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := w.Write([]byte(name + " " + r.URL.Path))
+			require.NoError(t, err)
+		}))
+	}
+
+	wildcardUpstream := newUpstream("wildcard")
+	defer wildcardUpstream.Close()
+
+	exactUpstream := newUpstream("exact")
+	defer exactUpstream.Close()
+
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+	}
+	handler := createHeadlampHandler(&c)
+
+	err := c.kubeConfigStore.AddContext(&kubeconfig.Context{
+		Name:        "team-*",
+		KubeContext: &api.Context{Cluster: "team"},
+		Cluster:     &api.Cluster{Server: wildcardUpstream.URL + "/" + kubeconfig.ServerNamePlaceholder},
+	})
+	require.NoError(t, err)
+
+	err = c.kubeConfigStore.AddContext(&kubeconfig.Context{
+		Name:        "team-red",
+		KubeContext: &api.Context{Cluster: "team-red"},
+		Cluster:     &api.Cluster{Server: exactUpstream.URL},
+	})
+	require.NoError(t, err)
+
+	rr, err := getResponse(handler, "GET", "/clusters/team-blue/api/v1/namespaces", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "wildcard /team-blue/api/v1/namespaces", rr.Body.String())
+
+	// Exact matches win over patterns.
+	rr, err = getResponse(handler, "GET", "/clusters/team-red/api/v1/namespaces", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "exact /api/v1/namespaces", rr.Body.String())
+
+	rr, err = getResponse(handler, "GET", "/clusters/other/api/v1/namespaces", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Names matching the pattern which are not DNS labels are rejected.
+	rr, err = getResponse(handler, "GET", "/clusters/team-x@evil.com:443%2F/api/v1/namespaces", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Wildcard contexts are not listed as clusters.
+	for _, cluster := range c.getClusters() {
+		assert.NotEqual(t, "team-*", cluster.Name)
+		assert.NotEqual(t, "team-blue", cluster.Name)
+	}
+
+	// Only so many matched contexts are kept, the next ones are still served.
+	for i := 0; i < maxWildcardContexts+5; i++ {
+		rr, err = getResponse(handler, "GET", fmt.Sprintf("/clusters/team-%d/api/v1/namespaces", i), nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	contexts, err := c.kubeConfigStore.GetContexts()
+	require.NoError(t, err)
+	assert.Equal(t, maxWildcardContexts, countWildcardContexts(contexts))
+}
+
+func TestWatchPlugins(t *testing.T) {
+	tests := []struct {
+		name   string
+		config HeadlampConfig
+		want   bool
+	}{
+		{"default", HeadlampConfig{}, true},
+		{"in_cluster", HeadlampConfig{useInCluster: true}, false},
+		{"disabled", HeadlampConfig{disablePluginWatch: true}, false},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.config.watchPlugins())
+		})
+	}
+}
+
+func TestClusterPathAllowlist(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		requested []string
+	)
+
+	c, handler, upstream := newTestCluster(t, "restricted", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requested = append(requested, r.URL.Path)
+	}, &HeadlampConfig{
+		enableHelm: true,
+	})
+	addTestCluster(t, c, "restricted", upstream.URL, `{"allowedPaths": ["/api/v1/*"]}`)
+
+	rr, err := getResponse(handler, "GET", "/clusters/restricted/api/v1/pods", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr, err = getResponse(handler, "GET", "/clusters/restricted/apis/apps/v1/deployments", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// The other routes requesting paths from the cluster are restricted too.
+	for _, route := range []struct{ method, path, body string }{
+		{"GET", "/clusters/restricted/crds", ""},
+		{"POST", "/clusters/restricted/can-i", `[{"verb": "get", "resource": "pods"}]`},
+		{"POST", "/clusters/restricted/token-check", `{"token": "token"}`},
+	} {
+		req := httptest.NewRequest(route.method, route.path, strings.NewReader(route.body))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusForbidden, rr.Code, route.path)
+	}
+
+	// Helm and port forwards can't request other paths either.
+	token := uuid.New().String()
+	t.Setenv("HEADLAMP_BACKEND_TOKEN", token)
+
+	addTestCluster(t, c, "pods-only", upstream.URL, `{"allowedPaths": ["/api/v1/pods"]}`)
+
+	req := httptest.NewRequest("GET", "/clusters/pods-only/helm/releases/list", nil)
+	req.Header.Set("X-Headlamp_backend-Token", token)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.NotEqual(t, http.StatusOK, rr.Code)
+
+	_, err = getResponse(handler, "GET",
+		"/portforward/check?cluster=pods-only&namespace=default&pod=web&targetPort=80", nil)
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []string{"/api/v1/pods"}, requested)
+}
+
+func TestUpstreamPathPrefix(t *testing.T) {
+	c, handler, upstream := newTestCluster(t, "x", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}, nil)
+	addTestCluster(t, c, "x", upstream.URL, `{"upstreamPathPrefix": "/k8s-api"}`)
+
+	rr, err := getResponse(handler, "GET", "/clusters/x/api/v1/pods", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "/k8s-api/api/v1/pods", rr.Body.String())
+}
+
+func TestBaseURLRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int
+		method   string
+		url      string
+		location string
+	}{
+		{"missing_trailing_slash", http.StatusFound, "GET", "/headlamp", "/headlamp/"},
+		{"missing_base_url", http.StatusMovedPermanently, "GET", "/config", "/headlamp/config"},
+		{"keeps_query", http.StatusFound, "GET", "/plugins?x=1", "/headlamp/plugins?x=1"},
+		{"keeps_method", http.StatusPermanentRedirect, "POST", "/cluster", "/headlamp/cluster"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			c := HeadlampConfig{
+				cache:               cache.New[interface{}](),
+				kubeConfigStore:     kubeconfig.NewContextStore(),
+				baseURL:             "/headlamp",
+				baseURLRedirectCode: tc.code,
+				redirectToBaseURL:   true,
+			}
+			handler := createHeadlampHandler(&c)
+
+			rr, err := getResponse(handler, tc.method, tc.url, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.code, rr.Code)
+			assert.Equal(t, tc.location, rr.Header().Get("Location"))
+		})
+	}
+
+	// Requests under the base URL are not redirected.
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+		baseURL:         "/headlamp",
+	}
+
+	rr, err := getResponse(createHeadlampHandler(&c), "GET", "/headlamp/config", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Requests outside the base URL are not found unless they are redirected,
+	// but the base URL still gets its trailing slash.
+	rr, err = getResponse(createHeadlampHandler(&c), "GET", "/config", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Empty(t, rr.Header().Get("Location"))
+
+	rr, err = getResponse(createHeadlampHandler(&c), "GET", "/headlamp", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "/headlamp/", rr.Header().Get("Location"))
+}
+
+func TestConfigBaseURL(t *testing.T) {
+	for baseURL, expected := range map[string]string{"": "/", "/headlamp": "/headlamp"} {
+		c := HeadlampConfig{
+			cache:           cache.New[interface{}](),
+			kubeConfigStore: kubeconfig.NewContextStore(),
+			baseURL:         baseURL,
+		}
+
+		rr, err := getResponse(createHeadlampHandler(&c), "GET", baseURL+"/config", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var config clientConfig
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &config))
+
+		// The same base URL the index is rewritten with.
+		assert.Equal(t, expected, config.BaseURL)
+	}
+}
+
+// TestAddClusterResponse tests that adding a cluster answers the new config,
+// whatever config the client already has.
+func TestAddClusterResponse(t *testing.T) {
+	kubeConfigByte, err := os.ReadFile("./headlamp_testdata/kubeconfig")
+	require.NoError(t, err)
+
+	kubeConfig := base64.StdEncoding.EncodeToString(kubeConfigByte)
+	c := HeadlampConfig{
+		enableDynamicClusters: true,
+		cache:                 cache.New[interface{}](),
+		kubeConfigStore:       kubeconfig.NewContextStore(),
+	}
+	handler := createHeadlampHandler(&c)
+
+	token := uuid.New().String()
+	t.Setenv("HEADLAMP_BACKEND_TOKEN", token)
+
+	req, err := makeJSONReq(http.MethodPost, "/cluster", ClusterReq{KubeConfig: &kubeConfig})
+	require.NoError(t, err)
+	req.Header.Set("X-HEADLAMP_BACKEND-TOKEN", token)
+	req.Header.Set("If-None-Match", "*")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Empty(t, rr.Header().Get("ETag"))
+
+	var config clientConfig
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &config))
+	assert.Len(t, config.Clusters, 2)
+}
+
+func TestBaseURLProxyPaths(t *testing.T) {
+	newHandler := func(baseURL string, keepBaseURL bool) http.Handler {
+		_, handler, _ := newTestCluster(t, "proxied", func(w http.ResponseWriter, r *http.Request) {
+			_, err := w.Write([]byte(r.URL.Path))
+			require.NoError(t, err)
+		}, &HeadlampConfig{
+			baseURL:          baseURL,
+			kubectlProxyPath: "/kubectl-proxy",
+			keepProxyBaseURL: keepBaseURL,
+		})
+
+		return handler
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"cluster_api", "{base}/clusters/proxied/api/v1/namespaces", "/api/v1/namespaces"},
+		{"group_api", "{base}/clusters/proxied/apis/apps/v1/deployments", "/apis/apps/v1/deployments"},
+		{"kubectl_proxy", "{base}/kubectl-proxy/proxied/api/v1/namespaces", "/api/v1/namespaces"},
+		{"base_url_in_api_path", "{base}/clusters/proxied{base}/api/v1/namespaces", "/api/v1/namespaces"},
+		{"base_url_twice", "{base}{base}/clusters/proxied/api/v1/namespaces", "/api/v1/namespaces"},
+		{
+			"base_url_as_namespace", "{base}/clusters/proxied/api/v1/namespaces/headlamp/pods",
+			"/api/v1/namespaces/headlamp/pods",
+		},
+	}
+
+	for _, baseURL := range []string{"", "/headlamp"} {
+		handler := newHandler(baseURL, false)
+
+		for _, tc := range tests {
+			tc := tc
+
+			t.Run(tc.name+"_"+strings.Trim(baseURL, "/"), func(t *testing.T) {
+				rr, err := getResponse(handler, "GET", strings.ReplaceAll(tc.url, "{base}", baseURL), nil)
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, rr.Code)
+
+				// The upstream gets the same path, with or without a base URL.
+				assert.Equal(t, tc.expected, rr.Body.String())
+			})
+		}
+	}
+
+	t.Run("keep_base_url", func(t *testing.T) {
+		rr, err := getResponse(newHandler("/headlamp", true), "GET",
+			"/headlamp/clusters/proxied/headlamp/api/v1/namespaces", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "/headlamp/api/v1/namespaces", rr.Body.String())
+	})
+
+	// A base URL that is also an API root is only stripped when repeated.
+	rr, err := getResponse(newHandler("/api", false), "GET", "/api/clusters/proxied/api/v1/namespaces", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "/api/v1/namespaces", rr.Body.String())
+}
+
+func TestClusterNameEscaping(t *testing.T) {
+	c, handler, upstream := newTestCluster(t, "plain", func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(r.URL.Path))
+		require.NoError(t, err)
+	}, nil)
+
+	for _, name := range []string{
+		"arn:aws:eks:us-east-1:123456789012:cluster-prod",
+		"arn:aws:eks:us-east-1:123456789012:cluster/prod",
+	} {
+		addTestCluster(t, c, name, upstream.URL, "")
+
+		rr, err := getResponse(handler, "GET", "/clusters/"+url.PathEscape(name)+"/api/v1/pods", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rr.Code, name)
+		assert.Equal(t, "/api/v1/pods", rr.Body.String(), name)
+	}
+}
+
+func TestForbidInsecureClusters(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+	server := tlsServer.URL
+
+	secure, insecure, noCA := "secure", "insecure", "no-ca"
+
+	tests := []struct {
+		name          string
+		cluster       ClusterReq
+		expectedState int
+	}{
+		{
+			name:          "allowed",
+			cluster:       ClusterReq{Name: &secure, Server: &server, CertificateAuthorityData: caData},
+			expectedState: http.StatusCreated,
+		},
+		{
+			name: "insecure_skip_tls_verify",
+			cluster: ClusterReq{
+				Name: &insecure, Server: &server, CertificateAuthorityData: caData, InsecureSkipTLSVerify: true,
+			},
+			expectedState: http.StatusBadRequest,
+		},
+		{
+			name:          "no_certificate_authority",
+			cluster:       ClusterReq{Name: &noCA, Server: &server},
+			expectedState: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			c := HeadlampConfig{
+				cache:                 cache.New[interface{}](),
+				kubeConfigStore:       kubeconfig.NewContextStore(),
+				enableDynamicClusters: true,
+				forbidInsecure:        true,
+			}
+			handler := createHeadlampHandler(&c)
+
+			rr, err := getResponseFromRestrictedEndpoint(handler, "POST", "/cluster", tc.cluster)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedState, rr.Code)
+
+			_, err = c.kubeConfigStore.GetContext(*tc.cluster.Name)
+			assert.Equal(t, tc.expectedState == http.StatusCreated, err == nil)
+		})
+	}
+}
+
+func TestMaxURLLength(t *testing.T) {
+	_, handler, _ := newTestCluster(t, "test", func(w http.ResponseWriter, r *http.Request) {}, &HeadlampConfig{
+		maxURLLength: 256,
+	})
+
+	rr, err := getResponse(handler, "GET", "/clusters/test/api/v1/pods", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr, err = getResponse(handler, "GET", "/clusters/test/api/v1/namespaces/"+strings.Repeat("a", 256)+"/pods", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusRequestURITooLong, rr.Code)
+}
+
+func TestMethodOverride(t *testing.T) {
+	var methods []string
+
+	for _, enabled := range []bool{true, false} {
+		_, handler, _ := newTestCluster(t, "test", func(w http.ResponseWriter, r *http.Request) {
+			methods = append(methods, strings.TrimSpace(r.Method+" "+r.Header.Get(MethodOverrideHeader)))
+		}, &HeadlampConfig{
+			methodOverride: enabled,
+		})
+
+		req, err := http.NewRequestWithContext(context.Background(), "POST",
+			"/clusters/test/api/v1/namespaces/default/pods/web", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(MethodOverrideHeader, "DELETE")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	// Without overrides, the header is passed through as is.
+	assert.Equal(t, []string{"DELETE", "POST DELETE"}, methods)
+
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+		methodOverride:  true,
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), "POST", "/config", nil)
+	require.NoError(t, err)
+
+	req.Header.Set(MethodOverrideHeader, "CONNECT")
+
+	rr := httptest.NewRecorder()
+	createHeadlampHandler(&c).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestTrailingSlash(t *testing.T) {
+	c, handler, upstream := newTestCluster(t, "default", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}, nil)
+
+	addTestCluster(t, c, "preserve", upstream.URL, `{"trailingSlash": "preserve"}`)
+	addTestCluster(t, c, "strip", upstream.URL, `{"trailingSlash": "strip"}`)
+
+	tests := []struct {
+		cluster string
+		path    string
+		want    string
+	}{
+		{"default", "/api/v1/pods/", "/api/v1/pods/"},
+		{"preserve", "/api/v1/pods/", "/api/v1/pods/"},
+		{"strip", "/api/v1/pods/", "/api/v1/pods"},
+		{"strip", "/api/v1/pods", "/api/v1/pods"},
+	}
+
+	for _, tt := range tests {
+		rr, err := getResponse(handler, "GET", "/clusters/"+tt.cluster+tt.path, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, tt.want, rr.Body.String(), tt.cluster+tt.path)
+	}
+}
+
+// recordingTransport answers requests itself, recording them.
+type recordingTransport struct {
+	lock     sync.Mutex
+	requests []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.lock.Lock()
+	t.requests = append(t.requests, req)
+	t.lock.Unlock()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"kind":"PodList"}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestClusterTransport(t *testing.T) {
+	transport := &recordingTransport{}
+
+	var clusters []string
+
+	c := HeadlampConfig{
+		cache: cache.New[interface{}](),
+		ClusterTransport: func(cluster *Cluster) http.RoundTripper {
+			clusters = append(clusters, cluster.Name)
+
+			if strings.HasPrefix(cluster.Name, "mocked") {
+				return transport
+			}
+
+			return nil
+		},
+	}
+	c.kubeConfigStore = kubeconfig.NewContextStoreWithOptions(c.contextOptions())
+
+	// The mocked cluster doesn't exist and would need TLS credentials.
+	require.NoError(t, c.kubeConfigStore.AddContext(&kubeconfig.Context{
+		Name:        "mocked",
+		KubeContext: &api.Context{Cluster: "mocked"},
+		Cluster:     &api.Cluster{Server: "https://mocked.invalid:6443"},
+	}))
+
+	handler := createHeadlampHandler(&c)
+
+	rr, err := getResponse(handler, "GET", "/clusters/mocked/api/v1/pods?limit=1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"kind":"PodList"}`, rr.Body.String())
+
+	assert.Contains(t, clusters, "mocked")
+	require.Len(t, transport.requests, 1)
+
+	req := transport.requests[0]
+	assert.Equal(t, "mocked.invalid:6443", req.URL.Host)
+	assert.Equal(t, "/api/v1/pods", req.URL.Path)
+	assert.Equal(t, "limit=1", req.URL.RawQuery)
+	assert.Equal(t, kubeconfig.DefaultUserAgent(), req.Header.Get("User-Agent"))
+
+	// Another config in the same process doesn't change the transports of this one.
+	other := HeadlampConfig{cache: cache.New[interface{}]()}
+	other.kubeConfigStore = kubeconfig.NewContextStoreWithOptions(other.contextOptions())
+	createHeadlampHandler(&other)
+
+	require.NoError(t, c.kubeConfigStore.AddContext(&kubeconfig.Context{
+		Name:        "mocked-later",
+		KubeContext: &api.Context{Cluster: "mocked-later"},
+		Cluster:     &api.Cluster{Server: "https://mocked-later.invalid:6443"},
+	}))
+
+	rr, err = getResponse(handler, "GET", "/clusters/mocked-later/api/v1/pods", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, transport.requests, 2)
+}
+
+func TestProxyStreamingFlush(t *testing.T) {
+	const first, second = `{"type":"ADDED"}` + "\n", `{"type":"MODIFIED"}` + "\n"
+
+	received := make(chan struct{})
+
+	// An aggregated API which streams a response of a known length.
+	_, handler, _ := newTestCluster(t, "metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(first)+len(second)))
+		_, _ = w.Write([]byte(first))
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+		}
+
+		_, _ = w.Write([]byte(second))
+	}, nil)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// The first part arrives before the upstream sends the rest.
+	start := time.Now()
+
+	resp, err := http.Get(server.URL + "/clusters/metrics/apis/metrics.k8s.io/v1beta1/pods?watch=1") //nolint:noctx
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, first, line)
+	assert.Less(t, time.Since(start), 4*time.Second)
+
+	close(received)
+}
+
+func TestMissingStaticDir(t *testing.T) {
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+		staticDir:       filepath.Join(t.TempDir(), "missing"),
+	}
+
+	handler := createHeadlampHandler(&c)
+
+	rr, err := getResponse(handler, "GET", "/config", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Without the frontend, other paths are not found instead of served the index.
+	rr, err = getResponse(handler, "GET", "/c/main/pods", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestOidcAuthRedirectURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		config HeadlampConfig
+		want   string
+	}{
+		{
+			name: "default",
+			want: "/auth?cluster=my+cluster&token=t0ken",
+		},
+		{
+			name:   "custom_path",
+			config: HeadlampConfig{oidcAuthPath: "/login/callback/"},
+			want:   "/login/callback?cluster=my+cluster&token=t0ken",
+		},
+		{
+			name:   "base_url",
+			config: HeadlampConfig{oidcAuthPath: "signed-in", baseURL: "/headlamp"},
+			want:   "/headlamp/signed-in?cluster=my+cluster&token=t0ken",
+		},
+		{
+			name:   "dev_mode",
+			config: HeadlampConfig{oidcAuthPath: "signed-in", devMode: true},
+			want:   "http://localhost:3000/signed-in?cluster=my+cluster&token=t0ken",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.config.oidcAuthRedirectURL("my cluster", "t0ken"))
+		})
+	}
+}
+
+func TestProxyClientCancel(t *testing.T) {
+	received := make(chan struct{}, 1)
+	cancelled := make(chan struct{}, 1)
+
+	// A list which takes forever, until the request is cancelled.
+	c, handler, upstream := newTestCluster(t, "slow", func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+
+		select {
+		case <-r.Context().Done():
+			cancelled <- struct{}{}
+		case <-time.After(10 * time.Second):
+		}
+	}, nil)
+
+	c.proxyURLs = []string{upstream.URL + "/*"}
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+	}{
+		{name: "cluster", path: "/clusters/slow/api/v1/pods"},
+		{name: "external_proxy", path: "/externalproxy", header: http.Header{"Proxy-To": {upstream.URL + "/list"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			req, err := http.NewRequestWithContext(ctx, "GET", tt.path, nil)
+			require.NoError(t, err)
+
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}()
+
+			select {
+			case <-received:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the upstream did not get the request")
+			}
+
+			// The client goes away.
+			cancel()
+
+			select {
+			case <-cancelled:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the upstream request was not cancelled")
+			}
+
+			<-done
+		})
+	}
+}
+
+func TestLimitListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var active, most int32
+
+	release := make(chan struct{})
+
+	server := &http.Server{ //nolint:gosec
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			current := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+
+			for {
+				seen := atomic.LoadInt32(&most)
+				if current <= seen || atomic.CompareAndSwapInt32(&most, seen, current) {
+					break
+				}
+			}
+
+			<-release
+		}),
+	}
+
+	go server.Serve(limitListener(listener, 2)) //nolint:errcheck
+	defer server.Close()
+
+	const clients = 4
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// Each client has its own connection.
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+			resp, err := client.Get("http://" + listener.Addr().String()) //nolint:noctx
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+			}
+		}()
+	}
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&active) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// The other connections wait until the first ones are closed.
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&active))
+
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&most))
+	assert.Equal(t, listener, limitListener(listener, 0), "0 is unlimited")
+}
+
+// copyStaticFiles copies the test static files to a temporary directory, as
+// serving them writes the index with the base URL next to them.
+func copyStaticFiles(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	entries, err := os.ReadDir("headlamp_testdata/static_files")
+	require.NoError(t, err)
+
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join("headlamp_testdata/static_files", entry.Name()))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, entry.Name()), data, 0o600))
+	}
+
+	return dir
+}
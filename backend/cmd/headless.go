@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// headlessDocsURL is linked to by the root path when there is no frontend.
+const headlessDocsURL = "https://headlamp.dev/docs/latest/"
+
+// Responses of the root path when there is no frontend, besides a URL to
+// redirect to.
+const (
+	headlessRootJSON = "json"
+	headlessRootNone = "none"
+)
+
+// addHeadlessRootRoute adds what the root path serves when there is no static
+// dir, so users don't get a 404 wondering whether Headlamp runs: a message
+// saying it runs headless, a redirect or nothing, as configured.
+func (c *HeadlampConfig) addHeadlessRootRoute(r *mux.Router) {
+	switch c.headlessRoot {
+	case headlessRootNone:
+		return
+	case "", headlessRootJSON:
+		r.Path("/").Methods("GET", "HEAD").HandlerFunc(handleHeadlessRoot)
+	default:
+		r.Path("/").Methods("GET", "HEAD").Handler(http.RedirectHandler(c.headlessRoot, http.StatusFound))
+	}
+}
+
+// handleHeadlessRoot says that Headlamp runs without its frontend.
+func handleHeadlessRoot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"name":    "Headlamp",
+		"mode":    "headless",
+		"message": "Headlamp is running without its frontend, only the API is served",
+		"docs":    headlessDocsURL,
+	}); err != nil {
+		log.Println("Error encoding the headless root response", err)
+	}
+}
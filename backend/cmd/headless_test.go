@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadlessRoot(t *testing.T) {
+	newHandler := func(headlessRoot string) http.Handler {
+		return createHeadlampHandler(&HeadlampConfig{
+			cache:           cache.New[interface{}](),
+			kubeConfigStore: kubeconfig.NewContextStore(),
+			headlessRoot:    headlessRoot,
+		})
+	}
+
+	rr, err := getResponse(newHandler(""), "GET", "/", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var message map[string]string
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &message))
+	assert.Equal(t, "headless", message["mode"])
+	assert.Equal(t, headlessDocsURL, message["docs"])
+
+	rr, err = getResponse(newHandler("https://example.com/headlamp"), "GET", "/", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "https://example.com/headlamp", rr.Header().Get("Location"))
+
+	rr, err = getResponse(newHandler(headlessRootNone), "GET", "/", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// idleKeepAliveDivisor sets the TCP keepalive period of upgraded connections
+// to a fraction of their idle timeout, so dead peers are found before it.
+const idleKeepAliveDivisor = 3
+
+// idleTimeoutWriter is a http.ResponseWriter whose hijacked connection is
+// closed once no bytes flowed in either direction for the timeout.
+type idleTimeoutWriter struct {
+	http.ResponseWriter
+	timeout time.Duration
+	path    string
+}
+
+// Hijack hijacks the underlying connection and wraps it in an idleConn.
+func (iw *idleTimeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(iw.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return newIdleConn(conn, iw.timeout, iw.path), brw, nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (iw *idleTimeoutWriter) Unwrap() http.ResponseWriter {
+	return iw.ResponseWriter
+}
+
+// idleConn is a net.Conn closed after a period without reads or writes.
+// Proxied streams are passed through as is, so instead of injecting protocol
+// level pings (which could split a WebSocket frame of the stream), TCP
+// keepalive probes are used to detect peers that went away.
+type idleConn struct {
+	net.Conn
+	timeout      time.Duration
+	path         string
+	lastActivity int64
+	done         chan struct{}
+	closeOnce    sync.Once
+}
+
+func newIdleConn(conn net.Conn, timeout time.Duration, path string) *idleConn {
+	ic := &idleConn{
+		Conn:         conn,
+		timeout:      timeout,
+		path:         path,
+		lastActivity: time.Now().UnixNano(),
+		done:         make(chan struct{}),
+	}
+
+	if tcpConn := underlyingTCPConn(conn); tcpConn != nil {
+		_ = tcpConn.SetKeepAlive(true)
+		_ = tcpConn.SetKeepAlivePeriod(timeout / idleKeepAliveDivisor)
+	}
+
+	go ic.closeWhenIdle()
+
+	return ic
+}
+
+// underlyingTCPConn returns the TCP connection of conn, if it is one or wraps one.
+func underlyingTCPConn(conn net.Conn) *net.TCPConn {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+
+	tcpConn, _ := conn.(*net.TCPConn)
+
+	return tcpConn
+}
+
+// closeWhenIdle closes the connection once it has been idle for the timeout.
+// It returns when the connection is closed.
+func (ic *idleConn) closeWhenIdle() {
+	timer := time.NewTimer(ic.timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ic.done:
+			return
+		case <-timer.C:
+			idle := time.Since(time.Unix(0, atomic.LoadInt64(&ic.lastActivity)))
+			if idle < ic.timeout {
+				timer.Reset(ic.timeout - idle)
+				continue
+			}
+
+			log.Printf("Closing upgraded connection for %s after being idle for %s", ic.path, ic.timeout)
+
+			_ = ic.Close()
+
+			return
+		}
+	}
+}
+
+func (ic *idleConn) Read(b []byte) (int, error) {
+	n, err := ic.Conn.Read(b)
+	if n > 0 {
+		atomic.StoreInt64(&ic.lastActivity, time.Now().UnixNano())
+	}
+
+	return n, err
+}
+
+func (ic *idleConn) Write(b []byte) (int, error) {
+	n, err := ic.Conn.Write(b)
+	if n > 0 {
+		atomic.StoreInt64(&ic.lastActivity, time.Now().UnixNano())
+	}
+
+	return n, err
+}
+
+func (ic *idleConn) Close() error {
+	ic.closeOnce.Do(func() {
+		close(ic.done)
+	})
+
+	return ic.Conn.Close()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//nolint:funlen
+func TestUpgradeIdleTimeout(t *testing.T) {
+	idleTimeout := 200 * time.Millisecond
+
+	_, handler, _ := newTestCluster(t, "exec", func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		_, err = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		require.NoError(t, err)
+		require.NoError(t, brw.Flush())
+
+		// Echo until the connection is closed.
+		buf := make([]byte, 64)
+
+		for {
+			n, err := brw.Read(buf)
+			if err != nil {
+				return
+			}
+
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+	}, &HeadlampConfig{
+		upgradeIdleTimeout: idleTimeout,
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET /clusters/exec/api/v1/namespaces/default/pods/web/exec HTTP/1.1\r\n" +
+		"Host: headlamp\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n"))
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	// Traffic keeps the connection open past the idle timeout.
+	buf := make([]byte, 4)
+
+	for i := 0; i < 4; i++ {
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+
+		_, err = io.ReadFull(reader, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(buf))
+
+		time.Sleep(idleTimeout / 2)
+	}
+
+	// Once idle, the connection is closed.
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*idleTimeout)))
+
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// defaultDebugLogLines is the number of lines served by /debug/logs when
+// the request does not ask for a number.
+const defaultDebugLogLines = 100
+
+// logBuffer is an io.Writer keeping the last lines written to it, so recent
+// server logs can be served without access to the OS logs.
+type logBuffer struct {
+	lock  sync.Mutex
+	lines []string
+	// next is the index of the slot of the next line once the buffer is full.
+	next int
+	size int
+}
+
+func newLogBuffer(size int) *logBuffer {
+	return &logBuffer{lines: make([]string, 0, size), size: size}
+}
+
+// Write stores each line of p, dropping the oldest lines when full.
+func (lb *logBuffer) Write(p []byte) (int, error) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if len(lb.lines) < lb.size {
+			lb.lines = append(lb.lines, line)
+			continue
+		}
+
+		lb.lines[lb.next] = line
+		lb.next = (lb.next + 1) % lb.size
+	}
+
+	return len(p), nil
+}
+
+// last returns the n most recent lines, oldest first.
+func (lb *logBuffer) last(n int) []string {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	ordered := append(append([]string{}, lb.lines[lb.next:]...), lb.lines[:lb.next]...)
+	if n < len(ordered) {
+		ordered = ordered[len(ordered)-n:]
+	}
+
+	return ordered
+}
+
+// setupLogBuffer makes the standard and the structured loggers also write to
+// a buffer of the last size lines, and returns it.
+func setupLogBuffer(size int) *logBuffer {
+	buffer := newLogBuffer(size)
+
+	log.SetOutput(io.MultiWriter(os.Stderr, buffer))
+	zlog.Logger = zlog.Output(io.MultiWriter(os.Stderr, buffer))
+
+	return buffer
+}
+
+// handleDebugLogs serves the most recent log lines as a JSON array, as many
+// as the "lines" query parameter asks for.
+func (c *HeadlampConfig) handleDebugLogs(w http.ResponseWriter, r *http.Request) {
+	if c.logBuffer == nil {
+		http.Error(w, "log buffer is disabled", http.StatusNotFound)
+		return
+	}
+
+	lines := defaultDebugLogLines
+
+	if value := r.URL.Query().Get("lines"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "lines needs to be a positive number", http.StatusBadRequest)
+			return
+		}
+
+		lines = n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(c.logBuffer.last(lines)); err != nil {
+		log.Println("Error encoding log lines", err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	zlog "github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugLogs(t *testing.T) {
+	logger := zlog.Logger
+	defer func() {
+		zlog.Logger = logger
+		log.SetOutput(os.Stderr)
+	}()
+
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+		logBuffer:       setupLogBuffer(3),
+	}
+	handler := createHeadlampHandler(&c)
+
+	log.Println("first line")
+	zlog.Info().Msg("structured line")
+	log.Println("last line")
+
+	// The logs require the backend token on the main listener.
+	rr, err := getResponse(handler, "GET", "/debug/logs?lines=2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "last line")
+
+	rr, err = getResponseFromRestrictedEndpoint(handler, "GET", "/debug/logs?lines=2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var lines []string
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &lines))
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "structured line")
+	assert.Contains(t, lines[1], "last line")
+
+	// Only the last lines are kept.
+	buffer := newLogBuffer(2)
+	_, _ = buffer.Write([]byte("a\nb\n"))
+	_, _ = buffer.Write([]byte("c\n"))
+	assert.Equal(t, []string{"b", "c"}, buffer.last(defaultDebugLogLines))
+
+	rr, err = getResponseFromRestrictedEndpoint(handler, "GET", "/debug/logs?lines=many", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
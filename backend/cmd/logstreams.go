@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// streamLimiter caps the number of concurrent streams, eg. followed logs or
+// watches, per cluster.
+type streamLimiter struct {
+	lock   sync.Mutex
+	limit  int
+	active map[string]int
+}
+
+func newStreamLimiter(limit int) *streamLimiter {
+	return &streamLimiter{
+		limit:  limit,
+		active: make(map[string]int),
+	}
+}
+
+// acquire takes a stream slot of the cluster. It returns false if all slots are taken.
+func (l *streamLimiter) acquire(cluster string) bool {
+	return l.acquireUpTo(cluster, l.limit)
+}
+
+// acquireUpTo takes a stream slot of the cluster, which has limit slots
+// instead of the limit of the limiter. It returns false if all are taken.
+func (l *streamLimiter) acquireUpTo(cluster string, limit int) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.active[cluster] >= limit {
+		return false
+	}
+
+	l.active[cluster]++
+
+	return true
+}
+
+// release frees a stream slot taken with acquire.
+func (l *streamLimiter) release(cluster string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.active[cluster]--
+	if l.active[cluster] <= 0 {
+		delete(l.active, cluster)
+	}
+}
+
+// isLogStreamRequest returns true for followed pod logs,
+// i.e. /api/v1/namespaces/{namespace}/pods/{pod}/log?follow=true.
+func isLogStreamRequest(r *http.Request, apiPath string) bool {
+	parts := strings.Split(strings.Trim(apiPath, "/"), "/")
+
+	return len(parts) == 7 && parts[0] == "api" && parts[2] == "namespaces" && parts[4] == "pods" &&
+		parts[6] == "log" && r.URL.Query().Get("follow") == "true"
+}
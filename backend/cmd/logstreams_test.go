@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//nolint:funlen
+func TestLogStreamLimit(t *testing.T) {
+	streams := make(chan struct{}, 10)
+
+	c, handler, _ := newTestCluster(t, "logs", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		streams <- struct{}{}
+		<-r.Context().Done()
+	}, &HeadlampConfig{
+		maxLogStreams: 2,
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	logURL := server.URL + "/clusters/logs/api/v1/namespaces/default/pods/web/log?follow=true"
+
+	openStream := func() (*http.Response, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		req, err := http.NewRequestWithContext(ctx, "GET", logURL, nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		return resp, cancel
+	}
+
+	var cancels []context.CancelFunc
+
+	for i := 0; i < c.maxLogStreams; i++ {
+		resp, cancel := openStream()
+		defer resp.Body.Close()
+
+		cancels = append(cancels, cancel)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		<-streams
+	}
+
+	resp, cancel := openStream()
+	resp.Body.Close()
+	cancel()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// Closing a stream frees its slot.
+	cancels[0]()
+
+	assert.Eventually(t, func() bool {
+		resp, cancel := openStream()
+		defer cancel()
+		defer resp.Body.Close()
+
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for _, cancel := range cancels[1:] {
+		cancel()
+	}
+}
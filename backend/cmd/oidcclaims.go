@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"k8s.io/utils/strings/slices"
+)
+
+// verifyIDToken verifies an ID token, and checks that it was issued for
+// clientID and has the required claims. Required claims are "name" entries,
+// for claims which need to be present, or "name=value" ones, eg.
+// "email_verified=true", for claims which need to have that value.
+// The expiry and not before times are checked allowing for clockSkew between
+// Headlamp and the IdP, so the verifier should skip its own expiry check.
+func verifyIDToken(ctx context.Context, verifier *oidc.IDTokenVerifier, rawIDToken string,
+	clientID string, requiredClaims []string, clockSkew time.Duration,
+) (*oidc.IDToken, error) {
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTokenTimes(idToken, time.Now(), clockSkew); err != nil {
+		return nil, err
+	}
+
+	// The verifier checks the audience too, but a misconfigured verifier
+	// must not let tokens of other clients in.
+	if !slices.Contains(idToken.Audience, clientID) {
+		return nil, fmt.Errorf("token audience %q does not include client %q", idToken.Audience, clientID)
+	}
+
+	if err := checkRequiredClaims(idToken, requiredClaims); err != nil {
+		return nil, err
+	}
+
+	return idToken, nil
+}
+
+// checkTokenTimes returns an error if the token is expired or not valid yet
+// at now, by more than clockSkew.
+func checkTokenTimes(idToken *oidc.IDToken, now time.Time, clockSkew time.Duration) error {
+	if idToken.Expiry.Add(clockSkew).Before(now) {
+		return fmt.Errorf("token is expired since %s", idToken.Expiry.Format(time.RFC3339))
+	}
+
+	var claims struct {
+		NotBefore *float64 `json:"nbf"`
+	}
+
+	if err := idToken.Claims(&claims); err != nil {
+		return err
+	}
+
+	if claims.NotBefore == nil {
+		return nil
+	}
+
+	notBefore := time.Unix(int64(*claims.NotBefore), 0)
+	if now.Add(clockSkew).Before(notBefore) {
+		return fmt.Errorf("token is not valid yet, until %s", notBefore.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// checkRequiredClaims returns an error if the token lacks one of the required claims.
+func checkRequiredClaims(idToken *oidc.IDToken, requiredClaims []string) error {
+	var claims map[string]interface{}
+
+	if err := idToken.Claims(&claims); err != nil {
+		return err
+	}
+
+	for _, required := range requiredClaims {
+		name, want, hasValue := strings.Cut(required, "=")
+
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		value, ok := claims[name]
+		if !ok {
+			return fmt.Errorf("token is missing required claim %q", name)
+		}
+
+		if hasValue && fmt.Sprint(value) != strings.TrimSpace(want) {
+			return fmt.Errorf("token claim %q is %v, not the required %q", name, value, want)
+		}
+	}
+
+	return nil
+}
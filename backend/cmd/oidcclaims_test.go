@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// payloadKeySet is an oidc.KeySet accepting any signature.
+type payloadKeySet struct{}
+
+func (payloadKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.Split(jwt, ".")[1])
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	const issuer = "https://issuer.example.com"
+
+	verifier := oidc.NewVerifier(issuer, payloadKeySet{}, &oidc.Config{SkipClientIDCheck: true})
+
+	newToken := func(claims map[string]interface{}) string {
+		claims["iss"] = issuer
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+
+		payload, err := json.Marshal(claims)
+		require.NoError(t, err)
+
+		return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString(payload) + "." +
+			base64.RawURLEncoding.EncodeToString([]byte("signature"))
+	}
+
+	required := []string{"email_verified=true", "email"}
+
+	t.Run("valid", func(t *testing.T) {
+		token := newToken(map[string]interface{}{
+			"aud": "headlamp", "email": "jane@example.com", "email_verified": true,
+		})
+
+		idToken, err := verifyIDToken(context.Background(), verifier, token, "headlamp", required, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"headlamp"}, idToken.Audience)
+	})
+
+	t.Run("wrong_audience", func(t *testing.T) {
+		token := newToken(map[string]interface{}{
+			"aud": "other-client", "email": "jane@example.com", "email_verified": true,
+		})
+
+		_, err := verifyIDToken(context.Background(), verifier, token, "headlamp", required, 0)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "audience")
+	})
+
+	t.Run("missing_required_claim", func(t *testing.T) {
+		token := newToken(map[string]interface{}{"aud": "headlamp", "email_verified": true})
+
+		_, err := verifyIDToken(context.Background(), verifier, token, "headlamp", required, 0)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `"email"`)
+	})
+
+	t.Run("wrong_required_claim_value", func(t *testing.T) {
+		token := newToken(map[string]interface{}{
+			"aud": "headlamp", "email": "jane@example.com", "email_verified": false,
+		})
+
+		_, err := verifyIDToken(context.Background(), verifier, token, "headlamp", required, 0)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "email_verified")
+	})
+}
+
+func TestVerifyIDTokenClockSkew(t *testing.T) {
+	const issuer = "https://issuer.example.com"
+
+	verifier := oidc.NewVerifier(issuer, payloadKeySet{}, &oidc.Config{SkipClientIDCheck: true, SkipExpiryCheck: true})
+
+	newToken := func(exp, nbf time.Duration) string {
+		claims := map[string]interface{}{
+			"iss": issuer,
+			"aud": "headlamp",
+			"exp": time.Now().Add(exp).Unix(),
+			"nbf": time.Now().Add(nbf).Unix(),
+		}
+
+		payload, err := json.Marshal(claims)
+		require.NoError(t, err)
+
+		return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString(payload) + "." +
+			base64.RawURLEncoding.EncodeToString([]byte("signature"))
+	}
+
+	tests := []struct {
+		name    string
+		exp     time.Duration
+		nbf     time.Duration
+		skew    time.Duration
+		wantErr string
+	}{
+		{name: "valid", exp: time.Hour, nbf: -time.Minute, skew: 0},
+		{name: "expired_within_skew", exp: -10 * time.Second, nbf: -time.Hour, skew: 30 * time.Second},
+		{name: "expired", exp: -10 * time.Second, nbf: -time.Hour, skew: 0, wantErr: "expired"},
+		{name: "expired_beyond_skew", exp: -time.Minute, nbf: -time.Hour, skew: 30 * time.Second, wantErr: "expired"},
+		{name: "not_valid_yet_within_skew", exp: time.Hour, nbf: 10 * time.Second, skew: 30 * time.Second},
+		{name: "not_valid_yet", exp: time.Hour, nbf: 10 * time.Second, skew: 0, wantErr: "not valid yet"},
+		{
+			name: "not_valid_yet_beyond_skew", exp: time.Hour, nbf: time.Minute, skew: 30 * time.Second,
+			wantErr: "not valid yet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifyIDToken(context.Background(), verifier, newToken(tt.exp, tt.nbf), "headlamp", nil, tt.skew)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+// oidcLoginTTL is how long an OIDC login waits for its callback.
+const oidcLoginTTL = 10 * time.Minute
+
+// errTooManyOidcLogins is returned when the maximum number of OIDC logins
+// waiting for their callback is reached.
+var errTooManyOidcLogins = errors.New("too many OIDC logins in progress, try again later")
+
+// oidcLoginStore keeps the cluster and OAuth config of the OIDC logins started,
+// by state, until their callback. Logins expire after the TTL, and at most max
+// of them are kept so a flood of logins does not grow it without bounds.
+type oidcLoginStore struct {
+	lock    sync.Mutex
+	max     int
+	ttl     time.Duration
+	entries map[string]*oidcLogin
+	// now returns the current time, it is time.Now outside of tests.
+	now func() time.Time
+}
+
+type oidcLogin struct {
+	cluster   string
+	config    *OauthConfig
+	startedAt time.Time
+}
+
+// newOidcState returns a random state for an OIDC login, so callbacks can't be
+// forged for logins which were not started.
+func newOidcState() (string, error) {
+	state := make([]byte, 32)
+	if _, err := rand.Read(state); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(state), nil
+}
+
+// newOidcLoginStore returns a store of at most max logins, or unlimited if max
+// is not positive.
+func newOidcLoginStore(max int, ttl time.Duration) *oidcLoginStore {
+	return &oidcLoginStore{
+		max:     max,
+		ttl:     ttl,
+		entries: make(map[string]*oidcLogin),
+		now:     time.Now,
+	}
+}
+
+// add stores the login to the cluster of the state, replacing a previous one
+// of the same state. It fails with errTooManyOidcLogins once the store is full,
+// rather than evicting logins, which a flood of new ones would otherwise all
+// push out.
+func (s *oidcLoginStore) add(state, cluster string, config *OauthConfig) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+
+	s.removeExpired(now)
+
+	if _, ok := s.entries[state]; !ok && s.max > 0 && len(s.entries) >= s.max {
+		return errTooManyOidcLogins
+	}
+
+	s.entries[state] = &oidcLogin{cluster: cluster, config: config, startedAt: now}
+
+	return nil
+}
+
+// take removes the login of the state and returns it, if it has not expired.
+// A state is only used once, so its callback can't be replayed.
+func (s *oidcLoginStore) take(state string) (*oidcLogin, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	login, ok := s.entries[state]
+	if !ok {
+		return nil, false
+	}
+
+	delete(s.entries, state)
+
+	if s.now().Sub(login.startedAt) >= s.ttl {
+		return nil, false
+	}
+
+	return login, true
+}
+
+// removeExpired removes the logins older than the TTL. The lock must be held.
+func (s *oidcLoginStore) removeExpired(now time.Time) {
+	for state, login := range s.entries {
+		if now.Sub(login.startedAt) >= s.ttl {
+			delete(s.entries, state)
+		}
+	}
+}
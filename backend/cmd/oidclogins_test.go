@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestOidcCallbackState(t *testing.T) {
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+	}
+	handler := createHeadlampHandler(&c)
+
+	addTestCluster(t, &c, "oidc-cluster", "https://127.0.0.1:6443", "")
+
+	t.Run("empty", func(t *testing.T) {
+		rr, err := getResponse(handler, "GET", "/oidc-callback?state=", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	// States are random, and only the ones of logins started are accepted,
+	// including the former base64 encoded cluster names.
+	for _, state := range []string{"not-base64!", base64.StdEncoding.EncodeToString([]byte("oidc-cluster"))} {
+		rr, err := getResponse(handler, "GET", "/oidc-callback?state="+url.QueryEscape(state), nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "invalid request\n", rr.Body.String(), "only one error is written")
+	}
+
+	first, err := newOidcState()
+	require.NoError(t, err)
+
+	second, err := newOidcState()
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first, second)
+	assert.Len(t, first, 43)
+}
+
+func TestOidcLoginStore(t *testing.T) {
+	now := time.Now()
+
+	logins := newOidcLoginStore(2, time.Minute)
+	logins.now = func() time.Time { return now }
+
+	require.NoError(t, logins.add("a", "cluster", &OauthConfig{}))
+	now = now.Add(30 * time.Second)
+	require.NoError(t, logins.add("b", "cluster", &OauthConfig{}))
+
+	// The store is full, new logins are rejected but existing ones can restart.
+	assert.ErrorIs(t, logins.add("c", "cluster", &OauthConfig{}), errTooManyOidcLogins)
+	assert.NoError(t, logins.add("b", "cluster", &OauthConfig{}))
+
+	_, ok := logins.take("c")
+	assert.False(t, ok)
+
+	// Expired logins free their slot.
+	now = now.Add(45 * time.Second)
+
+	_, ok = logins.take("a")
+	assert.False(t, ok)
+
+	require.NoError(t, logins.add("c", "cluster", &OauthConfig{}))
+	assert.ErrorIs(t, logins.add("d", "cluster", &OauthConfig{}), errTooManyOidcLogins)
+
+	// A login is taken only once, which frees its slot.
+	login, ok := logins.take("c")
+	require.True(t, ok)
+	assert.Equal(t, "cluster", login.cluster)
+
+	_, ok = logins.take("c")
+	assert.False(t, ok)
+
+	require.NoError(t, logins.add("d", "cluster", &OauthConfig{}))
+
+	unlimited := newOidcLoginStore(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, unlimited.add(strconv.Itoa(i), "cluster", &OauthConfig{}))
+	}
+}
+
+func TestOidcLoginLimit(t *testing.T) {
+	var issuer *httptest.Server
+
+	issuer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":%q,"token_endpoint":%q,"jwks_uri":%q}`,
+			issuer.URL, issuer.URL+"/auth", issuer.URL+"/token", issuer.URL+"/keys")
+	}))
+	defer issuer.Close()
+
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+		oidcMaxLogins:   1,
+	}
+
+	for _, name := range []string{"first", "second"} {
+		require.NoError(t, c.kubeConfigStore.AddContext(&kubeconfig.Context{
+			Name:        name,
+			KubeContext: &api.Context{Cluster: name},
+			Cluster:     &api.Cluster{Server: "https://" + name + ".invalid"},
+			OidcConf:    &kubeconfig.OidcConfig{ClientID: "headlamp", IdpIssuerURL: issuer.URL},
+		}))
+	}
+
+	handler := createHeadlampHandler(&c)
+
+	rr, err := getResponse(handler, "GET", "/oidc?cluster=first", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusFound, rr.Code)
+	assert.True(t, strings.HasPrefix(rr.Header().Get("Location"), issuer.URL+"/auth?"))
+
+	location, err := url.Parse(rr.Header().Get("Location"))
+	require.NoError(t, err)
+
+	state := location.Query().Get("state")
+	assert.NotEqual(t, base64.StdEncoding.EncodeToString([]byte("first")), state)
+
+	// Each login has its own state, so it takes a slot.
+	for _, cluster := range []string{"first", "second"} {
+		rr, err = getResponse(handler, "GET", "/oidc?cluster="+cluster, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	}
+
+	// The callback takes the login, even if it fails, so it can't be replayed
+	// and its slot is freed.
+	rr, err = getResponse(handler, "GET", "/oidc-callback?code=code&state="+url.QueryEscape(state), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Failed to exchange token")
+
+	rr, err = getResponse(handler, "GET", "/oidc-callback?code=code&state="+url.QueryEscape(state), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr, err = getResponse(handler, "GET", "/oidc?cluster=second", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, rr.Code)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+)
+
+const (
+	defaultOidcDiscoveryTTL   = 10 * time.Minute
+	oidcDiscoveryRetryBackoff = 30 * time.Second
+)
+
+// oidcProviderCache caches OIDC providers, i.e. the discovery documents of
+// issuers. When a refresh fails, the last good provider keeps being served and
+// the refresh is retried in the background, so logins survive IdP outages.
+type oidcProviderCache struct {
+	lock         sync.Mutex
+	ttl          time.Duration
+	retryBackoff time.Duration
+	entries      map[string]*oidcProviderEntry
+	// newProvider fetches the discovery document, it is oidc.NewProvider outside of tests.
+	newProvider func(ctx context.Context, issuer string) (*oidc.Provider, error)
+	// options are those of the contexts, for the transport to the providers.
+	options *kubeconfig.Options
+}
+
+type oidcProviderEntry struct {
+	provider  *oidc.Provider
+	fetchedAt time.Time
+	retrying  bool
+}
+
+func newOidcProviderCache(ttl time.Duration, options *kubeconfig.Options) *oidcProviderCache {
+	if ttl <= 0 {
+		ttl = defaultOidcDiscoveryTTL
+	}
+
+	return &oidcProviderCache{
+		ttl:          ttl,
+		retryBackoff: oidcDiscoveryRetryBackoff,
+		entries:      make(map[string]*oidcProviderEntry),
+		newProvider:  oidc.NewProvider,
+		options:      options,
+	}
+}
+
+// get returns the provider of the issuer, fetching it if it is missing or
+// older than the TTL. If fetching fails, a previously fetched provider is
+// returned instead of the error.
+func (pc *oidcProviderCache) get(issuer string, insecure bool) (*oidc.Provider, error) {
+	key := issuer + "|" + strconv.FormatBool(insecure)
+
+	pc.lock.Lock()
+	entry := pc.entries[key]
+	retrying := entry != nil && entry.retrying
+	pc.lock.Unlock()
+
+	// While the background retries run, the stale provider is served right away.
+	if entry != nil && (retrying || time.Since(entry.fetchedAt) < pc.ttl) {
+		return entry.provider, nil
+	}
+
+	provider, err := pc.fetch(key, issuer, insecure)
+	if err == nil {
+		return provider, nil
+	}
+
+	if entry == nil {
+		return nil, err
+	}
+
+	log.Printf("Error refreshing OIDC discovery of %s, using the one from %s ago: %v",
+		issuer, time.Since(entry.fetchedAt).Round(time.Second), err)
+
+	pc.retryInBackground(key, issuer, insecure)
+
+	return entry.provider, nil
+}
+
+// fetch gets the provider of the issuer and stores it on success.
+func (pc *oidcProviderCache) fetch(key, issuer string, insecure bool) (*oidc.Provider, error) {
+	provider, err := pc.newProvider(oidcClientContext(context.Background(), pc.options, insecure), issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	pc.lock.Lock()
+	pc.entries[key] = &oidcProviderEntry{provider: provider, fetchedAt: time.Now()}
+	pc.lock.Unlock()
+
+	return provider, nil
+}
+
+// retryInBackground refreshes the provider until it succeeds. Only one retry
+// loop runs per issuer.
+func (pc *oidcProviderCache) retryInBackground(key, issuer string, insecure bool) {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	entry := pc.entries[key]
+	if entry == nil || entry.retrying {
+		return
+	}
+
+	entry.retrying = true
+
+	go func() {
+		for {
+			time.Sleep(pc.retryBackoff)
+
+			if _, err := pc.fetch(key, issuer, insecure); err == nil {
+				log.Printf("Refreshed OIDC discovery of %s", issuer)
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOidcDiscoveryStaleWhileRevalidate(t *testing.T) {
+	var failing int32
+
+	var issuer *httptest.Server
+
+	issuer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			http.Error(w, "IdP is down", http.StatusServiceUnavailable)
+			return
+		}
+
+		err := json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.URL,
+			"authorization_endpoint": issuer.URL + "/auth",
+			"token_endpoint":         issuer.URL + "/token",
+			"jwks_uri":               issuer.URL + "/keys",
+		})
+		require.NoError(t, err)
+	}))
+	defer issuer.Close()
+
+	providers := newOidcProviderCache(time.Nanosecond, &kubeconfig.Options{})
+	providers.retryBackoff = 10 * time.Millisecond
+
+	provider, err := providers.get(issuer.URL, false)
+	require.NoError(t, err)
+	assert.Equal(t, issuer.URL+"/token", provider.Endpoint().TokenURL)
+
+	atomic.StoreInt32(&failing, 1)
+
+	// The refresh fails, so the last good discovery is served.
+	stale, err := providers.get(issuer.URL, false)
+	require.NoError(t, err)
+	assert.Same(t, provider, stale)
+
+	// Without a last good discovery the error is returned.
+	_, err = newOidcProviderCache(time.Nanosecond, &kubeconfig.Options{}).get(issuer.URL, false)
+	assert.Error(t, err)
+
+	// The background retries pick up the recovered IdP.
+	atomic.StoreInt32(&failing, 0)
+
+	assert.Eventually(t, func() bool {
+		refreshed, err := providers.get(issuer.URL, false)
+		return err == nil && refreshed != provider
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+)
+
+// PageSizeHeader opts a list request in to server-side paging. Headlamp then
+// fetches the list from the cluster in pages of the given size and returns
+// all the items in a single response.
+const PageSizeHeader = "X-Headlamp-Page-Size"
+
+// maxListPages bounds the number of pages fetched for a single list request.
+const maxListPages = 1000
+
+var errTooManyPages = errors.New("list has too many pages")
+
+// bufferedResponse is a http.ResponseWriter keeping the whole response in memory.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (br *bufferedResponse) Header() http.Header {
+	return br.header
+}
+
+func (br *bufferedResponse) WriteHeader(status int) {
+	if br.status == 0 {
+		br.status = status
+	}
+}
+
+func (br *bufferedResponse) Write(b []byte) (int, error) {
+	br.WriteHeader(http.StatusOK)
+
+	return br.body.Write(b)
+}
+
+// Flush is a no-op, the response is only sent once complete.
+func (br *bufferedResponse) Flush() {}
+
+// listPageSize returns the page size requested with PageSizeHeader, or 0 if
+// the request is not a list to page through.
+func listPageSize(r *http.Request) int {
+	pageSize, err := strconv.Atoi(r.Header.Get(PageSizeHeader))
+	if err != nil || pageSize <= 0 || r.Method != http.MethodGet || isStreamingRequest(r) {
+		return 0
+	}
+
+	return pageSize
+}
+
+// proxyPagedList proxies a list request as a sequence of requests using the
+// limit and continue parameters, and writes a single list with the items of
+// all the pages. Responses other than a 200 with a JSON list are passed through.
+// The pages may total at most maxSize bytes, unless it is 0, as they are kept
+// in memory until the list is complete.
+func proxyPagedList(kContext *kubeconfig.Context, w http.ResponseWriter, r *http.Request,
+	pageSize int, maxSize int64,
+) error {
+	r.Header.Del(PageSizeHeader)
+	// Pages are decoded, so let the transport handle the encoding.
+	r.Header.Del("Accept-Encoding")
+
+	var list map[string]interface{}
+
+	var items []interface{}
+
+	itemsKey := "items"
+	continueToken := ""
+
+	var size int64
+
+	for page := 0; ; page++ {
+		if page == maxListPages {
+			return errTooManyPages
+		}
+
+		pageRequest := r.Clone(r.Context())
+		query := pageRequest.URL.Query()
+		query.Set("limit", strconv.Itoa(pageSize))
+
+		if continueToken != "" {
+			query.Set("continue", continueToken)
+		}
+
+		pageRequest.URL.RawQuery = query.Encode()
+
+		resp := &bufferedResponse{header: http.Header{}}
+		if err := kContext.ProxyRequest(resp, pageRequest); err != nil {
+			return err
+		}
+
+		size += int64(resp.body.Len())
+		if maxSize > 0 && size > maxSize {
+			return errResponseTooLarge
+		}
+
+		var pageList map[string]interface{}
+		if resp.status != http.StatusOK || decodeJSONNumbers(resp.body.Bytes(), &pageList) != nil {
+			writeBufferedResponse(w, resp)
+			return nil
+		}
+
+		// Table responses (as=Table) have rows instead of items.
+		if _, ok := pageList["rows"]; ok {
+			itemsKey = "rows"
+		}
+
+		pageItems, _ := pageList[itemsKey].([]interface{})
+		items = append(items, pageItems...)
+
+		if list == nil {
+			list = pageList
+		}
+
+		metadata, _ := pageList["metadata"].(map[string]interface{})
+		continueToken, _ = metadata["continue"].(string)
+
+		if continueToken == "" {
+			break
+		}
+	}
+
+	if metadata, ok := list["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "continue")
+		delete(metadata, "remainingItemCount")
+	}
+
+	if items == nil {
+		items = []interface{}{}
+	}
+
+	list[itemsKey] = items
+
+	w.Header().Set("Content-Type", "application/json")
+
+	return json.NewEncoder(w).Encode(list)
+}
+
+// decodeJSONNumbers decodes data into v, keeping numbers as json.Number, so
+// large integers, eg. of resource versions or sizes, are written back as is.
+func decodeJSONNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	return decoder.Decode(v)
+}
+
+func writeBufferedResponse(w http.ResponseWriter, resp *bufferedResponse) {
+	for key, values := range resp.header {
+		w.Header()[key] = values
+	}
+
+	w.WriteHeader(resp.status)
+
+	_, _ = w.Write(resp.body.Bytes())
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPagedListProxy(t *testing.T) {
+	pods := []string{"a", "b", "c", "d", "e"}
+
+	var requests []string
+
+	c, handler, _ := newTestCluster(t, "paged", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		assert.Empty(t, r.Header.Get(PageSizeHeader))
+
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		require.NoError(t, err)
+
+		start := 0
+		if token := r.URL.Query().Get("continue"); token != "" {
+			start, err = strconv.Atoi(token)
+			require.NoError(t, err)
+		}
+
+		end := start + limit
+		metadata := map[string]interface{}{"resourceVersion": "42"}
+
+		if end < len(pods) {
+			metadata["continue"] = strconv.Itoa(end)
+			metadata["remainingItemCount"] = len(pods) - end
+		} else {
+			end = len(pods)
+		}
+
+		items := []map[string]interface{}{}
+		for _, name := range pods[start:end] {
+			items = append(items, map[string]interface{}{
+				"metadata": map[string]string{"name": name},
+				// Past the integers float64 holds exactly.
+				"spec": map[string]int64{"size": 9007199254740993},
+			})
+		}
+
+		err = json.NewEncoder(w).Encode(map[string]interface{}{
+			"kind": "PodList", "apiVersion": "v1", "metadata": metadata, "items": items,
+		})
+		require.NoError(t, err)
+	}, nil)
+
+	req, err := http.NewRequestWithContext(context.Background(), "GET", "/clusters/paged/api/v1/pods", nil)
+	require.NoError(t, err)
+	req.Header.Set(PageSizeHeader, "2")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Equal(t, []string{"limit=2", "continue=2&limit=2", "continue=4&limit=2"}, requests)
+
+	var list struct {
+		Kind     string                 `json:"kind"`
+		Metadata map[string]interface{} `json:"metadata"`
+		Items    []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+
+	assert.Equal(t, "PodList", list.Kind)
+	assert.Equal(t, map[string]interface{}{"resourceVersion": "42"}, list.Metadata)
+
+	names := []string{}
+	for _, item := range list.Items {
+		names = append(names, item.Metadata.Name)
+	}
+
+	assert.Equal(t, pods, names)
+	assert.Equal(t, len(pods), strings.Count(rr.Body.String(), `"size":9007199254740993`))
+
+	// The pages count towards the maximum response size, and no more are
+	// fetched once it is exceeded.
+	requests = nil
+	c.proxyMaxResponseSize = 300
+
+	req, err = http.NewRequestWithContext(context.Background(), "GET", "/clusters/paged/api/v1/pods", nil)
+	require.NoError(t, err)
+	req.Header.Set(PageSizeHeader, "2")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	assert.Len(t, requests, 2)
+}
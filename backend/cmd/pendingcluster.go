@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+)
+
+// maxProxySetupRetryInterval caps the backoff between proxy setup retries.
+const maxProxySetupRetryInterval = 5 * time.Minute
+
+// setupProxyOrRetry sets up the proxy of a stored context. If the setup fails,
+// the context is marked pending and the setup is retried in the background.
+func (c *HeadlampConfig) setupProxyOrRetry(kContext *kubeconfig.Context) {
+	err := kContext.SetupProxy()
+	if err == nil {
+		return
+	}
+
+	log.Printf("Error setting up proxy for cluster %s, retrying in the background: %v", kContext.Name, err)
+
+	kContext.SetPending(true)
+
+	go c.retryProxySetup(kContext)
+}
+
+// retryProxySetup retries the proxy setup of a pending context, with an
+// exponential backoff, until it succeeds or the context is removed.
+// The proxy is set up on a copy of the context, which replaces it once ready,
+// as requests keep using the pending context meanwhile.
+func (c *HeadlampConfig) retryProxySetup(kContext *kubeconfig.Context) {
+	interval := c.clusterSetupRetry
+
+	for {
+		time.Sleep(interval)
+
+		// Stop once the cluster was removed or replaced.
+		if stored, err := c.kubeConfigStore.GetContext(kContext.Name); err != nil || stored != kContext {
+			return
+		}
+
+		ready := kContext.Copy()
+
+		if err := ready.SetupProxy(); err != nil {
+			log.Printf("Error setting up proxy for cluster %s: %v", kContext.Name, err)
+
+			interval *= 2
+			if interval > maxProxySetupRetryInterval {
+				interval = maxProxySetupRetryInterval
+			}
+
+			continue
+		}
+
+		ready.SetPending(false)
+
+		if err := c.kubeConfigStore.ReplaceContext(kContext, ready); err != nil {
+			return
+		}
+
+		log.Printf("Set up proxy for pending cluster %s", kContext.Name)
+
+		return
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynamicClusterSetupRetry(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	// The CA file is only readable after the cluster was added.
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	kubeConfig := base64.StdEncoding.EncodeToString([]byte(`apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: ` + upstream.URL + `
+    certificate-authority: ` + caFile + `
+  name: pending
+contexts:
+- context:
+    cluster: pending
+  name: pending
+`))
+
+	c := HeadlampConfig{
+		cache:                 cache.New[interface{}](),
+		kubeConfigStore:       kubeconfig.NewContextStore(),
+		enableDynamicClusters: true,
+		clusterSetupRetry:     10 * time.Millisecond,
+	}
+	handler := createHeadlampHandler(&c)
+
+	rr, err := getResponseFromRestrictedEndpoint(handler, "POST", "/cluster", ClusterReq{KubeConfig: &kubeConfig})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	clusterStatus := func() string {
+		for _, cluster := range c.getClusters() {
+			if cluster.Name == "pending" {
+				return cluster.Status
+			}
+		}
+
+		return ""
+	}
+
+	assert.Equal(t, kubeconfig.StatusPending, clusterStatus())
+
+	rr, err = getResponse(handler, "GET", "/clusters/pending/version", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caData, 0o600))
+
+	require.Eventually(t, func() bool {
+		return clusterStatus() == kubeconfig.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	rr, err = getResponse(handler, "GET", "/clusters/pending/version", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
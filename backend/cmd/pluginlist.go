@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// TotalCountHeader carries the number of items of a paged list, eg. of the
+// plugins, as the response only has the requested page.
+const TotalCountHeader = "X-Total-Count"
+
+var errInvalidPage = errors.New("limit and offset must be non-negative integers")
+
+// pageParams returns the limit and offset of the page requested with the
+// ?limit= and ?offset= query parameters. A zero limit means all the items.
+func pageParams(r *http.Request) (int, int, error) {
+	params := [2]int{}
+
+	for i, name := range []string{"limit", "offset"} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, 0, errInvalidPage
+		}
+
+		params[i] = n
+	}
+
+	return params[0], params[1], nil
+}
+
+// pageOf returns the items of the page, which is empty past the end.
+func pageOf[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+
+	items = items[offset:]
+
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+
+	return items
+}
+
+// writePluginPage writes the requested page of a plugin list as json, with the
+// total count of plugins. Pages have at most maxSize plugins, unless it is 0.
+func writePluginPage[T any](w http.ResponseWriter, r *http.Request, items []T, maxSize int) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if maxSize > 0 && (limit == 0 || limit > maxSize) {
+		limit = maxSize
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(TotalCountHeader, strconv.Itoa(len(items)))
+
+	if err := json.NewEncoder(w).Encode(pageOf(items, limit, offset)); err != nil {
+		log.Println("Error encoding plugin list", err)
+	}
+}
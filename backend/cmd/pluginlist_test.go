@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/plugins"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginListPaging(t *testing.T) {
+	pluginPaths := make([]string, 50)
+	manifest := make([]plugins.PluginStatus, 50)
+
+	for i := range pluginPaths {
+		pluginPaths[i] = fmt.Sprintf("plugins/plugin-%d", i)
+		manifest[i] = plugins.PluginStatus{Name: fmt.Sprintf("plugin-%d", i), Path: pluginPaths[i]}
+	}
+
+	newHandler := func(maxSize int) http.Handler {
+		c := HeadlampConfig{
+			cache:             cache.New[interface{}](),
+			kubeConfigStore:   kubeconfig.NewContextStore(),
+			maxPluginListSize: maxSize,
+		}
+		handler := createHeadlampHandler(&c)
+
+		require.NoError(t, c.cache.Set(context.Background(), plugins.PluginListKey, pluginPaths))
+		require.NoError(t, c.cache.Set(context.Background(), plugins.PluginManifestKey, manifest))
+
+		return handler
+	}
+
+	getPage := func(t *testing.T, handler http.Handler, url string) []string {
+		rr, err := getResponse(handler, "GET", url, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "50", rr.Header().Get(TotalCountHeader))
+
+		var page []string
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+
+		return page
+	}
+
+	handler := newHandler(0)
+
+	// All the plugins by default.
+	assert.Equal(t, pluginPaths, getPage(t, handler, "/plugins"))
+
+	assert.Equal(t, pluginPaths[10:20], getPage(t, handler, "/plugins?limit=10&offset=10"))
+	assert.Equal(t, pluginPaths[45:], getPage(t, handler, "/plugins?limit=10&offset=45"))
+	assert.Equal(t, pluginPaths[40:], getPage(t, handler, "/plugins?offset=40"))
+	assert.Empty(t, getPage(t, handler, "/plugins?offset=50"))
+
+	// Pages through all the plugins.
+	var all []string
+
+	for offset := 0; offset < len(pluginPaths); offset += 7 {
+		all = append(all, getPage(t, handler, fmt.Sprintf("/plugins?limit=7&offset=%d", offset))...)
+	}
+
+	assert.Equal(t, pluginPaths, all)
+
+	rr, err := getResponse(handler, "GET", "/plugin-manifest?limit=2&offset=3", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "50", rr.Header().Get(TotalCountHeader))
+
+	var statuses []plugins.PluginStatus
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &statuses))
+	assert.Equal(t, manifest[3:5], statuses)
+
+	for _, url := range []string{"/plugins?limit=-1", "/plugins?offset=x", "/plugin-manifest?limit=1.5"} {
+		rr, err := getResponse(handler, "GET", url, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+	}
+
+	// The maximum size caps the page size, and the default of all the plugins.
+	handler = newHandler(5)
+
+	assert.Equal(t, pluginPaths[:5], getPage(t, handler, "/plugins"))
+	assert.Equal(t, pluginPaths[20:25], getPage(t, handler, "/plugins?limit=10&offset=20"))
+	assert.Equal(t, pluginPaths[20:23], getPage(t, handler, "/plugins?limit=3&offset=20"))
+}
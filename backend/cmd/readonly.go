@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// readOnlyMode is the global read-only (maintenance) mode. It is set from the
+// --read-only flag and can be toggled at runtime from the admin endpoint.
+type readOnlyMode struct {
+	enabled int32
+}
+
+// readOnlyReviewPaths are the API paths which take a POST without mutating
+// anything, so they stay allowed in read-only mode. The frontend uses them
+// to check permissions.
+var readOnlyReviewPaths = []string{
+	"/apis/authorization.k8s.io/v1/selfsubjectaccessreviews",
+	"/apis/authorization.k8s.io/v1/selfsubjectrulesreviews",
+}
+
+type readOnlyReq struct {
+	ReadOnly *bool `json:"readOnly"`
+}
+
+type readOnlyResp struct {
+	ReadOnly bool `json:"readOnly"`
+}
+
+func newReadOnlyMode(enabled bool) *readOnlyMode {
+	m := &readOnlyMode{}
+	m.set(enabled)
+
+	return m
+}
+
+// isEnabled returns whether read-only mode is on. A nil mode is off.
+func (m *readOnlyMode) isEnabled() bool {
+	return m != nil && atomic.LoadInt32(&m.enabled) == 1
+}
+
+func (m *readOnlyMode) set(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+
+	atomic.StoreInt32(&m.enabled, value)
+}
+
+// isMutatingMethod returns true for the methods which may change resources.
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkReadOnly rejects the request with a 403 if read-only mode is on.
+// It returns false if the request was rejected.
+func (c *HeadlampConfig) checkReadOnly(w http.ResponseWriter) bool {
+	if !c.readOnly.isEnabled() {
+		return true
+	}
+
+	http.Error(w, "Headlamp is in read-only mode", http.StatusForbidden)
+
+	return false
+}
+
+// checkReadOnlyAPIRequest rejects mutating requests to a cluster API path
+// if read-only mode is on. It returns false if the request was rejected.
+func (c *HeadlampConfig) checkReadOnlyAPIRequest(w http.ResponseWriter, r *http.Request, apiPath string) bool {
+	if !isMutatingMethod(r.Method) {
+		return true
+	}
+
+	if r.Method == http.MethodPost {
+		apiPath = "/" + strings.Trim(apiPath, "/")
+
+		for _, reviewPath := range readOnlyReviewPaths {
+			if apiPath == reviewPath {
+				return true
+			}
+		}
+	}
+
+	return c.checkReadOnly(w)
+}
+
+// handleReadOnly returns the read-only mode on GET, and sets it on PUT with
+// a body like {"readOnly": true}.
+func (c *HeadlampConfig) handleReadOnly(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var req readOnlyReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ReadOnly == nil {
+			http.Error(w, "Error decoding read-only request; please provide a 'readOnly' field.", http.StatusBadRequest)
+			return
+		}
+
+		c.readOnly.set(*req.ReadOnly)
+
+		log.Printf("Read-only mode set to %v", *req.ReadOnly)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(readOnlyResp{ReadOnly: c.readOnly.isEnabled()}); err != nil {
+		log.Println("Error encoding read-only mode", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyMode(t *testing.T) {
+	var upstreamMethods []string
+
+	c, handler, _ := newTestCluster(t, "test", func(w http.ResponseWriter, r *http.Request) {
+		upstreamMethods = append(upstreamMethods, r.Method)
+	}, &HeadlampConfig{
+		enableDynamicClusters: true,
+		readOnly:              newReadOnlyMode(true),
+	})
+
+	rr, err := getResponse(handler, "GET", "/clusters/test/api/v1/pods", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr, err = getResponse(handler, "DELETE", "/clusters/test/api/v1/namespaces/default/pods/a", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr, err = getResponse(handler, "POST", "/clusters/test/apis/authorization.k8s.io/v1/selfsubjectaccessreviews",
+		map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Equal(t, []string{"GET", "POST"}, upstreamMethods)
+
+	server := "https://example.com"
+	name := "new"
+
+	rr, err = getResponseFromRestrictedEndpoint(handler, "POST", "/cluster", ClusterReq{Name: &name, Server: &server})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr, err = getResponse(handler, "POST", "/portforward", map[string]string{"cluster": "test"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr, err = getResponse(handler, "GET", "/config", nil)
+	require.NoError(t, err)
+
+	var config clientConfig
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &config))
+	assert.True(t, config.ReadOnly)
+	assert.False(t, config.IsDyanmicClusterEnabled)
+
+	// Turning read-only mode off requires the backend token on the main listener.
+	rr, err = getResponse(handler, "PUT", "/read-only", map[string]bool{"readOnly": false})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.True(t, c.readOnly.isEnabled())
+
+	// Turning read-only mode off at runtime allows mutations again.
+	rr, err = getResponseFromRestrictedEndpoint(handler, "PUT", "/read-only", map[string]bool{"readOnly": false})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"readOnly": false}`, rr.Body.String())
+
+	rr, err = getResponse(handler, "DELETE", "/clusters/test/api/v1/namespaces/default/pods/a", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+)
+
+// requestLogMode returns how requests proxied to the cluster are logged: the
+// mode of the cluster if it sets one, otherwise the global one.
+func (c *HeadlampConfig) requestLogMode(kContext *kubeconfig.Context) string {
+	if info, err := kContext.HeadlampInfo(); err == nil && info.RequestLog != "" {
+		return info.RequestLog
+	}
+
+	return c.proxyRequestLog
+}
+
+// logProxyRequest logs a request proxied to the cluster, according to the
+// request log mode of the cluster.
+func (c *HeadlampConfig) logProxyRequest(kContext *kubeconfig.Context, clusterName string, r *http.Request) {
+	switch c.requestLogMode(kContext) {
+	case kubeconfig.RequestLogFull:
+		log.Printf("Requesting %s /%s from cluster %s", r.Method, strings.TrimPrefix(r.URL.RequestURI(), "/"), clusterName)
+	case kubeconfig.RequestLogRedacted:
+		log.Printf("Requesting %s %s from cluster %s", r.Method, redactAPIPath(r.URL.Path), clusterName)
+	}
+}
+
+// redactAPIPath replaces the namespace and resource names in a Kubernetes API
+// path with "*", eg. /api/v1/namespaces/default/pods/web/log becomes
+// /api/v1/namespaces/*/pods/*/log.
+func redactAPIPath(apiPath string) string {
+	segments := strings.Split(strings.Trim(apiPath, "/"), "/")
+
+	// Skip the group and version: /api/{version} or /apis/{group}/{version}.
+	start := 0
+
+	switch segments[0] {
+	case "api":
+		start = 2
+	case "apis":
+		start = 3
+	}
+
+	if start == 0 || len(segments) <= start {
+		return apiPath
+	}
+
+	rest := segments[start:]
+
+	if rest[0] == "namespaces" && len(rest) > 1 {
+		rest[1] = "*"
+
+		// /namespaces/{name} is the namespace itself.
+		if len(rest) == 2 {
+			return "/" + strings.Join(segments, "/")
+		}
+
+		rest = rest[2:]
+	}
+
+	// {resource}/{name}/{subresource}
+	if len(rest) > 1 {
+		rest[1] = "*"
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyRequestLog(t *testing.T) {
+	c, handler, upstream := newTestCluster(t, "logged", func(w http.ResponseWriter, r *http.Request) {}, &HeadlampConfig{
+		proxyRequestLog: kubeconfig.RequestLogFull,
+	})
+
+	for name, requestLog := range map[string]string{
+		"sensitive": kubeconfig.RequestLogOff,
+		"redacted":  kubeconfig.RequestLogRedacted,
+	} {
+		addTestCluster(t, c, name, upstream.URL, `{"requestLog": "`+requestLog+`"}`)
+	}
+
+	var logs bytes.Buffer
+
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	for _, cluster := range []string{"logged", "sensitive", "redacted"} {
+		rr, err := getResponse(handler, "GET", "/clusters/"+cluster+"/api/v1/namespaces/secret-ns/pods/secret-pod", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	assert.Contains(t, logs.String(), "GET /api/v1/namespaces/secret-ns/pods/secret-pod from cluster logged")
+	assert.NotContains(t, logs.String(), "from cluster sensitive")
+	assert.Contains(t, logs.String(), "GET /api/v1/namespaces/*/pods/* from cluster redacted")
+
+	redacted := map[string]string{
+		"/api/v1/nodes/node-1":                             "/api/v1/nodes/*",
+		"/api/v1/namespaces/default":                       "/api/v1/namespaces/*",
+		"/api/v1/namespaces/default/pods":                  "/api/v1/namespaces/*/pods",
+		"/apis/apps/v1/namespaces/default/deployments/web": "/apis/apps/v1/namespaces/*/deployments/*",
+		"/api/v1/namespaces/default/pods/web/log":          "/api/v1/namespaces/*/pods/*/log",
+		"/apis/apps/v1/deployments":                        "/apis/apps/v1/deployments",
+	}
+
+	for apiPath, expected := range redacted {
+		assert.Equal(t, expected, redactAPIPath(apiPath), apiPath)
+	}
+}
+
+func TestProxyRequestLogUnknownMode(t *testing.T) {
+	c, handler, upstream := newTestCluster(t, "typo", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("requests to a cluster with an unknown request log mode must not be proxied")
+	}, &HeadlampConfig{
+		proxyRequestLog: kubeconfig.RequestLogFull,
+	})
+
+	addTestCluster(t, c, "typo", upstream.URL, `{"requestLog": "verbose"}`)
+
+	kContext, err := c.kubeConfigStore.GetContext("typo")
+	require.NoError(t, err)
+
+	_, err = kContext.HeadlampInfo()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown requestLog "verbose"`)
+
+	var logs bytes.Buffer
+
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	rr, err := getResponse(handler, "GET", "/clusters/typo/api/v1/namespaces/secret-ns/pods/secret-pod", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.NotContains(t, logs.String(), "secret-pod")
+}
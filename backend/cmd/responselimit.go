@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+)
+
+// errResponseTooLarge is returned when a proxied response exceeds the configured maximum size.
+var errResponseTooLarge = errors.New("proxied response exceeds the maximum size")
+
+// limitedResponseWriter is a http.ResponseWriter that fails writes past a maximum number of bytes.
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	limit   int64
+	written int64
+	path    string
+	// exceeded is set once a write went past the limit.
+	exceeded bool
+}
+
+func (lw *limitedResponseWriter) Write(b []byte) (int, error) {
+	if lw.written+int64(len(b)) > lw.limit {
+		lw.exceeded = true
+		log.Printf("Error: proxied response for %s exceeds the maximum size of %d bytes", lw.path, lw.limit)
+		return 0, errResponseTooLarge
+	}
+
+	n, err := lw.ResponseWriter.Write(b)
+	lw.written += int64(n)
+
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (lw *limitedResponseWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// isStreamingRequest returns true for watches, followed logs and websockets,
+// which are long-lived streams and are not size limited.
+func isStreamingRequest(r *http.Request) bool {
+	query := r.URL.Query()
+
+	return query.Get("watch") == "true" || query.Get("watch") == "1" ||
+		query.Get("follow") == "true" || r.Header.Get("Upgrade") != ""
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyMaxResponseSize(t *testing.T) {
+	const maxSize = 1024
+
+	_, handler, _ := newTestCluster(t, "big", func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write(bytes.Repeat([]byte("x"), 4*maxSize))
+		require.NoError(t, err)
+	}, &HeadlampConfig{
+		proxyMaxResponseSize: maxSize,
+	})
+
+	rr, err := getResponse(handler, "GET", "/clusters/big/api/v1/pods", nil)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, rr.Body.Len(), maxSize)
+
+	// Watches are long-lived streams and are not capped.
+	rr, err = getResponse(handler, "GET", "/clusters/big/api/v1/pods?watch=true", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 4*maxSize, rr.Body.Len())
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// routeInfo describes a route of the router, for /debug/routes.
+type routeInfo struct {
+	// Path is the path template, including the base URL.
+	Path string `json:"path"`
+	// Prefix is set for routes matching any path below Path.
+	Prefix  bool     `json:"prefix,omitempty"`
+	Methods []string `json:"methods,omitempty"`
+	Queries []string `json:"queries,omitempty"`
+}
+
+// listRoutes returns the routes of the router in the order they are matched,
+// skipping the ones without a path, eg. subrouters only matching methods.
+func listRoutes(router *mux.Router) ([]routeInfo, error) {
+	routes := []routeInfo{}
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil //nolint:nilerr
+		}
+
+		info := routeInfo{Path: path}
+
+		if regexp, err := route.GetPathRegexp(); err == nil {
+			info.Prefix = !strings.HasSuffix(regexp, "$")
+		}
+
+		info.Methods, _ = route.GetMethods()
+		info.Queries, _ = route.GetQueriesTemplates()
+
+		routes = append(routes, info)
+
+		return nil
+	})
+
+	return routes, err
+}
+
+// handleDebugRoutes serves the routes of the main router, to find out why a
+// request is not found, eg. with a base URL.
+func (c *HeadlampConfig) handleDebugRoutes(w http.ResponseWriter, r *http.Request) {
+	if c.router == nil {
+		http.Error(w, "the router is not set up", http.StatusServiceUnavailable)
+		return
+	}
+
+	routes, err := listRoutes(c.router)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"baseURL": c.baseURL,
+		"routes":  routes,
+	}); err != nil {
+		log.Println("Error encoding routes", err)
+	}
+}
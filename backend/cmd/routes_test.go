@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterRoutes(t *testing.T) {
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+		RegisterRoutes: func(r *mux.Router) {
+			r.HandleFunc("/sso-bridge", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("bridge"))
+			}).Methods("GET")
+
+			// Built-in routes are matched first.
+			r.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("custom config"))
+			}).Methods("GET")
+		},
+	}
+	handler := createHeadlampHandler(&c)
+
+	rr, err := getResponse(handler, "GET", "/sso-bridge", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "bridge", rr.Body.String())
+
+	rr, err = getResponse(handler, "GET", "/config", nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, "custom config", rr.Body.String())
+}
+
+func TestDebugRoutes(t *testing.T) {
+	handler := createHeadlampHandler(&HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+		baseURL:         "/headlamp",
+	})
+
+	rr, err := getResponse(handler, "GET", "/headlamp/debug/routes", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, rr.Code, "requires the backend token")
+
+	rr, err = getResponseFromRestrictedEndpoint(handler, "GET", "/headlamp/debug/routes", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var dump struct {
+		BaseURL string      `json:"baseURL"`
+		Routes  []routeInfo `json:"routes"`
+	}
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &dump))
+	assert.Equal(t, "/headlamp", dump.BaseURL)
+	assert.Contains(t, dump.Routes, routeInfo{Path: "/headlamp/config", Methods: []string{"GET"}})
+	assert.Contains(t, dump.Routes, routeInfo{Path: "/headlamp/debug/routes", Methods: []string{"GET"}})
+	assert.Contains(t, dump.Routes, routeInfo{
+		Path:    "/headlamp/drain-node-status",
+		Methods: []string{"GET"},
+		Queries: []string{"cluster={cluster}", "nodeName={node}"},
+	})
+	assert.Contains(t, dump.Routes, routeInfo{Path: "/headlamp/clusters/{clusterName}/{api:.*}", Prefix: true})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/portforward"
+)
+
+// jsonSchemaDialect is the JSON Schema version of the documents of /schema.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// apiSchemaTypes are the request and response types /schema describes, by name.
+var apiSchemaTypes = map[string]reflect.Type{
+	"ClusterReq":         reflect.TypeOf(ClusterReq{}),
+	"PortForwardPayload": reflect.TypeOf(portforward.PortForwardPayload{}),
+	"Config":             reflect.TypeOf(clientConfig{}),
+}
+
+// handleSchema returns JSON Schema documents of the request and response types
+// of the API, as machine-readable documentation for integrators.
+func handleSchema(w http.ResponseWriter, r *http.Request) {
+	defs := make(map[string]interface{}, len(apiSchemaTypes))
+
+	for name, t := range apiSchemaTypes {
+		defs[name] = jsonSchema(t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"$schema": jsonSchemaDialect,
+		"$defs":   defs,
+	}); err != nil {
+		log.Println("Error encoding the schema", err)
+	}
+}
+
+// jsonSchema returns the JSON Schema of the JSON encoding of values of type t.
+// Struct fields are required unless they are tagged omitempty.
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		// Byte slices are encoded as base64 strings.
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		// Any value, eg. for interface{}.
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema returns the JSON Schema of a struct, from the json tags of its
+// exported fields.
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = jsonSchema(field.Type)
+
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
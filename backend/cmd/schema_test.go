@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema(t *testing.T) {
+	handler := createHeadlampHandler(&HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+	})
+
+	req, err := http.NewRequestWithContext(context.Background(), "GET", "/schema", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var schema struct {
+		Schema string `json:"$schema"`
+		Defs   map[string]struct {
+			Type       string                            `json:"type"`
+			Properties map[string]map[string]interface{} `json:"properties"`
+			Required   []string                          `json:"required"`
+		} `json:"$defs"`
+	}
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &schema))
+	assert.Equal(t, jsonSchemaDialect, schema.Schema)
+
+	clusterReq := schema.Defs["ClusterReq"]
+	assert.Equal(t, "object", clusterReq.Type)
+	assert.ElementsMatch(t, []string{"name", "server", "meta_data"}, clusterReq.Required)
+	assert.Equal(t, "string", clusterReq.Properties["certificate-authority-data"]["type"])
+	assert.Equal(t, "boolean", clusterReq.Properties["insecure-skip-tls-verify"]["type"])
+
+	payload := schema.Defs["PortForwardPayload"]
+	assert.Contains(t, payload.Required, "cluster")
+	assert.Contains(t, payload.Required, "targetPort")
+	assert.NotContains(t, payload.Required, "podDNSName")
+
+	config := schema.Defs["Config"]
+	assert.ElementsMatch(t, []string{"clusters", "isDynamicClusterEnabled", "readOnly", "baseURL"}, config.Required)
+	assert.Equal(t, "array", config.Properties["clusters"]["type"])
+	assert.Contains(t, config.Properties["clusters"]["items"].(map[string]interface{})["required"], "name")
+}
@@ -17,9 +17,8 @@ func main() {
 	}
 
 	cache := cache.New[interface{}]()
-	kubeConfigStore := kubeconfig.NewContextStore()
 
-	StartHeadlampServer(&HeadlampConfig{
+	config := &HeadlampConfig{
 		useInCluster:          conf.InCluster,
 		kubeConfigPath:        conf.KubeConfigPath,
 		port:                  conf.Port,
@@ -33,9 +32,87 @@ func main() {
 		oidcScopes:            strings.Split(conf.OidcScopes, ","),
 		baseURL:               conf.BaseURL,
 		proxyURLs:             strings.Split(conf.ProxyURLs, ","),
+		proxyOrigins:          strings.Split(conf.ProxyURLOrigins, ","),
 		enableHelm:            conf.EnableHelm,
 		enableDynamicClusters: conf.EnableDynamicClusters,
+		portForwardKeepAlive:  conf.PortForwardKeepAlive,
+		userAgent:             conf.UserAgent,
+		discoveryCacheTTL:     conf.DiscoveryCacheTTL,
+		adminAddr:             conf.AdminAddr,
+		portForwardBufferSize: int(conf.PortForwardBufferSize),
+		kubectlProxyPath:      conf.KubectlProxyPath,
+		baseURLRedirectCode:   int(conf.BaseURLRedirectCode),
+		redirectToBaseURL:     conf.RedirectToBaseURL,
+		portForwardJitter:     conf.PortForwardJitter,
+		errorPage:             conf.ErrorPage,
+		disablePluginWatch:    conf.DisablePluginWatch,
+		proxyMaxResponseSize:  int64(conf.ProxyMaxResponseSize),
+		shareSecret:           []byte(conf.ShareSecret),
+		shareTTL:              conf.ShareTTL,
+		portForwardAddress:    conf.PortForwardAddress,
+		enableTracing:         conf.EnableTracing,
+		tracingEndpoint:       conf.OTLPEndpoint,
+		maxLogStreams:         int(conf.MaxLogStreams),
+		oidcDiscoveryTTL:      conf.OidcDiscoveryTTL,
+		forbidInsecure:        conf.ForbidInsecure,
+		upgradeIdleTimeout:    conf.UpgradeIdleTimeout,
+		readOnly:              newReadOnlyMode(conf.ReadOnly),
+		crdCacheTTL:           conf.CRDCacheTTL,
+		proxyRequestLog:       conf.ProxyRequestLog,
+		metricsUsername:       conf.MetricsUsername,
+		metricsPassword:       conf.MetricsPassword,
+		metricsToken:          conf.MetricsToken,
+		maxURLLength:          int(conf.MaxURLLength),
+		logBufferLines:        int(conf.LogBufferLines),
+		clusterSetupRetry:     conf.ClusterSetupRetry,
+		methodOverride:        conf.MethodOverride,
+		inClusterCARefresh:    conf.InClusterCARefresh,
+		noAPIIndexFallback:    conf.NoAPIIndexFallback,
+		strippedHeaders:       strings.Split(conf.StripResponseHeaders, ","),
+		oidcRequiredClaims:    strings.Split(conf.OidcRequiredClaims, ","),
+		enableErrorReports:    conf.EnableErrorReports,
+		portForwardTimeout:    conf.PortForwardTimeout,
+		extraCADir:            conf.ExtraCADir,
+		ignoreClientAuth:      conf.IgnoreClientAuth,
+		proxyRetries:          conf.ProxyRetries,
+		proxyRetryBackoff:     conf.ProxyRetryBackoff,
+		maxWatches:            int(conf.MaxWatches),
+		cookieSecure:          conf.CookieSecure,
+		cookieSameSite:        conf.CookieSameSite,
+		cookieDomain:          conf.CookieDomain,
+		cookiePath:            conf.CookiePath,
+		maxPlugins:            int(conf.MaxPlugins),
+		maxPluginListSize:     int(conf.MaxPluginListSize),
+		portForwardGrace:      conf.PortForwardGrace,
+		oidcMaxLogins:         int(conf.OidcMaxLogins),
+		oidcClockSkew:         conf.OidcClockSkew,
+		enableTLSInfo:         conf.EnableTLSInfo,
+		portForwardSetups:     int(conf.PortForwardSetups),
+		portForwardQueueWait:  conf.PortForwardQueueWait,
+		oidcAuthPath:          conf.OidcAuthPath,
+		dnsCacheTTL:           conf.DNSCacheTTL,
+		accessLogFormat:       conf.AccessLogFormat,
+		accessLogFile:         conf.AccessLogFile,
+		maxConnections:        int(conf.MaxConnections),
+		corsAllowedOrigins:    strings.Split(conf.CORSAllowedOrigins, ","),
+		filterClustersByGroup: conf.FilterClustersByGroup,
+		headlessRoot:          conf.HeadlessRoot,
+		proxyMaxConnsPerHost:  int(conf.ProxyMaxConnsPerHost),
+		proxyMaxIdleConns:     int(conf.ProxyMaxIdleConns),
+		proxyNoKeepAlives:     conf.ProxyNoKeepAlives,
+		lazyProxySetup:        conf.LazyProxySetup,
+		keepProxyBaseURL:      conf.KeepProxyBaseURL,
+		gunzipExternalProxy:   conf.GunzipExternalProxy,
 		cache:                 cache,
-		kubeConfigStore:       kubeConfigStore,
-	})
+		inClusterOptions: kubeconfig.InClusterOptions{
+			TokenFile: conf.InClusterTokenFile,
+			CAFile:    conf.InClusterCAFile,
+			APIServer: conf.InClusterAPIServer,
+		},
+	}
+
+	// The contexts reach their clusters with the settings of the config.
+	config.kubeConfigStore = kubeconfig.NewContextStoreWithOptions(config.contextOptions())
+
+	StartHeadlampServer(config)
 }
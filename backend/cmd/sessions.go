@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// session is an OIDC login whose refresh token is stored by Headlamp.
+type session struct {
+	ID       string    `json:"id"`
+	Subject  string    `json:"subject"`
+	Cluster  string    `json:"cluster"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"lastUsed"`
+	// token is the current ID token of the session, which its refresh token
+	// is cached under.
+	token string
+	// expiry is when the current ID token expires.
+	expiry time.Time
+	// groups are the groups of the verified ID token the session logged in with.
+	groups []string
+}
+
+// sessionStore keeps track of the OIDC sessions, so admins can list and
+// revoke them.
+type sessionStore struct {
+	lock     sync.Mutex
+	sessions map[string]*session
+	// revoked are the ID tokens of revoked sessions, until they expire.
+	revoked map[string]time.Time
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{
+		sessions: make(map[string]*session),
+		revoked:  make(map[string]time.Time),
+	}
+}
+
+// tokenExpiry returns the expiry of a JWT, from its unverified claims, or
+// the zero time if it has none.
+func tokenExpiry(token string) time.Time {
+	exp, ok := jwtClaims(token)["exp"].(float64)
+	if !ok {
+		return time.Time{}
+	}
+
+	return time.Unix(int64(exp), 0)
+}
+
+// add records a new session logged in to the cluster with the verified ID
+// token, whose subject is in the groups.
+func (s *sessionStore) add(subject, cluster, token string, groups []string) *session {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	s.pruneExpired(now)
+
+	sess := &session{
+		ID:       uuid.New().String(),
+		Subject:  subject,
+		Cluster:  cluster,
+		Created:  now,
+		LastUsed: now,
+		token:    token,
+		expiry:   tokenExpiry(token),
+		groups:   groups,
+	}
+
+	s.sessions[sess.ID] = sess
+
+	return sess
+}
+
+// refreshed updates the session of an ID token which was refreshed.
+func (s *sessionStore) refreshed(oldToken, newToken string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, sess := range s.sessions {
+		if sess.token == oldToken {
+			sess.token = newToken
+			sess.expiry = tokenExpiry(newToken)
+			sess.LastUsed = time.Now()
+
+			return
+		}
+	}
+}
+
+// identity returns the identity of the session of an unexpired ID token, or
+// false if the token is not the one of a session.
+func (s *sessionStore) identity(token string) (identity, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.pruneExpired(time.Now())
+
+	for _, sess := range s.sessions {
+		if sess.token == token {
+			return identity{Type: "oidc", Subject: sess.Subject, Username: sess.Subject, Groups: sess.groups}, true
+		}
+	}
+
+	return identity{}, false
+}
+
+// pruneExpired forgets the sessions whose ID token expired without being
+// refreshed, as they are over. The lock must be held.
+func (s *sessionStore) pruneExpired(now time.Time) {
+	for id, sess := range s.sessions {
+		if !sess.expiry.IsZero() && now.After(sess.expiry) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// list returns the sessions, oldest first.
+func (s *sessionStore) list() []session {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.pruneExpired(time.Now())
+
+	sessions := make([]session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, *sess)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Created.Before(sessions[j].Created) })
+
+	return sessions
+}
+
+// revoke removes a session and marks its ID token revoked. It returns the
+// removed session, or false if there is none with that ID.
+func (s *sessionStore) revoke(id string) (session, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return session{}, false
+	}
+
+	delete(s.sessions, id)
+
+	s.revoked[sess.token] = sess.expiry
+
+	return *sess, true
+}
+
+// isRevoked tells whether an ID token is the one of a revoked session.
+// Revoked tokens are forgotten once they expire, as they are rejected anyway.
+func (s *sessionStore) isRevoked(token string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+
+	for revokedToken, expiry := range s.revoked {
+		if !expiry.IsZero() && now.After(expiry) {
+			delete(s.revoked, revokedToken)
+		}
+	}
+
+	_, revoked := s.revoked[token]
+
+	return revoked
+}
+
+// requireBackendToken only lets requests with the backend token through.
+func requireBackendToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := checkHeadlampBackendToken(w, r); err != nil {
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// rejectRevokedSessions rejects every request with the ID token of a revoked
+// session, whichever route it is for.
+func (c *HeadlampConfig) rejectRevokedSessions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token != "" && c.sessions.isRevoked(token) {
+			http.Error(w, "session revoked", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// addSessionRoutes adds the endpoints listing and revoking sessions.
+func (c *HeadlampConfig) addSessionRoutes(r *mux.Router) {
+	r.HandleFunc("/admin/sessions", requireBackendToken(c.handleListSessions)).Methods("GET")
+	r.HandleFunc("/admin/sessions/{id}", requireBackendToken(c.handleRevokeSession)).Methods("DELETE")
+}
+
+func (c *HeadlampConfig) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(c.sessions.list()); err != nil {
+		log.Println("Error encoding sessions", err)
+	}
+}
+
+// handleRevokeSession revokes a session: its refresh token is dropped, so it
+// can't be refreshed anymore, and requests with its ID token are rejected.
+func (c *HeadlampConfig) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	sess, ok := c.sessions.revoke(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	if err := c.cache.Delete(context.Background(), fmt.Sprintf("oidc-token-%s", sess.token)); err != nil {
+		log.Printf("Error deleting the refresh token of session %s: %v", sess.ID, err)
+	}
+
+	log.Printf("Revoked session %s of %q on cluster %s", sess.ID, sess.Subject, sess.Cluster)
+
+	w.WriteHeader(http.StatusNoContent)
+}
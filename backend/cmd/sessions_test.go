@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//nolint:funlen
+func TestSessions(t *testing.T) {
+	c, handler, _ := newTestCluster(t, "oidc-cluster", func(w http.ResponseWriter, r *http.Request) {}, nil)
+
+	payload, err := json.Marshal(map[string]interface{}{"sub": "jane", "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+
+	idToken := "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+
+	sess := c.sessions.add("jane", "oidc-cluster", idToken, nil)
+	require.NoError(t, c.cache.Set(context.Background(), "oidc-token-"+idToken, "refresh-token"))
+
+	clusterStatus := func() int {
+		req, err := http.NewRequestWithContext(context.Background(), "GET", "/clusters/oidc-cluster/version", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+idToken)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, clusterStatus())
+
+	t.Run("requires_backend_token", func(t *testing.T) {
+		rr, err := getResponse(handler, "GET", "/admin/sessions", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr, err = getResponse(handler, "DELETE", "/admin/sessions/"+sess.ID, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		rr, err := getResponseFromRestrictedEndpoint(handler, "GET", "/admin/sessions", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var sessions []session
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sessions))
+		require.Len(t, sessions, 1)
+		assert.Equal(t, sess.ID, sessions[0].ID)
+		assert.Equal(t, "jane", sessions[0].Subject)
+		assert.Equal(t, "oidc-cluster", sessions[0].Cluster)
+		assert.False(t, sessions[0].Created.IsZero())
+		assert.False(t, sessions[0].LastUsed.IsZero())
+		assert.NotContains(t, rr.Body.String(), idToken)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		rr, err := getResponseFromRestrictedEndpoint(handler, "DELETE", "/admin/sessions/"+sess.ID, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		_, err = c.cache.Get(context.Background(), "oidc-token-"+idToken)
+		assert.Error(t, err, "the refresh token is dropped")
+		assert.Empty(t, c.sessions.list())
+		assert.Equal(t, http.StatusUnauthorized, clusterStatus())
+
+		// Every route rejects the token, not only the cluster proxy.
+		for _, route := range []struct{ method, url string }{
+			{"GET", "/clusters/oidc-cluster/crds"},
+			{"POST", "/clusters/oidc-cluster/token-check"},
+			{"GET", "/portforward/check?cluster=oidc-cluster&namespace=default&pod=web&targetPort=80"},
+			{"POST", "/portforward"},
+		} {
+			req, err := http.NewRequestWithContext(context.Background(), route.method, route.url, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+idToken)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusUnauthorized, rr.Code, route.url)
+		}
+
+		rr, err = getResponseFromRestrictedEndpoint(handler, "DELETE", "/admin/sessions/"+sess.ID, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("expired_sessions_are_pruned", func(t *testing.T) {
+		payload, err := json.Marshal(map[string]interface{}{"sub": "joe", "exp": time.Now().Add(-time.Minute).Unix()})
+		require.NoError(t, err)
+
+		expiredToken := "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+
+		c.sessions.add("joe", "oidc-cluster", expiredToken, nil)
+
+		assert.Empty(t, c.sessions.list())
+
+		_, ok := c.sessions.identity(expiredToken)
+		assert.False(t, ok)
+	})
+}
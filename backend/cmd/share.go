@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/config"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/utils"
+)
+
+// ShareCookieName is the cookie holding the share token of a shared session.
+const ShareCookieName = "headlamp-share"
+
+var (
+	errShareTokenInvalid = errors.New("invalid share token")
+	errShareTokenExpired = errors.New("share token expired")
+)
+
+// shareReadOnlyMethods are the methods a shared session may use.
+var shareReadOnlyMethods = []string{http.MethodGet, http.MethodHead}
+
+// sharedAPIPrefixes are the API paths, of apiPathPrefixes, a shared session may
+// use: its cluster, and the plugins to show it. Others, eg. port forwards or
+// the external proxy, are not shared.
+var sharedAPIPrefixes = []string{"/clusters", "/plugins", "/static-plugins", "/plugin-manifest"}
+
+// shareClaims is the signed payload of a share token.
+type shareClaims struct {
+	Cluster   string `json:"cluster"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type shareReq struct {
+	Cluster string `json:"cluster"`
+}
+
+type shareResp struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// newShareSecret returns a random secret, used when none is configured.
+// Links signed with it stop working when the server restarts.
+func newShareSecret() []byte {
+	secret := make([]byte, sha256.Size)
+
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Error generating share secret: %v", err)
+	}
+
+	return secret
+}
+
+// signShareToken returns a token for the claims, in the form
+// base64(claims) + "." + base64(HMAC-SHA256(base64(claims))).
+func signShareToken(secret []byte, claims shareClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(shareSignature(secret, encoded)), nil
+}
+
+func shareSignature(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+
+	return mac.Sum(nil)
+}
+
+// verifyShareToken checks the signature and expiry of a token and returns its claims.
+func verifyShareToken(secret []byte, token string, now time.Time) (*shareClaims, error) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, errShareTokenInvalid
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, shareSignature(secret, payload)) {
+		return nil, errShareTokenInvalid
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errShareTokenInvalid
+	}
+
+	var claims shareClaims
+	if err := json.Unmarshal(decoded, &claims); err != nil || claims.Cluster == "" {
+		return nil, errShareTokenInvalid
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, errShareTokenExpired
+	}
+
+	return &claims, nil
+}
+
+// addShareRoutes adds the endpoints to mint and consume share links.
+func (c *HeadlampConfig) addShareRoutes(r *mux.Router) {
+	r.HandleFunc("/share", requireBackendToken(c.createShareLink)).Methods("POST")
+	r.HandleFunc("/share", c.openShareLink).Methods("GET")
+}
+
+// createShareLink mints a link giving read-only access to one cluster until it
+// expires. Shared sessions can't mint links, as they are read-only.
+func (c *HeadlampConfig) createShareLink(w http.ResponseWriter, r *http.Request) {
+	var req shareReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Cluster == "" {
+		http.Error(w, "Error decoding share request; please provide a 'cluster' field.", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := c.kubeConfigStore.GetContext(req.Cluster); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	ttl := c.shareTTL
+	if ttl <= 0 {
+		ttl = config.DefaultShareTTL
+	}
+
+	expiresAt := time.Now().Add(ttl)
+
+	token, err := signShareToken(c.shareSecret, shareClaims{Cluster: req.Cluster, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	resp := shareResp{
+		URL:       c.baseURL + "/share?token=" + url.QueryEscape(token),
+		ExpiresAt: expiresAt.UTC(),
+	}
+
+	if err := json.NewEncoder(w).Encode(&resp); err != nil {
+		log.Println("Error encoding share link", err)
+	}
+}
+
+// openShareLink exchanges a share token for a shared session cookie and
+// redirects to the shared cluster.
+func (c *HeadlampConfig) openShareLink(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	claims, err := verifyShareToken(c.shareSecret, token, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	http.SetCookie(w, c.authCookie(ShareCookieName, token, time.Unix(claims.ExpiresAt, 0)))
+
+	http.Redirect(w, r, c.baseURL+"/c/"+url.PathEscape(claims.Cluster)+"/", http.StatusFound)
+}
+
+// restrictSharedSessions restricts every request of a shared session, the
+// ones with a share cookie, with checkShareSession. Other requests are not
+// affected: the share cookie only restricts what the browser it was set in
+// can do, it doesn't grant anything other clients don't have.
+func (c *HeadlampConfig) restrictSharedSessions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(ShareCookieName)
+		if err != nil || c.checkShareSession(w, r, cookie.Value) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// checkShareSession restricts a request of the shared session of the token to
+// read-only requests to the shared cluster, or to the frontend and its plugins.
+// It writes an error and returns false if the request is not allowed.
+func (c *HeadlampConfig) checkShareSession(w http.ResponseWriter, r *http.Request, token string) bool {
+	claims, err := verifyShareToken(c.shareSecret, token, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+
+	if !utils.Contains(shareReadOnlyMethods, r.Method) {
+		http.Error(w, "shared sessions are read-only", http.StatusForbidden)
+		return false
+	}
+
+	if prefix := c.apiPathPrefix(r.URL.Path); prefix != "" && !utils.Contains(sharedAPIPrefixes, prefix) {
+		http.Error(w, "not available to shared sessions", http.StatusForbidden)
+		return false
+	}
+
+	// Routes of a cluster name it in the path, or in the "cluster" parameter.
+	cluster := mux.Vars(r)["clusterName"]
+	if cluster == "" {
+		cluster = r.URL.Query().Get("cluster")
+	}
+
+	if cluster != claims.Cluster && (cluster != "" || c.apiPathPrefix(r.URL.Path) == "/clusters") {
+		http.Error(w, "cluster is not shared with this session", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// apiPathPrefix returns the prefix of apiPathPrefixes the path is under, after
+// the base URL, or "" for frontend paths.
+func (c *HeadlampConfig) apiPathPrefix(urlPath string) string {
+	urlPath = strings.TrimPrefix(urlPath, c.baseURL)
+
+	for _, prefix := range apiPathPrefixes {
+		if urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/") {
+			return prefix
+		}
+	}
+
+	return ""
+}
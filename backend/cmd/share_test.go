@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//nolint:funlen
+func TestShareLinks(t *testing.T) {
+	c, handler, upstream := newTestCluster(t, "shared", func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(r.Method + " " + r.URL.Path))
+		require.NoError(t, err)
+	}, &HeadlampConfig{
+		shareSecret: []byte("test-secret"),
+	})
+	addTestCluster(t, c, "private", upstream.URL, "")
+
+	sharedRequest := func(method, url string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(context.Background(), method, url, nil)
+		require.NoError(t, err)
+		req.AddCookie(cookie)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	// Minting
+	rr, err := getResponse(handler, "POST", "/share", map[string]string{"cluster": "shared"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr, err = getResponseFromRestrictedEndpoint(handler, "POST", "/share", map[string]string{"cluster": "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr, err = getResponseFromRestrictedEndpoint(handler, "POST", "/share", map[string]string{"cluster": "shared"})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var share shareResp
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &share))
+	assert.True(t, strings.HasPrefix(share.URL, "/share?token="))
+	assert.True(t, share.ExpiresAt.After(time.Now()))
+
+	// Consuming
+	rr, err = getResponse(handler, "GET", share.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "/c/shared/", rr.Header().Get("Location"))
+
+	cookies := rr.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, ShareCookieName, cookies[0].Name)
+
+	rr = sharedRequest("GET", "/clusters/shared/api/v1/pods", cookies[0])
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "GET /api/v1/pods", rr.Body.String())
+
+	// Method and cluster restrictions
+	rr = sharedRequest("DELETE", "/clusters/shared/api/v1/namespaces/default/pods/a", cookies[0])
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = sharedRequest("GET", "/clusters/private/api/v1/pods", cookies[0])
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = sharedRequest("POST", "/share", cookies[0])
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// Every route is restricted, not only the cluster proxy.
+	for _, path := range []string{
+		"/externalproxy",
+		"/portforward/list?cluster=shared",
+		"/clusters/private/crds",
+	} {
+		rr = sharedRequest("GET", path, cookies[0])
+		assert.Equal(t, http.StatusForbidden, rr.Code, path)
+	}
+
+	rr = sharedRequest("POST", "/clusters/shared/token-check", cookies[0])
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = sharedRequest("GET", "/config", cookies[0])
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Requests without a shared session are not restricted.
+	rr, err = getResponse(handler, "DELETE", "/clusters/private/api/v1/namespaces/default/pods/a", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Expiry
+	expiredClaims := shareClaims{Cluster: "shared", ExpiresAt: time.Now().Add(-time.Minute).Unix()}
+	expired, err := signShareToken(c.shareSecret, expiredClaims)
+	require.NoError(t, err)
+
+	rr, err = getResponse(handler, "GET", "/share?token="+expired, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = sharedRequest("GET", "/clusters/shared/api/v1/pods", &http.Cookie{Name: ShareCookieName, Value: expired})
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Tokens signed with another secret are rejected.
+	forgedClaims := shareClaims{Cluster: "shared", ExpiresAt: share.ExpiresAt.Unix()}
+	forged, err := signShareToken([]byte("other-secret"), forgedClaims)
+	require.NoError(t, err)
+
+	rr, err = getResponse(handler, "GET", "/share?token="+forged, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
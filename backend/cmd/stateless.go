@@ -94,7 +94,8 @@ func (c *HeadlampConfig) parseKubeConfig(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	clientConfig := clientConfig{contexts, c.enableDynamicClusters}
+	readOnly := c.readOnly.isEnabled()
+	clientConfig := clientConfig{contexts, c.enableDynamicClusters && !readOnly, readOnly, frontendBaseURL(c.baseURL)}
 
 	if err := json.NewEncoder(w).Encode(&clientConfig); err != nil {
 		log.Println("Error encoding config", err)
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// tlsInfoDialTimeout is how long connecting to the API server of a cluster may
+// take when getting its certificate.
+const tlsInfoDialTimeout = 10 * time.Second
+
+// tlsInfo describes the leaf certificate an API server presents.
+type tlsInfo struct {
+	Server      string    `json:"server"`
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	DNSNames    []string  `json:"dnsNames"`
+	IPAddresses []string  `json:"ipAddresses"`
+	NotBefore   time.Time `json:"notBefore"`
+	NotAfter    time.Time `json:"notAfter"`
+}
+
+// handleTLSInfo returns the certificate the API server of the cluster presents,
+// to troubleshoot TLS errors. The certificate is only reported, not verified.
+func (c *HeadlampConfig) handleTLSInfo(w http.ResponseWriter, r *http.Request) {
+	clusterName := mux.Vars(r)["clusterName"]
+
+	kContext, err := c.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		http.Error(w, err.Error(), clusterErrorStatus(err))
+		return
+	}
+
+	info, err := getTLSInfo(r.Context(), kContext.Cluster.Server, kContext.Cluster.TLSServerName)
+	if err != nil {
+		log.Printf("Error getting the TLS certificate of cluster %s: %s", clusterName, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		log.Println("Error encoding TLS info", err)
+	}
+}
+
+// getTLSInfo connects to the server URL and returns the leaf certificate it
+// presents for serverName, or for the host of the URL if it is empty.
+func getTLSInfo(ctx context.Context, server, serverName string) (*tlsInfo, error) {
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverURL.Scheme != "https" {
+		return nil, fmt.Errorf("server %q does not use TLS", server)
+	}
+
+	address := serverURL.Host
+	if serverURL.Port() == "" {
+		address = net.JoinHostPort(serverURL.Hostname(), "443")
+	}
+
+	if serverName == "" {
+		serverName = serverURL.Hostname()
+	}
+
+	dialer := tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: tlsInfoDialTimeout},
+		// The certificate is reported, whether it is trusted or not.
+		Config: &tls.Config{ServerName: serverName, InsecureSkipVerify: true}, //nolint:gosec
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("server %q presented no certificate", server)
+	}
+
+	leaf := certs[0]
+
+	info := &tlsInfo{
+		Server:      address,
+		Subject:     leaf.Subject.String(),
+		Issuer:      leaf.Issuer.String(),
+		DNSNames:    leaf.DNSNames,
+		IPAddresses: []string{},
+		NotBefore:   leaf.NotBefore,
+		NotAfter:    leaf.NotAfter,
+	}
+
+	for _, ip := range leaf.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+
+	if info.DNSNames == nil {
+		info.DNSNames = []string{}
+	}
+
+	return info, nil
+}
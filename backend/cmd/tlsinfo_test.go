@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestTLSInfo(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("proxied"))
+	}))
+	defer upstream.Close()
+
+	leaf := upstream.Certificate()
+
+	for _, enabled := range []bool{true, false} {
+		c := HeadlampConfig{
+			cache:           cache.New[interface{}](),
+			kubeConfigStore: kubeconfig.NewContextStore(),
+			enableTLSInfo:   enabled,
+		}
+
+		// The cluster doesn't trust the certificate, it is reported anyway.
+		require.NoError(t, c.kubeConfigStore.AddContext(&kubeconfig.Context{
+			Name:        "tls",
+			KubeContext: &api.Context{Cluster: "tls"},
+			Cluster:     &api.Cluster{Server: upstream.URL, InsecureSkipTLSVerify: true},
+		}))
+
+		handler := createHeadlampHandler(&c)
+
+		rr, err := getResponse(handler, "GET", "/clusters/tls/tls-info", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		if !enabled {
+			assert.Equal(t, "proxied", rr.Body.String())
+			continue
+		}
+
+		var info tlsInfo
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &info))
+
+		assert.Equal(t, strings.TrimPrefix(upstream.URL, "https://"), info.Server)
+		assert.Equal(t, leaf.Subject.String(), info.Subject)
+		assert.Equal(t, leaf.Issuer.String(), info.Issuer)
+		assert.Equal(t, leaf.DNSNames, info.DNSNames)
+		assert.Contains(t, info.IPAddresses, "127.0.0.1")
+		assert.True(t, leaf.NotAfter.Equal(info.NotAfter))
+		assert.True(t, leaf.NotBefore.Equal(info.NotBefore))
+	}
+
+	_, err := getTLSInfo(context.Background(), "http://plain.example.com", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authenticationv1beta1 "k8s.io/api/authentication/v1beta1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// tokenCheck is the response of /clusters/{clusterName}/token-check.
+type tokenCheck struct {
+	Authenticated bool `json:"authenticated"`
+	// Username and Groups are the user the token authenticates as, if the
+	// cluster supports SelfSubjectReviews.
+	Username string   `json:"username,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// checkToken tells whether the cluster accepts the token of the clientset and
+// who it authenticates as, with a SelfSubjectReview. Clusters older than 1.27
+// without one answer whether it authenticates with a SelfSubjectAccessReview,
+// which any authenticated user can create.
+func checkToken(ctx context.Context, clientset kubernetes.Interface) (tokenCheck, error) {
+	var userInfo authenticationv1.UserInfo
+
+	review, err := clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx,
+		&authenticationv1.SelfSubjectReview{}, v1.CreateOptions{})
+	if err == nil {
+		userInfo = review.Status.UserInfo
+	}
+
+	if apierrors.IsNotFound(err) {
+		var betaReview *authenticationv1beta1.SelfSubjectReview
+
+		betaReview, err = clientset.AuthenticationV1beta1().SelfSubjectReviews().Create(ctx,
+			&authenticationv1beta1.SelfSubjectReview{}, v1.CreateOptions{})
+		if err == nil {
+			userInfo = betaReview.Status.UserInfo
+		}
+	}
+
+	if apierrors.IsNotFound(err) {
+		_, err = clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx,
+			&authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					NonResourceAttributes: &authorizationv1.NonResourceAttributes{Path: "/version", Verb: "get"},
+				},
+			}, v1.CreateOptions{})
+	}
+
+	if apierrors.IsUnauthorized(err) {
+		return tokenCheck{}, nil
+	}
+
+	if err != nil {
+		return tokenCheck{}, err
+	}
+
+	return tokenCheck{Authenticated: true, Username: userInfo.Username, Groups: userInfo.Groups}, nil
+}
+
+// tokenOnlyConfig returns a copy of restConf authenticating with the token
+// only, without the credentials of the context.
+func tokenOnlyConfig(restConf *rest.Config, token string) *rest.Config {
+	tokenConf := rest.AnonymousClientConfig(restConf)
+	tokenConf.BearerToken = token
+	// Keeps the paths of the cluster restricted to the allowed ones.
+	tokenConf.WrapTransport = restConf.WrapTransport
+
+	// Custom transports carry the TLS settings of the context, eg. a pinned
+	// certificate, which may include its client certificate.
+	if transport, ok := restConf.Transport.(*http.Transport); ok {
+		transport = transport.Clone()
+		if transport.TLSClientConfig != nil {
+			transport.TLSClientConfig.Certificates = nil
+			transport.TLSClientConfig.GetClientCertificate = nil
+		}
+
+		tokenConf.Transport = transport
+	}
+
+	return tokenConf
+}
+
+// handleTokenCheck tells whether the cluster accepts the token of the request
+// body, {"token": "..."}, for the frontend to check it before using it. Only
+// the token is sent to the cluster, not the credentials of the context, and it
+// is not stored.
+func (c *HeadlampConfig) handleTokenCheck(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Token == "" {
+		http.Error(w, "a token is required", http.StatusBadRequest)
+		return
+	}
+
+	kContext, err := c.kubeConfigStore.GetContext(mux.Vars(r)["clusterName"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	restConf, err := kContext.RESTConfig()
+	if err != nil {
+		http.Error(w, "Error getting client", clusterErrorStatus(err))
+		return
+	}
+
+	clientset, err := kubernetes.NewForConfig(tokenOnlyConfig(restConf, body.Token))
+	if err != nil {
+		http.Error(w, "Error getting client", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := checkToken(r.Context(), clientset)
+	if err != nil {
+		log.Printf("Error checking a token for cluster %s: %s", kContext.Name, err)
+
+		status := http.StatusBadGateway
+		if errors.Is(err, kubeconfig.ErrPathNotAllowed) {
+			status = http.StatusForbidden
+		}
+
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Println("Error encoding token check", err)
+	}
+}
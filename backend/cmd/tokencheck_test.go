@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestTokenCheck(t *testing.T) {
+	writeJSON := func(w http.ResponseWriter, status int, obj interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(obj)
+	}
+
+	// newAPIServer returns an API server accepting the token "good", with
+	// SelfSubjectReviews unless it is legacy.
+	newAPIServer := func(legacy bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer good" {
+				writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+					"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "Unauthorized", "code": 401,
+				})
+
+				return
+			}
+
+			switch {
+			case r.URL.Path == "/apis/authentication.k8s.io/v1/selfsubjectreviews" && !legacy:
+				writeJSON(w, http.StatusCreated, map[string]interface{}{
+					"kind": "SelfSubjectReview", "apiVersion": "authentication.k8s.io/v1",
+					"status": map[string]interface{}{
+						"userInfo": map[string]interface{}{"username": "jane", "groups": []string{"dev"}},
+					},
+				})
+			case r.URL.Path == "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews":
+				writeJSON(w, http.StatusCreated, map[string]interface{}{
+					"kind": "SelfSubjectAccessReview", "apiVersion": "authorization.k8s.io/v1",
+					"status": map[string]interface{}{"allowed": true},
+				})
+			default:
+				writeJSON(w, http.StatusNotFound, map[string]interface{}{
+					"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404,
+				})
+			}
+		}))
+	}
+
+	current := newAPIServer(false)
+	defer current.Close()
+
+	legacy := newAPIServer(true)
+	defer legacy.Close()
+
+	c := HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+	}
+	handler := createHeadlampHandler(&c)
+
+	for name, server := range map[string]string{"current": current.URL, "legacy": legacy.URL} {
+		require.NoError(t, c.kubeConfigStore.AddContext(&kubeconfig.Context{
+			Name:        name,
+			KubeContext: &api.Context{Cluster: name, AuthInfo: name},
+			Cluster:     &api.Cluster{Server: server},
+			// The credentials of the context are not sent along.
+			AuthInfo: &api.AuthInfo{Token: "good"},
+		}))
+	}
+
+	checkToken := func(cluster, body string) (int, tokenCheck) {
+		req, err := http.NewRequestWithContext(context.Background(), "POST",
+			"/clusters/"+cluster+"/token-check", strings.NewReader(body))
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var result tokenCheck
+		if rr.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		}
+
+		return rr.Code, result
+	}
+
+	code, result := checkToken("current", `{"token": "good"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, tokenCheck{Authenticated: true, Username: "jane", Groups: []string{"dev"}}, result)
+
+	code, result = checkToken("current", `{"token": "bad"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, tokenCheck{}, result)
+
+	code, result = checkToken("legacy", `{"token": "good"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, tokenCheck{Authenticated: true}, result)
+
+	code, result = checkToken("legacy", `{"token": "bad"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, result.Authenticated)
+
+	code, _ = checkToken("current", `{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = checkToken("missing", `{"token": "good"}`)
+	assert.Equal(t, http.StatusNotFound, code)
+}
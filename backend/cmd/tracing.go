@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/headlamp-k8s/headlamp/backend"
+
+// setupTracing installs a global tracer provider exporting spans over OTLP/HTTP
+// to endpoint, eg. "http://localhost:4318". It returns a function flushing and
+// stopping the exporter.
+func setupTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	var opts []otlptracehttp.Option
+
+	if endpoint != "" {
+		endpointURL, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, otlptracehttp.WithEndpoint(endpointURL.Host))
+
+		if endpointURL.Path != "" && endpointURL.Path != "/" {
+			opts = append(opts, otlptracehttp.WithURLPath(endpointURL.Path))
+		}
+
+		if endpointURL.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("headlamp"))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
+// tracingMiddleware starts a span for each request, continuing the trace of
+// the caller if there is one. Spans are named after the route template, eg.
+// "GET /clusters/{clusterName}/{api:.*}", so they can be grouped, and the
+// path is kept in an attribute.
+func tracingMiddleware(next http.Handler) http.Handler {
+	withPath := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace.SpanFromContext(r.Context()).SetAttributes(semconv.URLPath(r.URL.Path))
+		next.ServeHTTP(w, r)
+	})
+
+	return otelhttp.NewHandler(withPath, "headlamp",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if route := mux.CurrentRoute(r); route != nil {
+				if template, err := route.GetPathTemplate(); err == nil {
+					return r.Method + " " + template
+				}
+			}
+
+			return r.Method
+		}),
+	)
+}
+
+// startSpan starts a span named name as a child of the request span. If
+// tracing is disabled it returns the request and its (no-op) span unchanged.
+func (c *HeadlampConfig) startSpan(r *http.Request, name string) (*http.Request, trace.Span) {
+	if !c.enableTracing {
+		return r, trace.SpanFromContext(r.Context())
+	}
+
+	ctx, span := otel.Tracer(tracerName).Start(r.Context(), name)
+
+	return r.WithContext(ctx), span
+}
+
+// injectTraceContext adds the trace context of the request to its headers,
+// so the upstream server can continue the trace.
+func (c *HeadlampConfig) injectTraceContext(r *http.Request) {
+	if !c.enableTracing {
+		return
+	}
+
+	otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(r.Header))
+}
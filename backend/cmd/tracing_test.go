@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	defer func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+
+	var traceparent string
+
+	_, handler, _ := newTestCluster(t, "traced", func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}, &HeadlampConfig{
+		enableTracing: true,
+	})
+
+	rr, err := getResponse(handler, "GET", "/clusters/traced/version", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /clusters/{clusterName}/{api:.*}", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), semconv.URLPath("/clusters/traced/version"))
+
+	// The upstream request continues the trace of the request span.
+	spanContext := spans[0].SpanContext()
+	assert.Equal(t,
+		fmt.Sprintf("00-%s-%s-01", spanContext.TraceID(), spanContext.SpanID()), traceparent)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+)
+
+// watchLimit returns the maximum number of concurrent watches of the
+// cluster: the limit of the cluster if it sets one, otherwise the global one.
+// 0 is unlimited.
+func (c *HeadlampConfig) watchLimit(kContext *kubeconfig.Context) int {
+	if info, err := kContext.HeadlampInfo(); err == nil && info.MaxWatches > 0 {
+		return info.MaxWatches
+	}
+
+	return c.maxWatches
+}
+
+// isWatchRequest returns true for watches, i.e. requests with ?watch=true.
+func isWatchRequest(r *http.Request) bool {
+	watch := r.URL.Query().Get("watch")
+
+	return watch == "true" || watch == "1"
+}
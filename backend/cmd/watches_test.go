@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//nolint:funlen
+func TestWatchLimit(t *testing.T) {
+	watches := make(chan struct{}, 10)
+
+	c, handler, upstream := newTestCluster(t, "watched", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		watches <- struct{}{}
+		<-r.Context().Done()
+	}, &HeadlampConfig{
+		maxWatches: 1,
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// The cluster allows more watches than the global limit.
+	const limit = 2
+
+	addTestCluster(t, c, "watched", upstream.URL, `{"maxWatches": 2}`)
+
+	openWatch := func() (*http.Response, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/clusters/watched/api/v1/pods?watch=true", nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		return resp, cancel
+	}
+
+	var cancels []context.CancelFunc
+
+	for i := 0; i < limit; i++ {
+		resp, cancel := openWatch()
+		defer resp.Body.Close()
+
+		cancels = append(cancels, cancel)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		<-watches
+	}
+
+	resp, cancel := openWatch()
+	resp.Body.Close()
+	cancel()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// Lists are not watches.
+	listURL := server.URL + "/clusters/watched/api/v1/pods"
+
+	listReq, err := http.NewRequestWithContext(context.Background(), "GET", listURL, nil)
+	require.NoError(t, err)
+
+	listResp, err := http.DefaultClient.Do(listReq)
+	require.NoError(t, err)
+	listResp.Body.Close()
+	assert.Equal(t, http.StatusOK, listResp.StatusCode)
+
+	// Closing a watch frees its slot.
+	cancels[0]()
+
+	assert.Eventually(t, func() bool {
+		resp, cancel := openWatch()
+		defer cancel()
+		defer resp.Body.Close()
+
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for _, cancel := range cancels[1:] {
+		cancel()
+	}
+}
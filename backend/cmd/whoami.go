@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// identity is the response of /whoami.
+type identity struct {
+	// Type is "serviceaccount" for a service account token, "oidc" for other
+	// JWTs, "token" for other bearer tokens, "clientcert" for a TLS client
+	// certificate and "anonymous" otherwise.
+	Type     string                 `json:"type"`
+	Subject  string                 `json:"subject,omitempty"`
+	Username string                 `json:"username,omitempty"`
+	Groups   []string               `json:"groups,omitempty"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+}
+
+// jwtClaims returns the claims of a JWT without verifying its signature, or
+// nil if the token is not a JWT.
+func jwtClaims(token string) map[string]interface{} {
+	const tokenParts = 3
+
+	parts := strings.Split(token, ".")
+	if len(parts) != tokenParts {
+		return nil
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+
+	return claims
+}
+
+// claimStrings returns a claim holding a string or a list of strings.
+func claimStrings(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+
+		return values
+	default:
+		return nil
+	}
+}
+
+// serviceAccountNamespace returns the namespace of the service account whose
+// token has the claims, and whether it is a service account token at all:
+// legacy tokens are issued by "kubernetes/serviceaccount", bound tokens have
+// a "kubernetes.io" claim.
+func serviceAccountNamespace(claims map[string]interface{}) (string, bool) {
+	if bound, ok := claims["kubernetes.io"].(map[string]interface{}); ok {
+		namespace, _ := bound["namespace"].(string)
+		return namespace, true
+	}
+
+	if issuer, _ := claims["iss"].(string); issuer == "kubernetes/serviceaccount" {
+		namespace, _ := claims["kubernetes.io/serviceaccount/namespace"].(string)
+		return namespace, true
+	}
+
+	return "", false
+}
+
+// serviceAccountIdentity returns the identity of a service account token,
+// with the groups Kubernetes puts service accounts in.
+func serviceAccountIdentity(claims map[string]interface{}, namespace string) identity {
+	id := identity{Type: "serviceaccount", Groups: []string{"system:serviceaccounts"}, Claims: claims}
+	id.Subject, _ = claims["sub"].(string)
+	id.Username = id.Subject
+
+	if namespace != "" {
+		id.Groups = append(id.Groups, "system:serviceaccounts:"+namespace)
+	}
+
+	return id
+}
+
+// requestIdentity returns who the request is authenticated as. Tokens are
+// not verified here, the clusters verify them when they are used, so the
+// identity is only meant to help debugging access issues.
+func requestIdentity(r *http.Request) identity {
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+		claims := jwtClaims(token)
+		if claims == nil {
+			return identity{Type: "token"}
+		}
+
+		if namespace, ok := serviceAccountNamespace(claims); ok {
+			return serviceAccountIdentity(claims, namespace)
+		}
+
+		id := identity{Type: "oidc", Groups: claimStrings(claims, "groups"), Claims: claims}
+		id.Subject, _ = claims["sub"].(string)
+
+		for _, name := range []string{"preferred_username", "email", "sub"} {
+			if username, ok := claims[name].(string); ok && username != "" {
+				id.Username = username
+				break
+			}
+		}
+
+		return id
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		subject := r.TLS.PeerCertificates[0].Subject
+
+		return identity{Type: "clientcert", Username: subject.CommonName, Groups: subject.Organization}
+	}
+
+	return identity{Type: "anonymous"}
+}
+
+// handleWhoami serves the identity of the request.
+func handleWhoami(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(requestIdentity(r)); err != nil {
+		log.Println("Error encoding identity", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhoami(t *testing.T) {
+	handler := createHeadlampHandler(&HeadlampConfig{
+		cache:           cache.New[interface{}](),
+		kubeConfigStore: kubeconfig.NewContextStore(),
+	})
+
+	whoami := func(token string) map[string]interface{} {
+		req, err := http.NewRequestWithContext(context.Background(), "GET", "/whoami", nil)
+		require.NoError(t, err)
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var id map[string]interface{}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &id))
+
+		return id
+	}
+
+	t.Run("anonymous", func(t *testing.T) {
+		assert.Equal(t, map[string]interface{}{"type": "anonymous"}, whoami(""))
+	})
+
+	t.Run("token", func(t *testing.T) {
+		assert.Equal(t, map[string]interface{}{"type": "token"}, whoami("opaque-token"))
+	})
+
+	t.Run("oidc", func(t *testing.T) {
+		claims := `{"sub":"1234","email":"jane@example.com","groups":["dev","ops"]}`
+		token := "header." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".signature"
+
+		id := whoami(token)
+		assert.Equal(t, "oidc", id["type"])
+		assert.Equal(t, "1234", id["subject"])
+		assert.Equal(t, "jane@example.com", id["username"])
+		assert.Equal(t, []interface{}{"dev", "ops"}, id["groups"])
+		assert.Equal(t, "1234", id["claims"].(map[string]interface{})["sub"])
+	})
+
+	t.Run("serviceaccount", func(t *testing.T) {
+		for _, claims := range []string{
+			`{"iss":"kubernetes/serviceaccount","sub":"system:serviceaccount:apps:deployer",` +
+				`"kubernetes.io/serviceaccount/namespace":"apps"}`,
+			`{"iss":"https://kubernetes.default.svc","sub":"system:serviceaccount:apps:deployer",` +
+				`"kubernetes.io":{"namespace":"apps","serviceaccount":{"name":"deployer"}}}`,
+		} {
+			token := "header." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".signature"
+
+			id := whoami(token)
+			assert.Equal(t, "serviceaccount", id["type"])
+			assert.Equal(t, "system:serviceaccount:apps:deployer", id["username"])
+			assert.Equal(t, []interface{}{"system:serviceaccounts", "system:serviceaccounts:apps"}, id["groups"])
+		}
+	})
+}
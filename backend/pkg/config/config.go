@@ -6,18 +6,37 @@ import (
 	"fmt"
 	"io/fs"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
+	"github.com/headlamp-k8s/headlamp/backend/pkg/portforward"
 	"github.com/knadh/koanf"
 	"github.com/knadh/koanf/providers/basicflag"
 	"github.com/knadh/koanf/providers/env"
 )
 
-const defaultPort = 4466
+// DefaultShareTTL is how long read-only share links stay valid by default.
+const DefaultShareTTL = time.Hour
+
+const (
+	defaultPort                 = 4466
+	defaultPortForwardJitter    = 0.2
+	defaultBaseURLRedirectCode  = http.StatusFound
+	defaultOidcDiscoveryTTL     = 10 * time.Minute
+	defaultCRDCacheTTL          = 5 * time.Minute
+	defaultProxyRetryBackoff    = 100 * time.Millisecond
+	defaultMaxURLLength         = 16 * 1024
+	defaultOidcMaxLogins        = 1000
+	defaultOidcClockSkew        = 30 * time.Second
+	defaultPortForwardQueueWait = 30 * time.Second
+	defaultStrippedHeaders      = "Server,X-Powered-By,X-AspNet-Version"
+)
 
 type Config struct {
 	InCluster             bool   `koanf:"in-cluster"`
@@ -25,16 +44,92 @@ type Config struct {
 	InsecureSsl           bool   `koanf:"insecure-ssl"`
 	EnableHelm            bool   `koanf:"enable-helm"`
 	EnableDynamicClusters bool   `koanf:"enable-dynamic-clusters"`
+	DisablePluginWatch    bool   `koanf:"disable-plugin-watch"`
+	EnableTracing         bool   `koanf:"enable-tracing"`
+	ForbidInsecure        bool   `koanf:"forbid-insecure-clusters"`
+	ReadOnly              bool   `koanf:"read-only"`
+	MethodOverride        bool   `koanf:"allow-method-override"`
+	NoAPIIndexFallback    bool   `koanf:"disable-api-index-fallback"`
+	EnableErrorReports    bool   `koanf:"enable-error-reports"`
+	EnableTLSInfo         bool   `koanf:"enable-tls-info"`
+	FilterClustersByGroup bool   `koanf:"filter-clusters-by-group"`
+	LazyProxySetup        bool   `koanf:"lazy-proxy-setup"`
+	KeepProxyBaseURL      bool   `koanf:"keep-proxy-base-url"`
+	RedirectToBaseURL     bool   `koanf:"redirect-outside-base-url"`
+	IgnoreClientAuth      bool   `koanf:"ignore-client-auth"`
+	CookieSecure          bool   `koanf:"cookie-secure"`
+	GunzipExternalProxy   bool   `koanf:"gunzip-external-proxy"`
 	Port                  uint   `koanf:"port"`
+	BaseURLRedirectCode   uint   `koanf:"base-url-redirect-code"`
+	MaxLogStreams         uint   `koanf:"max-log-streams"`
+	MaxWatches            uint   `koanf:"max-watches"`
+	MaxPlugins            uint   `koanf:"max-plugins"`
+	MaxPluginListSize     uint   `koanf:"max-plugin-list-size"`
+	OidcMaxLogins         uint   `koanf:"oidc-max-pending-logins"`
+	PortForwardSetups     uint   `koanf:"portforward-max-setups"`
+	MaxURLLength          uint   `koanf:"max-url-length"`
+	MaxConnections        uint   `koanf:"max-connections"`
+	LogBufferLines        uint   `koanf:"log-buffer-lines"`
 	KubeConfigPath        string `koanf:"kubeconfig"`
 	StaticDir             string `koanf:"html-static-dir"`
 	PluginsDir            string `koanf:"plugins-dir"`
 	BaseURL               string `koanf:"base-url"`
 	ProxyURLs             string `koanf:"proxy-urls"`
+	ProxyURLOrigins       string `koanf:"proxy-url-origins"`
+	CORSAllowedOrigins    string `koanf:"cors-allowed-origins"`
+	StripResponseHeaders  string `koanf:"strip-response-headers"`
 	OidcClientID          string `koanf:"oidc-client-id"`
 	OidcClientSecret      string `koanf:"oidc-client-secret"`
 	OidcIdpIssuerURL      string `koanf:"oidc-idp-issuer-url"`
 	OidcScopes            string `koanf:"oidc-scopes"`
+	OidcRequiredClaims    string `koanf:"oidc-required-claims"`
+	OidcAuthPath          string `koanf:"oidc-auth-path"`
+	UserAgent             string `koanf:"user-agent"`
+	AdminAddr             string `koanf:"admin-addr"`
+	KubectlProxyPath      string `koanf:"kubectl-proxy-path"`
+	ErrorPage             string `koanf:"error-page"`
+	HeadlessRoot          string `koanf:"headless-root"`
+	ShareSecret           string `koanf:"share-secret"`
+	PortForwardAddress    string `koanf:"portforward-address"`
+	OTLPEndpoint          string `koanf:"otlp-endpoint"`
+	BaseDir               string `koanf:"base-dir"`
+	ProxyRequestLog       string `koanf:"proxy-request-log"`
+	AccessLogFormat       string `koanf:"access-log-format"`
+	AccessLogFile         string `koanf:"access-log-file"`
+	MetricsUsername       string `koanf:"metrics-username"`
+	MetricsPassword       string `koanf:"metrics-password"`
+	MetricsToken          string `koanf:"metrics-token"`
+	InClusterTokenFile    string `koanf:"in-cluster-token-file"`
+	InClusterCAFile       string `koanf:"in-cluster-ca-file"`
+	InClusterAPIServer    string `koanf:"in-cluster-api-server"`
+	ExtraCADir            string `koanf:"extra-ca-dir"`
+	CookieSameSite        string `koanf:"cookie-samesite"`
+	CookieDomain          string `koanf:"cookie-domain"`
+	CookiePath            string `koanf:"cookie-path"`
+
+	// PortForwardKeepAlive is the keepalive interval for port forward connections.
+	PortForwardKeepAlive  time.Duration `koanf:"portforward-keepalive"`
+	PortForwardBufferSize uint          `koanf:"portforward-buffer-size"`
+	// DiscoveryCacheTTL is how long API discovery responses are cached. Zero disables caching.
+	DiscoveryCacheTTL    time.Duration `koanf:"discovery-cache-ttl"`
+	PortForwardJitter    float64       `koanf:"portforward-check-jitter"`
+	PortForwardTimeout   time.Duration `koanf:"portforward-setup-timeout"`
+	PortForwardGrace     time.Duration `koanf:"portforward-restart-grace"`
+	PortForwardQueueWait time.Duration `koanf:"portforward-queue-timeout"`
+	ProxyRetries         uint          `koanf:"proxy-retries"`
+	ProxyMaxConnsPerHost uint          `koanf:"proxy-max-conns-per-host"`
+	ProxyMaxIdleConns    uint          `koanf:"proxy-max-idle-conns"`
+	ProxyNoKeepAlives    bool          `koanf:"proxy-disable-keep-alives"`
+	ProxyRetryBackoff    time.Duration `koanf:"proxy-retry-backoff"`
+	DNSCacheTTL          time.Duration `koanf:"dns-cache-ttl"`
+	ProxyMaxResponseSize uint64        `koanf:"proxy-max-response-size"`
+	ShareTTL             time.Duration `koanf:"share-ttl"`
+	OidcDiscoveryTTL     time.Duration `koanf:"oidc-discovery-ttl"`
+	OidcClockSkew        time.Duration `koanf:"oidc-clock-skew"`
+	UpgradeIdleTimeout   time.Duration `koanf:"upgrade-idle-timeout"`
+	CRDCacheTTL          time.Duration `koanf:"crd-cache-ttl"`
+	ClusterSetupRetry    time.Duration `koanf:"dynamic-cluster-setup-retry"`
+	InClusterCARefresh   time.Duration `koanf:"in-cluster-ca-refresh"`
 }
 
 func (c *Config) Validate() error {
@@ -47,9 +142,73 @@ func (c *Config) Validate() error {
 		return errors.New("base-url needs to start with a '/' or be empty")
 	}
 
+	switch c.BaseURLRedirectCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusPermanentRedirect:
+	default:
+		return errors.New("base-url-redirect-code needs to be one of 301, 302 or 308")
+	}
+
+	switch c.ProxyRequestLog {
+	case "", "off", "full", "redacted":
+	default:
+		return errors.New("proxy-request-log needs to be one of off, full or redacted")
+	}
+
+	switch c.AccessLogFormat {
+	case "", "off", "common", "combined":
+	default:
+		return errors.New("access-log-format needs to be one of off, common or combined")
+	}
+
+	switch c.HeadlessRoot {
+	case "", "json", "none":
+	default:
+		if u, err := url.Parse(c.HeadlessRoot); err != nil || (!u.IsAbs() && !strings.HasPrefix(u.Path, "/")) {
+			return errors.New("headless-root needs to be json, none or a URL to redirect to")
+		}
+	}
+
+	switch strings.ToLower(c.CookieSameSite) {
+	case "", "strict", "lax":
+	case "none":
+		if !c.CookieSecure {
+			return errors.New("cookie-samesite none needs cookie-secure")
+		}
+	default:
+		return errors.New("cookie-samesite needs to be one of strict, lax or none")
+	}
+
+	if (c.MetricsUsername == "") != (c.MetricsPassword == "") {
+		return errors.New("metrics-username and metrics-password need to be set together")
+	}
+
+	for _, entry := range strings.Split(c.ProxyURLOrigins, ",") {
+		if entry != "" && !strings.Contains(entry, "=") {
+			return errors.New("proxy-url-origins entries need to be in the form <proxy-url glob>=<origin|keep>")
+		}
+	}
+
+	for _, origin := range strings.Split(c.CORSAllowedOrigins, ",") {
+		if !validCORSOrigin(origin) {
+			return fmt.Errorf("cors-allowed-origins entry %q needs to be * or an origin like https://example.com", origin)
+		}
+	}
+
 	return nil
 }
 
+// validCORSOrigin returns whether an entry of cors-allowed-origins is empty,
+// "*" or an origin, a URL with a scheme and host but no path.
+func validCORSOrigin(origin string) bool {
+	if origin == "" || origin == "*" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+
+	return err == nil && u.Scheme != "" && u.Host != "" && u.Path == "" && u.RawQuery == ""
+}
+
 // Parse Loads the config from flags and env.
 // env vars should start with HEADLAMP_CONFIG_ and use _ as separator
 // If a value is set both in flags and env then flag takes priority.
@@ -131,29 +290,209 @@ func Parse(args []string) (*Config, error) {
 
 	config.KubeConfigPath = kubeConfigPath
 
+	if config.BaseDir != "" {
+		config.resolvePaths()
+	}
+
 	return &config, nil
 }
 
+// resolvePaths expands "~/" and environment variables in the paths of the
+// config, and makes the relative ones relative to the base directory, so an
+// install can be relocated by changing the base directory only.
+func (c *Config) resolvePaths() {
+	baseDir := expandPath(c.BaseDir)
+
+	for _, path := range []*string{
+		&c.StaticDir, &c.PluginsDir, &c.ErrorPage, &c.InClusterTokenFile, &c.InClusterCAFile,
+	} {
+		*path = resolvePath(baseDir, *path)
+	}
+
+	kubeConfigPaths := filepath.SplitList(c.KubeConfigPath)
+	for i, path := range kubeConfigPaths {
+		kubeConfigPaths[i] = resolvePath(baseDir, path)
+	}
+
+	c.KubeConfigPath = strings.Join(kubeConfigPaths, string(os.PathListSeparator))
+}
+
+// resolvePath expands path and joins it to baseDir if it is relative.
+// Empty paths are kept empty.
+func resolvePath(baseDir, path string) string {
+	if path == "" {
+		return ""
+	}
+
+	path = expandPath(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(baseDir, path)
+}
+
+// expandPath expands environment variables and a leading "~/" in path.
+func expandPath(path string) string {
+	path = os.ExpandEnv(path)
+
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+
+	return path
+}
+
 func flagset() *flag.FlagSet {
 	f := flag.NewFlagSet("config", flag.ContinueOnError)
 
 	f.Bool("in-cluster", false, "Set when running from a k8s cluster")
+	f.String("in-cluster-token-file", "",
+		"Service account token file in in-cluster mode (default /var/run/secrets/kubernetes.io/serviceaccount/token)")
+	f.String("in-cluster-ca-file", "",
+		"API server CA file in in-cluster mode (default /var/run/secrets/kubernetes.io/serviceaccount/ca.crt)")
+	f.String("in-cluster-api-server", "",
+		"API server address in in-cluster mode, eg. 10.0.0.1:443 (default KUBERNETES_SERVICE_HOST:KUBERNETES_SERVICE_PORT)")
+	f.Duration("in-cluster-ca-refresh", 0,
+		"Interval to re-read the API server CA file in in-cluster mode, so CA rotations are picked up (0 disables)")
 	f.Bool("dev", false, "Allow connections from other origins")
 	f.Bool("insecure-ssl", false, "Accept/Ignore all server SSL certificates")
 	f.Bool("enable-dynamic-clusters", false, "Enable dynamic clusters, which stores stateless clusters in the frontend.")
-
+	f.Duration("dynamic-cluster-setup-retry", 0,
+		"Keep dynamic clusters whose proxy setup fails as pending and retry it, starting at this interval (0 disables)")
+	f.Bool("disable-plugin-watch", false, "Do not watch the plugins directory for changes")
+	f.Bool("enable-error-reports", false,
+		"Log errors reported by the frontend to /telemetry/error, rate-limited")
+	f.Bool("lazy-proxy-setup", false,
+		"Set up the proxy of a cluster on its first request instead of at startup, for kubeconfigs with many contexts")
+	f.Bool("keep-proxy-base-url", false,
+		"Do not strip a repeated base URL from the paths of cluster requests before proxying them")
+	f.Bool("redirect-outside-base-url", false,
+		"Redirect requests outside the base URL to the same path under it, instead of answering 404")
+	f.Bool("filter-clusters-by-group", false,
+		"List clusters only to the OIDC sessions of the groups they allow, and to others only if they are public")
+	f.Bool("enable-tls-info", false,
+		"Serve the certificate presented by the API server of clusters at /clusters/{name}/tls-info, for debugging")
+	f.Bool("ignore-client-auth", false,
+		"Always use the context credentials for clusters, ignoring the Authorization header of clients")
+	f.Bool("gunzip-external-proxy", false,
+		"Decompress gzip responses of the external proxy instead of passing them through with their encoding")
+	f.Bool("disable-api-index-fallback", false,
+		"Return 404 for unknown paths below backend endpoints, eg. /clusters, instead of the frontend index")
+	f.Bool("forbid-insecure-clusters", false,
+		"Reject dynamic clusters that skip TLS verification or have no certificate authority")
+	f.Bool("read-only", false,
+		"Reject mutating cluster requests, dynamic cluster changes and new port forwards (toggle at /read-only)")
+	f.Bool("allow-method-override", false,
+		"Let POST requests carry a PUT, PATCH or DELETE method in the X-HTTP-Method-Override header")
+	f.Bool("enable-tracing", false, "Export OpenTelemetry traces of requests")
+	f.String("otlp-endpoint", "",
+		"OTLP/HTTP endpoint traces are exported to, eg. http://localhost:4318 (default OTEL_EXPORTER_OTLP_ENDPOINT)")
+
+	f.String("base-dir", "",
+		"Directory relative paths (static, plugins, kubeconfig, ...) are resolved against, after ~/ and env expansion")
 	f.String("kubeconfig", "", "Absolute path to the kubeconfig file")
 	f.String("html-static-dir", "", "Static HTML directory to serve")
+	f.String("error-page", "", "HTML page to serve when serving the frontend fails with an internal error")
+	f.String("headless-root", "json",
+		"What / serves without a static dir: json for a message, none for a 404, or a URL to redirect to")
 	f.String("plugins-dir", defaultPluginDir(), "Specify the plugins directory to build the backend with")
 	f.String("base-url", "", "Base URL path. eg. /headlamp")
+	f.Uint("base-url-redirect-code", defaultBaseURLRedirectCode,
+		"Status code (301, 302 or 308) of redirects to the base URL, eg. from /headlamp to /headlamp/")
 	f.Uint("port", defaultPort, "Port to listen from")
+	f.String("admin-addr", "", "Address to serve health, metrics and debug endpoints on, eg. :4467 (default main port)")
+	f.Uint("log-buffer-lines", 0,
+		"Number of recent log lines kept in memory and served to admins at /debug/logs (0 disables)")
+	f.String("metrics-username", "", "Username of basic auth required to read /metrics (public if no credentials are set)")
+	f.String("metrics-password", "", "Password of basic auth required to read /metrics")
+	f.String("metrics-token", "", "Bearer token accepted to read /metrics")
 	f.String("proxy-urls", "", "Allow proxy requests to specified URLs")
+	f.String("strip-response-headers", defaultStrippedHeaders,
+		"Comma separated headers removed from responses of clusters and external proxies")
+	f.String("proxy-url-origins", "",
+		"Origin sent on external proxy requests per proxy URL glob, eg. https://grafana.example.com/*=https://example.com"+
+			" (\"keep\" forwards the client's; Origin and Referer are stripped by default)")
+	f.String("cors-allowed-origins", "",
+		"Comma separated origins allowed to make cross-origin requests, eg. https://example.com (any on dev mode)")
+	f.String("kubectl-proxy-path", "",
+		"Path to serve a kubectl proxy style passthrough per cluster at, eg. /kubectl-proxy (disabled if empty)")
+	f.String("proxy-request-log", "off",
+		"How requests proxied to clusters are logged: off, full or redacted (clusters can override it)")
+	f.String("access-log-format", "off",
+		"Format of the access log of all requests: off, common or combined (Apache Common/Combined Log Format)")
+	f.String("access-log-file", "", "File access logs are appended to (default stdout)")
+	f.String("extra-ca-dir", "",
+		"Directory of *.pem and *.crt CA certificates trusted for clusters, OIDC and proxied URLs, reloaded on change")
+	f.String("user-agent", "", "User-Agent for requests to upstream servers (default headlamp/<version>)")
+	f.String("portforward-address", portforward.DefaultAddress,
+		"Local address port forwards listen on, eg. 127.0.0.1 or ::1")
+	f.Duration("portforward-keepalive", portforward.DefaultKeepAliveInterval,
+		"Interval between keepalive probes on port forward connections")
+	f.Uint("portforward-buffer-size", portforward.DefaultOutputBufferSize,
+		"Number of bytes of output kept for each port forward")
+	f.Float64("portforward-check-jitter", defaultPortForwardJitter,
+		"Maximum random fraction added to the port forward pod availability check interval")
+	f.Duration("portforward-setup-timeout", portforward.DefaultSetupTimeout,
+		"How long starting a port forward may take before it fails with 504")
+	f.Duration("portforward-restart-grace", 0,
+		"How long the pod of a port forward may not run, eg. while restarted, before the forward stops (0 disables)")
+	f.Uint("portforward-max-setups", 0,
+		"Maximum number of port forwards being started at once, the next ones wait for their turn (0 is unlimited)")
+	f.Duration("portforward-queue-timeout", defaultPortForwardQueueWait,
+		"How long a port forward may wait for its turn to start before it fails with 503 (0 fails it right away)")
+	f.Uint("proxy-retries", 0,
+		"Times GET, HEAD and OPTIONS cluster requests are retried on transient failures, eg. 503 (0 disables)")
+	f.Duration("proxy-retry-backoff", defaultProxyRetryBackoff,
+		"Delay before the first retry of a cluster request, doubled for each next one")
+	f.Uint("proxy-max-conns-per-host", 0,
+		"Maximum number of connections to each API server, the next requests wait for one (0 is unlimited)")
+	f.Uint("proxy-max-idle-conns", 0,
+		"Number of idle connections kept to each API server for reuse (0 is the default, 25)")
+	f.Bool("proxy-disable-keep-alives", false,
+		"Close the connections to API servers after each request instead of reusing them")
+	f.Duration("dns-cache-ttl", 0,
+		"How long the addresses of API server hosts are cached, keep below their DNS TTL (0 disables)")
+	f.Uint("max-url-length", defaultMaxURLLength,
+		"Maximum length in bytes of the path and query of proxied cluster requests (0 is unlimited)")
+	f.Uint("max-watches", 0, "Maximum number of concurrent watches per cluster, clusters can override it (0 is unlimited)")
+	f.Uint("max-connections", 0,
+		"Maximum number of open connections to the server, the next ones wait until others close (0 is unlimited)")
+	f.Uint("max-plugins", 0, "Maximum number of plugins loaded, the next ones are ignored (0 is unlimited)")
+	f.Uint("max-plugin-list-size", 0,
+		"Maximum number of plugins in a /plugins or /plugin-manifest response, the rest is paged (0 is unlimited)")
+	f.Uint("max-log-streams", 0, "Maximum number of concurrent followed pod log streams per cluster (0 is unlimited)")
+	f.Uint64("proxy-max-response-size", 0,
+		"Maximum size in bytes of proxied cluster responses, watches and log streams excluded (0 is unlimited)")
+	f.Duration("upgrade-idle-timeout", 0,
+		"Close proxied exec, attach and WebSocket connections after no data flowed for this long (0 disables)")
+	f.Duration("discovery-cache-ttl", 0, "How long to cache API discovery responses (/api, /apis, /openapi/v2), 0 disables")
+	f.Duration("crd-cache-ttl", defaultCRDCacheTTL,
+		"How long to cache the CRD lists served at /clusters/{name}/crds, 0 disables")
+	f.Bool("cookie-secure", true, "Only send the cookies set by Headlamp over HTTPS")
+	f.String("cookie-samesite", "lax", "SameSite attribute of the cookies set by Headlamp: strict, lax or none")
+	f.String("cookie-domain", "", "Domain attribute of the cookies set by Headlamp (default the host of the request)")
+	f.String("cookie-path", "", "Path attribute of the cookies set by Headlamp (default the base URL)")
+	f.String("share-secret", "", "Secret used to sign read-only share links (default random, links end on restart)")
+	f.Duration("share-ttl", DefaultShareTTL, "How long read-only share links stay valid")
 
 	f.String("oidc-client-id", "", "ClientID for OIDC")
 	f.String("oidc-client-secret", "", "ClientSecret for OIDC")
 	f.String("oidc-idp-issuer-url", "", "Identity provider issuer URL for OIDC")
 	f.String("oidc-scopes", "profile,email",
 		"A comma separated list of scopes needed from the OIDC provider")
+	f.String("oidc-required-claims", "",
+		"Comma separated claims ID tokens need to have, eg. email_verified=true or groups (any value)")
+	f.String("oidc-auth-path", "auth",
+		"Frontend path OIDC logins redirect to, with the cluster and token in the query")
+	f.Duration("oidc-discovery-ttl", defaultOidcDiscoveryTTL,
+		"How long OIDC discovery documents are cached; the last good one is kept if a refresh fails")
+	f.Duration("oidc-clock-skew", defaultOidcClockSkew,
+		"How far the clocks of Headlamp and the OIDC provider may differ when checking token expiry")
+	f.Uint("oidc-max-pending-logins", defaultOidcMaxLogins,
+		"Maximum number of OIDC logins waiting for their callback, new ones fail once reached (0 is unlimited)")
 
 	return f
 }
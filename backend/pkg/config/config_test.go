@@ -2,7 +2,9 @@ package config_test
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/headlamp-k8s/headlamp/backend/pkg/config"
 	"github.com/stretchr/testify/assert"
@@ -81,6 +83,110 @@ func TestParse(t *testing.T) {
 		assert.Contains(t, err.Error(), "base-url")
 	})
 
+	t.Run("invalid_base_url_redirect_code", func(t *testing.T) {
+		args := []string{
+			"go run ./cmd", "--base-url=/headlamp", "--base-url-redirect-code=307",
+		}
+		conf, err := config.Parse(args)
+		require.Error(t, err)
+		require.Nil(t, conf)
+
+		assert.Contains(t, err.Error(), "base-url-redirect-code")
+	})
+
+	t.Run("invalid_proxy_request_log", func(t *testing.T) {
+		args := []string{
+			"go run ./cmd", "--proxy-request-log=verbose",
+		}
+		conf, err := config.Parse(args)
+		require.Error(t, err)
+		require.Nil(t, conf)
+
+		assert.Contains(t, err.Error(), "proxy-request-log")
+	})
+
+	t.Run("invalid_access_log_format", func(t *testing.T) {
+		args := []string{
+			"go run ./cmd", "--access-log-format=json",
+		}
+		conf, err := config.Parse(args)
+		require.Error(t, err)
+		require.Nil(t, conf)
+
+		assert.Contains(t, err.Error(), "access-log-format")
+	})
+
+	t.Run("invalid_headless_root", func(t *testing.T) {
+		args := []string{
+			"go run ./cmd", "--headless-root=landing",
+		}
+		conf, err := config.Parse(args)
+		require.Error(t, err)
+		require.Nil(t, conf)
+
+		assert.Contains(t, err.Error(), "headless-root")
+	})
+
+	t.Run("invalid_cors_allowed_origins", func(t *testing.T) {
+		args := []string{
+			"go run ./cmd", "--cors-allowed-origins=https://example.com,example.org/app",
+		}
+		conf, err := config.Parse(args)
+		require.Error(t, err)
+		require.Nil(t, conf)
+
+		assert.Contains(t, err.Error(), "cors-allowed-origins")
+	})
+
+	t.Run("invalid_proxy_url_origins", func(t *testing.T) {
+		args := []string{
+			"go run ./cmd", "--proxy-url-origins=https://grafana.example.com/*",
+		}
+		conf, err := config.Parse(args)
+		require.Error(t, err)
+		require.Nil(t, conf)
+
+		assert.Contains(t, err.Error(), "proxy-url-origins")
+	})
+
+	t.Run("samesite_none_without_secure", func(t *testing.T) {
+		args := []string{
+			"go run ./cmd", "--cookie-samesite=none", "--cookie-secure=false",
+		}
+		conf, err := config.Parse(args)
+		require.Error(t, err)
+		require.Nil(t, conf)
+
+		assert.Contains(t, err.Error(), "cookie-samesite")
+	})
+
+	t.Run("metrics_username_without_password", func(t *testing.T) {
+		args := []string{
+			"go run ./cmd", "--metrics-username=prometheus",
+		}
+		conf, err := config.Parse(args)
+		require.Error(t, err)
+		require.Nil(t, conf)
+
+		assert.Contains(t, err.Error(), "metrics-password")
+	})
+
+	t.Run("base_dir", func(t *testing.T) {
+		t.Setenv("HEADLAMP_TEST_DIR", "/srv")
+
+		args := []string{
+			"go run ./cmd", "--base-dir=$HEADLAMP_TEST_DIR/headlamp", "--plugins-dir=plugins",
+			"--html-static-dir=/usr/share/headlamp", "--kubeconfig=kube/config",
+		}
+		conf, err := config.Parse(args)
+		require.NoError(t, err)
+		require.NotNil(t, conf)
+
+		assert.Equal(t, filepath.Join("/srv", "headlamp", "plugins"), conf.PluginsDir)
+		assert.Equal(t, "/usr/share/headlamp", conf.StaticDir)
+		assert.Equal(t, filepath.Join("/srv", "headlamp", "kube", "config"), conf.KubeConfigPath)
+	})
+
 	t.Run("kubeconfig_from_default_env", func(t *testing.T) {
 		os.Setenv("KUBECONFIG", "~/.kube/test_config.yaml")
 		defer os.Unsetenv("KUBECONFIG")
@@ -104,4 +210,15 @@ func TestParse(t *testing.T) {
 
 		assert.Equal(t, true, conf.EnableDynamicClusters)
 	})
+
+	t.Run("portforward_keepalive", func(t *testing.T) {
+		args := []string{
+			"go run ./cmd", "--portforward-keepalive=1m",
+		}
+		conf, err := config.Parse(args)
+		require.NoError(t, err)
+		require.NotNil(t, conf)
+
+		assert.Equal(t, time.Minute, conf.PortForwardKeepAlive)
+	})
 }
@@ -0,0 +1,95 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// allowedPathsTransport fails the requests to the paths a context doesn't allow,
+// so that clients built from its rest config, eg. for helm or port forwards,
+// are restricted like the proxy is.
+type allowedPathsTransport struct {
+	context *Context
+	// basePath is the path of the server, which isn't part of the API path.
+	basePath string
+	next     http.RoundTripper
+}
+
+func (t *allowedPathsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	apiPath := strings.TrimPrefix(req.URL.Path, t.basePath)
+	if !t.context.IsPathAllowed(apiPath) {
+		return nil, fmt.Errorf("%w: %q", ErrPathNotAllowed, apiPath)
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// restrictPaths makes restConf fail the requests to the paths the context
+// doesn't allow, if it has allowed paths.
+func (c *Context) restrictPaths(restConf *rest.Config) error {
+	info, err := c.HeadlampInfo()
+	if err != nil {
+		return err
+	}
+
+	if len(info.AllowedPaths) == 0 {
+		return nil
+	}
+
+	host, err := url.Parse(restConf.Host)
+	if err != nil {
+		return err
+	}
+
+	basePath := strings.TrimRight(host.Path, "/")
+
+	restConf.Wrap(func(next http.RoundTripper) http.RoundTripper {
+		return &allowedPathsTransport{context: c, basePath: basePath, next: next}
+	})
+
+	return nil
+}
+
+// restrictedClientConfig is a client config whose rest configs only request
+// the paths allowed by the context.
+type restrictedClientConfig struct {
+	config  clientcmd.ClientConfig
+	context *Context
+}
+
+func (r *restrictedClientConfig) RawConfig() (api.Config, error) {
+	return r.config.RawConfig()
+}
+
+func (r *restrictedClientConfig) ClientConfig() (*rest.Config, error) {
+	restConf, err := r.config.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.context.restrictPaths(restConf); err != nil {
+		return nil, err
+	}
+
+	return restConf, nil
+}
+
+func (r *restrictedClientConfig) Namespace() (string, bool, error) {
+	return r.config.Namespace()
+}
+
+func (r *restrictedClientConfig) ConfigAccess() clientcmd.ConfigAccess {
+	return r.config.ConfigAccess()
+}
+
+// RestrictedClientConfig returns the client config of the context, whose
+// rest configs fail the requests to the paths the context doesn't allow.
+func (c *Context) RestrictedClientConfig() clientcmd.ClientConfig {
+	return &restrictedClientConfig{config: c.ClientConfig(), context: c}
+}
@@ -0,0 +1,123 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// failedServerBackoff is how long a server is skipped after a request to it failed.
+const failedServerBackoff = 30 * time.Second
+
+// balancedTransport sends requests to a set of API servers in round-robin,
+// skipping the ones a request recently failed to reach.
+type balancedTransport struct {
+	transport http.RoundTripper
+	servers   []*url.URL
+
+	lock        sync.Mutex
+	next        int
+	failedUntil []time.Time
+}
+
+// balanceServers returns a transport balancing requests across the server of
+// the cluster and the Servers of the context's Headlamp info, or transport
+// itself if there are no other servers.
+func (c *Context) balanceServers(server *url.URL, transport http.RoundTripper) (http.RoundTripper, error) {
+	info, err := c.HeadlampInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(info.Servers) == 0 {
+		return transport, nil
+	}
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	servers := []*url.URL{server}
+
+	for _, s := range info.Servers {
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid server %q", s)
+		}
+
+		servers = append(servers, u)
+	}
+
+	return &balancedTransport{
+		transport:   transport,
+		servers:     servers,
+		failedUntil: make([]time.Time, len(servers)),
+	}, nil
+}
+
+// pick returns the index of the next server which did not fail recently, or
+// just of the next server if they all did.
+func (t *balancedTransport) pick() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	index := t.next
+
+	for i := range t.servers {
+		candidate := (t.next + i) % len(t.servers)
+		if now.After(t.failedUntil[candidate]) {
+			index = candidate
+			break
+		}
+	}
+
+	t.next = (index + 1) % len(t.servers)
+
+	return index
+}
+
+func (t *balancedTransport) markFailed(index int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.failedUntil[index] = time.Now().Add(failedServerBackoff)
+}
+
+// RoundTrip sends the request to the next server. Requests which can safely
+// be sent again, bodiless GET, HEAD and OPTIONS ones, are retried on the
+// other servers if the server can't be reached.
+func (t *balancedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if isRetryableRequest(req) {
+		attempts = len(t.servers)
+	}
+
+	var err error
+
+	for i := 0; i < attempts; i++ {
+		index := t.pick()
+
+		outReq := req.Clone(req.Context())
+		outReq.URL.Scheme = t.servers[index].Scheme
+		outReq.URL.Host = t.servers[index].Host
+
+		var resp *http.Response
+
+		resp, err = t.transport.RoundTrip(outReq)
+		if err == nil {
+			return resp, nil
+		}
+
+		// The client going away says nothing about the server.
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+
+		t.markFailed(index)
+	}
+
+	return nil, err
+}
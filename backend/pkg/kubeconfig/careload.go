@@ -0,0 +1,117 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// swappableTransport is a round tripper whose underlying transport can be
+// replaced while requests are served through it.
+type swappableTransport struct {
+	lock      sync.RWMutex
+	transport http.RoundTripper
+	// caData is the certificate authority the transport was built with.
+	caData []byte
+}
+
+func newSwappableTransport(transport http.RoundTripper, caData []byte) *swappableTransport {
+	return &swappableTransport{transport: transport, caData: caData}
+}
+
+func (t *swappableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.lock.RLock()
+	transport := t.transport
+	t.lock.RUnlock()
+
+	return transport.RoundTrip(req)
+}
+
+// caData returns the certificate authority of the cluster, read from its
+// file if it is not inline. It returns nil if the file can't be read.
+func (c *Context) caData() []byte {
+	if c.Cluster == nil {
+		return nil
+	}
+
+	if len(c.Cluster.CertificateAuthorityData) > 0 || c.Cluster.CertificateAuthority == "" {
+		return c.Cluster.CertificateAuthorityData
+	}
+
+	data, err := os.ReadFile(c.Cluster.CertificateAuthority)
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
+
+// ReloadCA re-reads the certificate authority file of the cluster and, if it
+// changed, rebuilds the transport of the proxy with it, so the cluster stays
+// reachable when its CA is rotated, eg. in-cluster. The proxy keeps serving:
+// requests in flight finish on the old transport, new ones use the new one.
+// It returns true if the transport was rebuilt.
+func (c *Context) ReloadCA() (bool, error) {
+	if c.transport == nil || c.Cluster == nil || c.Cluster.CertificateAuthority == "" {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(c.Cluster.CertificateAuthority)
+	if err != nil {
+		return false, err
+	}
+
+	c.transport.lock.RLock()
+	unchanged := bytes.Equal(data, c.transport.caData)
+	c.transport.lock.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	if err := c.swapTransport(data); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RebuildTransport rebuilds the transport of the proxy from the current
+// settings, eg. once the extra certificate authorities changed.
+func (c *Context) RebuildTransport() error {
+	if c.transport == nil {
+		return nil
+	}
+
+	// Keep the certificate authority the transport was last built with, a
+	// rotated one is picked up by ReloadCA.
+	c.transport.lock.RLock()
+	data := c.transport.caData
+	c.transport.lock.RUnlock()
+
+	return c.swapTransport(data)
+}
+
+// swapTransport replaces the transport of the proxy with one trusting data,
+// or the cluster's certificate authority if it is nil.
+func (c *Context) swapTransport(data []byte) error {
+	restConf, err := c.restConfig(data)
+	if err != nil {
+		return err
+	}
+
+	transport, err := proxyTransportFor(restConf, c.opts().TransportTuning)
+	if err != nil {
+		return err
+	}
+
+	c.transport.lock.Lock()
+	c.transport.transport = transport
+	if data != nil {
+		c.transport.caData = data
+	}
+	c.transport.lock.Unlock()
+
+	return nil
+}
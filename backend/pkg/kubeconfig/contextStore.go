@@ -2,6 +2,9 @@ package kubeconfig
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
@@ -15,24 +18,56 @@ type ContextStore interface {
 	RemoveContext(name string) error
 	AddContextWithKeyAndTTL(headlampContext *Context, key string, ttl time.Duration) error
 	UpdateTTL(key string, ttl time.Duration) error
+	ReplaceContext(old, replacement *Context) error
+	Options() *Options
 }
 
 type contextStore struct {
-	cache cache.Cache[*Context]
+	cache   cache.Cache[*Context]
+	options *Options
+	// lock serializes the changes to the stored contexts, so a context is only
+	// replaced if it is still stored.
+	lock sync.Mutex
 }
 
-// NewContextStore creates a new ContextStore.
+// NewContextStore creates a new ContextStore, whose contexts have the default options.
 func NewContextStore() ContextStore {
+	return NewContextStoreWithOptions(&Options{})
+}
+
+// NewContextStoreWithOptions creates a new ContextStore, whose contexts have opts.
+func NewContextStoreWithOptions(opts *Options) ContextStore {
 	cache := cache.New[*Context]()
 
 	return &contextStore{
-		cache: cache,
+		cache:   cache,
+		options: opts,
 	}
 }
 
+// Options returns the options of the contexts of the store.
+func (c *contextStore) Options() *Options {
+	return c.options
+}
+
+// loaded gives the options of the store to a context which has none yet, and
+// parses its Headlamp info if it wasn't, before it is stored.
+func (c *contextStore) loaded(headlampContext *Context) *Context {
+	if headlampContext.options == nil {
+		headlampContext.options = c.options
+	}
+
+	headlampContext.loadHeadlampInfo()
+
+	return headlampContext
+}
+
 // AddContext adds a context to the store.
 func (c *contextStore) AddContext(headlampContext *Context) error {
-	return c.cache.Set(context.Background(), headlampContext.Name, headlampContext)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.cache.Set(context.Background(), headlampContext.Name, c.loaded(headlampContext))
 }
 
 // GetContexts returns all contexts in the store.
@@ -51,9 +86,13 @@ func (c *contextStore) GetContexts() ([]*Context, error) {
 	return contexts, nil
 }
 
-// GetContext returns a context from the store.
+// GetContext returns a context from the store, or ErrClusterNotFound if there is none.
 func (c *contextStore) GetContext(name string) (*Context, error) {
 	context, err := c.cache.Get(context.Background(), name)
+	if errors.Is(err, cache.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %q: %w", ErrClusterNotFound, name, err)
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -63,15 +102,39 @@ func (c *contextStore) GetContext(name string) (*Context, error) {
 
 // RemoveContext removes a context from the store.
 func (c *contextStore) RemoveContext(name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	return c.cache.Delete(context.Background(), name)
 }
 
 // AddContextWithTTL adds a context to the store with a ttl.
 func (c *contextStore) AddContextWithKeyAndTTL(headlampContext *Context, key string, ttl time.Duration) error {
-	return c.cache.SetWithTTL(context.Background(), key, headlampContext, ttl)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.cache.SetWithTTL(context.Background(), key, c.loaded(headlampContext), ttl)
 }
 
 // UpdateTTL updates the ttl of a context.
 func (c *contextStore) UpdateTTL(key string, ttl time.Duration) error {
 	return c.cache.UpdateTTL(context.Background(), key, ttl)
 }
+
+// ReplaceContext replaces a stored context by another one of the same name.
+// It returns ErrClusterNotFound if the context was removed or replaced meanwhile.
+func (c *contextStore) ReplaceContext(old, replacement *Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	stored, err := c.cache.Get(context.Background(), old.Name)
+	if errors.Is(err, cache.ErrNotFound) || (err == nil && stored != old) {
+		return fmt.Errorf("%w: %q", ErrClusterNotFound, old.Name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.cache.Set(context.Background(), replacement.Name, c.loaded(replacement))
+}
@@ -40,7 +40,26 @@ func TestContextStore(t *testing.T) {
 
 	_, err = store.GetContext("test")
 	require.Error(t, err)
-	require.Equal(t, cache.ErrNotFound, err)
+	require.ErrorIs(t, err, cache.ErrNotFound)
+	require.ErrorIs(t, err, kubeconfig.ErrClusterNotFound)
+
+	// Test ReplaceContext
+	stored, err := store.GetContext("test2")
+	require.NoError(t, err)
+
+	replacement := stored.Copy()
+	require.NoError(t, store.ReplaceContext(stored, replacement))
+
+	context, err = store.GetContext("test2")
+	require.NoError(t, err)
+	require.Same(t, replacement, context)
+
+	// The context was replaced meanwhile.
+	err = store.ReplaceContext(stored, stored.Copy())
+	require.ErrorIs(t, err, kubeconfig.ErrClusterNotFound)
+
+	err = store.ReplaceContext(&kubeconfig.Context{Name: "test"}, &kubeconfig.Context{Name: "test"})
+	require.ErrorIs(t, err, kubeconfig.ErrClusterNotFound)
 
 	// Add context with key and ttl
 	err = store.AddContextWithKeyAndTTL(&kubeconfig.Context{Name: "testwithttl"}, "testwithttl", 2*time.Second)
@@ -66,5 +85,6 @@ func TestContextStore(t *testing.T) {
 	// Test GetContext
 	_, err = store.GetContext("testwithttl")
 	require.Error(t, err)
-	require.Equal(t, cache.ErrNotFound, err)
+	require.ErrorIs(t, err, cache.ErrNotFound)
+	require.ErrorIs(t, err, kubeconfig.ErrClusterNotFound)
 }
@@ -0,0 +1,117 @@
+package kubeconfig
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// cachedDial returns the dial function resolving hosts through the DNS cache
+// of the options, so new connections to clusters skip resolving them, or nil
+// if it is disabled.
+func (o *Options) cachedDial() func(ctx context.Context, network, address string) (net.Conn, error) {
+	if o.DNSCacheTTL <= 0 {
+		return nil
+	}
+
+	o.dnsCacheOnce.Do(func() {
+		o.dnsCache = newDNSCache(o.DNSCacheTTL)
+	})
+
+	return o.dnsCache.dialContext
+}
+
+type dnsEntry struct {
+	addrs      []string
+	resolvedAt time.Time
+}
+
+// dnsCache resolves host names, keeping the addresses for the TTL.
+type dnsCache struct {
+	lock    sync.Mutex
+	ttl     time.Duration
+	entries map[string]dnsEntry
+	dialer  *net.Dialer
+	// lookup resolves a host, it is net.DefaultResolver.LookupHost outside of tests.
+	lookup func(ctx context.Context, host string) ([]string, error)
+	// now returns the current time, it is time.Now outside of tests.
+	now func() time.Time
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:     ttl,
+		entries: make(map[string]dnsEntry),
+		dialer:  &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		lookup:  net.DefaultResolver.LookupHost,
+		now:     time.Now,
+	}
+}
+
+// resolve returns the addresses of the host, from the cache if they were
+// resolved less than the TTL ago.
+func (d *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	d.lock.Lock()
+	entry, ok := d.entries[host]
+	d.lock.Unlock()
+
+	if ok && d.now().Sub(entry.resolvedAt) < d.ttl {
+		return entry.addrs, nil
+	}
+
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	d.lock.Lock()
+	d.entries[host] = dnsEntry{addrs: addrs, resolvedAt: d.now()}
+	d.lock.Unlock()
+
+	return addrs, nil
+}
+
+// forget drops the cached addresses of the host, so the next dial resolves it.
+func (d *dnsCache) forget(host string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	delete(d.entries, host)
+}
+
+// dialContext connects to the address, trying each resolved address of its
+// host in turn. If none can be reached, the host is resolved again next time,
+// in case its addresses changed before the TTL ran out.
+func (d *dnsCache) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := d.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		var conn net.Conn
+
+		conn, err = d.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+
+	d.forget(host)
+
+	if err == nil {
+		err = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+
+	return nil, err
+}
@@ -0,0 +1,238 @@
+package kubeconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/client-go/rest"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+// ExtraCAs are certificate authorities trusted for upstream connections on
+// top of the system and cluster ones, eg. those of a corporate proxy.
+// The zero value trusts none.
+type ExtraCAs struct {
+	lock  sync.RWMutex
+	certs []*x509.Certificate
+	// roots are the system certificate authorities with the extra ones, and
+	// transport the default transport trusting them, built once per change.
+	roots     *x509.CertPool
+	transport http.RoundTripper
+}
+
+// Load reads the certificates of the *.pem and *.crt files in dir and trusts
+// them, replacing the previously loaded ones. Files which can't be read or
+// parsed are skipped and reported in the returned error. It returns the
+// number of certificates loaded.
+func (e *ExtraCAs) Load(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		certs []*x509.Certificate
+		errs  []error
+	)
+
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".pem" && ext != ".crt") {
+			continue
+		}
+
+		fileCerts, err := certutil.CertsFromFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("loading CA %q: %w", entry.Name(), err))
+			continue
+		}
+
+		certs = append(certs, fileCerts...)
+	}
+
+	e.Set(certs)
+
+	return len(certs), errors.Join(errs...)
+}
+
+// Set sets the extra certificate authorities to trust.
+func (e *ExtraCAs) Set(certs []*x509.Certificate) {
+	roots, transport := trustingTransport(certs)
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.certs = certs
+	e.roots = roots
+	e.transport = transport
+}
+
+// trustingTransport returns the system certificate authorities with certs,
+// and http.DefaultTransport trusting them, or nil and http.DefaultTransport
+// if there are no certs.
+func trustingTransport(certs []*x509.Certificate) (*x509.CertPool, http.RoundTripper) {
+	if len(certs) == 0 {
+		return nil, http.DefaultTransport
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+
+	for _, cert := range certs {
+		roots.AddCert(cert)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+
+	return roots, transport
+}
+
+// Certs returns the extra certificate authorities. A nil ExtraCAs has none.
+func (e *ExtraCAs) Certs() []*x509.Certificate {
+	if e == nil {
+		return nil
+	}
+
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return e.certs
+}
+
+// RootCAs returns the system certificate authorities with the extra ones, or
+// nil if there are no extra ones, meaning the system ones are used. The pool
+// is shared, so it must not be modified.
+func (e *ExtraCAs) RootCAs() *x509.CertPool {
+	if e == nil {
+		return nil
+	}
+
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return e.roots
+}
+
+// DefaultTransport returns http.DefaultTransport, trusting the extra
+// certificate authorities of the options if there are any. The transport is
+// shared, so its connections are reused until the extra certificate
+// authorities change.
+func (o *Options) DefaultTransport() http.RoundTripper {
+	if o.ExtraCAs == nil {
+		return http.DefaultTransport
+	}
+
+	o.ExtraCAs.lock.RLock()
+	defer o.ExtraCAs.lock.RUnlock()
+
+	if o.ExtraCAs.transport == nil {
+		return http.DefaultTransport
+	}
+
+	return o.ExtraCAs.transport
+}
+
+// extraCATLSConfig returns the TLS config of restConf, trusting the extra
+// certificate authorities on top of the cluster's CA if it has one, the system
+// ones otherwise. It returns nil if there are no extra ones to trust.
+func extraCATLSConfig(restConf *rest.Config, extraCAs *ExtraCAs) (*tls.Config, error) {
+	certs := extraCAs.Certs()
+	if len(certs) == 0 || restConf.Insecure {
+		return nil, nil
+	}
+
+	tlsConf, err := rest.TLSConfigFor(restConf)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConf == nil {
+		tlsConf = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if tlsConf.RootCAs == nil {
+		tlsConf.RootCAs = extraCAs.RootCAs()
+	} else {
+		for _, cert := range certs {
+			tlsConf.RootCAs.AddCert(cert)
+		}
+	}
+
+	return tlsConf, nil
+}
+
+// WatchExtraCADir reloads the extra certificate authorities of the store when
+// the files in dir change, and rebuilds the proxy transports of its contexts
+// with them.
+func WatchExtraCADir(kubeConfigStore ContextStore, dir string) {
+	extraCAs := kubeConfigStore.Options().ExtraCAs
+	if extraCAs == nil {
+		log.Println("Error watching the extra CA directory: the context store has no extra CAs")
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Println("Error watching the extra CA directory:", err)
+		return
+	}
+
+	defer watcher.Close()
+
+	if err := watcher.Add(dir); err != nil {
+		log.Println("Error watching the extra CA directory:", err)
+		return
+	}
+
+	for {
+		select {
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			count, err := extraCAs.Load(dir)
+			if err != nil {
+				log.Println("watcher: error loading extra CAs", err)
+			}
+
+			log.Printf("watcher: extra CA directory changed, loaded %d certificates", count)
+
+			rebuildTransports(kubeConfigStore)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			log.Println("watcher: error watching the extra CA directory", err)
+		}
+	}
+}
+
+// rebuildTransports rebuilds the proxy transports of all the contexts.
+func rebuildTransports(kubeConfigStore ContextStore) {
+	contexts, err := kubeConfigStore.GetContexts()
+	if err != nil {
+		log.Println("Error getting contexts to rebuild their transports:", err)
+		return
+	}
+
+	for _, context := range contexts {
+		if err := context.RebuildTransport(); err != nil {
+			log.Printf("Error rebuilding the transport of context %q: %v", context.Name, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package kubeconfig
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+// Standard locations of the in-cluster configuration.
+const (
+	defaultInClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	defaultInClusterCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+var errNoInClusterAPIServer = errors.New(
+	"unable to load in-cluster configuration, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be defined")
+
+// InClusterOptions overrides where the in-cluster configuration is read from,
+// for runtimes where it is not at the standard locations. Empty fields fall
+// back to the standard service account files and service environment variables.
+type InClusterOptions struct {
+	// TokenFile is the path of the service account token.
+	TokenFile string
+	// CAFile is the path of the certificate authority of the API server.
+	CAFile string
+	// APIServer is the address of the API server, eg. "10.0.0.1:443" or
+	// "https://kubernetes.default.svc".
+	APIServer string
+}
+
+// isSet returns true if any of the locations is overridden.
+func (o InClusterOptions) isSet() bool {
+	return o.TokenFile != "" || o.CAFile != "" || o.APIServer != ""
+}
+
+// inClusterRESTConfig returns the in-cluster configuration, read from the
+// locations of the options.
+func inClusterRESTConfig(opts InClusterOptions) (*rest.Config, error) {
+	if !opts.isSet() {
+		return rest.InClusterConfig()
+	}
+
+	host := opts.APIServer
+	if host == "" {
+		serviceHost, servicePort := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if serviceHost == "" || servicePort == "" {
+			return nil, errNoInClusterAPIServer
+		}
+
+		host = net.JoinHostPort(serviceHost, servicePort)
+	}
+
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+
+	tokenFile := opts.TokenFile
+	if tokenFile == "" {
+		tokenFile = defaultInClusterTokenFile
+	}
+
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	caFile := opts.CAFile
+	if caFile == "" {
+		caFile = defaultInClusterCAFile
+	}
+
+	if _, err := certutil.NewPool(caFile); err != nil {
+		return nil, err
+	}
+
+	return &rest.Config{
+		Host:            host,
+		TLSClientConfig: rest.TLSClientConfig{CAFile: caFile},
+		BearerToken:     string(token),
+		BearerTokenFile: tokenFile,
+	}, nil
+}
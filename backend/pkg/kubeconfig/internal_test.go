@@ -0,0 +1,408 @@
+package kubeconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// TestProxyRequestWhileBuilding tests that requests arriving while the proxy
+// is being set up get ErrProxyNotReady instead of using a nil proxy.
+func TestProxyRequestWhileBuilding(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	c := &Context{
+		Name:        "building",
+		KubeContext: &api.Context{Cluster: "building"},
+		Cluster:     &api.Cluster{Server: upstream.URL},
+	}
+
+	// Simulate a slow proxy build in progress.
+	atomic.StoreInt32(&c.proxyBuilding, 1)
+
+	request, err := http.NewRequestWithContext(context.Background(), "GET", "/version", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	err = c.ProxyRequest(rr, request)
+	assert.ErrorIs(t, err, ErrProxyNotReady)
+	assert.ErrorIs(t, c.SetupProxy(), ErrProxyNotReady)
+	assert.Nil(t, c.proxy)
+
+	// Once the build is done, requests are proxied.
+	atomic.StoreInt32(&c.proxyBuilding, 0)
+
+	err = c.ProxyRequest(rr, request)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotNil(t, c.proxy)
+}
+
+func TestRetryClassification(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+
+	_, refused := http.Get("http://" + listener.Addr().String()) //nolint:noctx,bodyclose
+
+	// A server which accepts connections but never completes the TLS handshake.
+	stalled, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer stalled.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		if conn, err := stalled.Accept(); err == nil {
+			<-done
+			conn.Close()
+		}
+	}()
+
+	client := &http.Client{Transport: &http.Transport{TLSHandshakeTimeout: time.Millisecond}}
+	_, tlsTimeout := client.Get("https://" + stalled.Addr().String()) //nolint:noctx,bodyclose
+
+	errorTests := map[string]struct {
+		err       error
+		transient bool
+	}{
+		"connection_refused":    {err: refused, transient: true},
+		"tls_handshake_timeout": {err: tlsTimeout, transient: true},
+		"other_error":           {err: errors.New("invalid URL"), transient: false},
+		"no_error":              {err: nil, transient: false},
+	}
+
+	for name, tc := range errorTests {
+		assert.Equal(t, tc.transient, isTransientError(tc.err), name)
+	}
+
+	for status, transient := range map[int]bool{
+		http.StatusServiceUnavailable:  true,
+		http.StatusBadGateway:          true,
+		http.StatusGatewayTimeout:      true,
+		http.StatusOK:                  false,
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusNotFound:            false,
+		http.StatusInternalServerError: false,
+	} {
+		assert.Equal(t, transient, isTransientStatus(status), status)
+	}
+
+	for method, retryable := range map[string]bool{
+		http.MethodGet:    true,
+		http.MethodHead:   true,
+		http.MethodPost:   false,
+		http.MethodPatch:  false,
+		http.MethodDelete: false,
+	} {
+		req, err := http.NewRequestWithContext(context.Background(), method, "/api/v1/pods", nil)
+		require.NoError(t, err)
+		assert.Equal(t, retryable, isRetryableRequest(req), method)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/v1/pods", strings.NewReader("{}"))
+	require.NoError(t, err)
+	assert.False(t, isRetryableRequest(req), "GET with a body")
+}
+
+func TestRetryTransport(t *testing.T) {
+	var requests int32
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first two requests of each method.
+		if atomic.AddInt32(&requests, 1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	c := &Context{
+		Name:        "flaky",
+		KubeContext: &api.Context{Cluster: "flaky"},
+		Cluster:     &api.Cluster{Server: upstream.URL},
+		options:     &Options{RetryPolicy: RetryPolicy{Retries: 2, Backoff: time.Millisecond}},
+	}
+
+	require.NoError(t, c.SetupProxy())
+
+	proxyStatus := func(method string) int {
+		request, err := http.NewRequestWithContext(context.Background(), method, "/api/v1/pods", nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		require.NoError(t, c.ProxyRequest(rr, request))
+
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, proxyStatus(http.MethodGet))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	atomic.StoreInt32(&requests, 0)
+
+	// POSTs are not retried.
+	assert.Equal(t, http.StatusServiceUnavailable, proxyStatus(http.MethodPost))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+// TestDNSCache tests that hosts are resolved once per TTL, and again once
+// their cached addresses can't be reached.
+func TestDNSCache(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			conn.Close()
+		}
+	}()
+
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	var lookups int32
+
+	addrs := []string{"127.0.0.1"}
+	now := time.Now()
+
+	cache := newDNSCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	cache.lookup = func(ctx context.Context, host string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		assert.Equal(t, "cluster.example.com", host)
+
+		return addrs, nil
+	}
+
+	dial := func() error {
+		conn, err := cache.dialContext(context.Background(), "tcp", net.JoinHostPort("cluster.example.com", port))
+		if err == nil {
+			conn.Close()
+		}
+
+		return err
+	}
+
+	require.NoError(t, dial())
+	require.NoError(t, dial())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lookups), "the second dial uses the cached address")
+
+	now = now.Add(time.Minute)
+
+	require.NoError(t, dial())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&lookups), "the address expired")
+
+	// Nothing listens on the address anymore, eg. as the host moved, so the
+	// cached address is dropped.
+	closedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	_, closedPort, err := net.SplitHostPort(closedListener.Addr().String())
+	require.NoError(t, err)
+	closedListener.Close()
+
+	_, err = cache.dialContext(context.Background(), "tcp", net.JoinHostPort("cluster.example.com", closedPort))
+	require.Error(t, err)
+
+	require.NoError(t, dial())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&lookups), "the host is resolved again after a failed dial")
+
+	// Addresses are dialed without resolving them.
+	require.NoError(t, func() error {
+		conn, err := cache.dialContext(context.Background(), "tcp", listener.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+
+		return err
+	}())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&lookups))
+}
+
+// TestPinnedCertificateDNSCache tests that the transports of pinned contexts
+// resolve hosts through the DNS cache too.
+func TestPinnedCertificateDNSCache(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	_, port, err := net.SplitHostPort(upstream.Listener.Addr().String())
+	require.NoError(t, err)
+
+	var lookups int32
+
+	cache := newDNSCache(time.Minute)
+	cache.lookup = func(ctx context.Context, host string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		assert.Equal(t, "pinned.example.com", host)
+
+		return []string{"127.0.0.1"}, nil
+	}
+
+	options := &Options{DNSCacheTTL: time.Minute}
+	options.dnsCacheOnce.Do(func() { options.dnsCache = cache })
+
+	fingerprint := sha256.Sum256(upstream.Certificate().Raw)
+
+	c := &Context{
+		Name: "pinned-dns-cache",
+		KubeContext: &api.Context{
+			Cluster: "pinned-dns-cache",
+			Extensions: map[string]runtime.Object{
+				HeadlampInfoExtension: &runtime.Unknown{
+					Raw: []byte(`{"pinnedCertSHA256": "` + hex.EncodeToString(fingerprint[:]) + `"}`),
+				},
+			},
+		},
+		// The host only resolves through the DNS cache.
+		Cluster: &api.Cluster{Server: "https://" + net.JoinHostPort("pinned.example.com", port)},
+		options: options,
+	}
+
+	request, err := http.NewRequestWithContext(context.Background(), "GET", "/version", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	require.NoError(t, c.ProxyRequest(rr, request))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lookups))
+}
+
+// TestTransportTuning tests that the transports of the proxies are tuned as set.
+func TestTransportTuning(t *testing.T) {
+	restConf := &rest.Config{Host: "https://cluster.example.com"}
+	require.NoError(t, tuneTransport(restConf, TransportTuning{}))
+	assert.Nil(t, restConf.Transport, "the transport of client-go is used without tuning")
+
+	restConf = &rest.Config{Host: "https://cluster.example.com", TLSClientConfig: rest.TLSClientConfig{Insecure: true}}
+	require.NoError(t, tuneTransport(restConf, TransportTuning{MaxConnsPerHost: 10, DisableKeepAlives: true}))
+
+	transport, ok := restConf.Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.Equal(t, 10, transport.MaxConnsPerHost)
+	assert.Equal(t, defaultIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.True(t, transport.DisableKeepAlives)
+	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify, "TLS settings are kept")
+
+	require.NoError(t, tuneTransport(restConf, TransportTuning{MaxIdleConns: 100}))
+	assert.Equal(t, 100, transport.MaxIdleConnsPerHost)
+	assert.Zero(t, transport.MaxConnsPerHost)
+
+	// Requests through the proxy use a new connection each without keep-alives.
+	var (
+		lock    sync.Mutex
+		clients = map[string]bool{}
+	)
+
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		clients[r.RemoteAddr] = true
+	}))
+	defer upstream.Close()
+
+	c := &Context{
+		Name:        "tuned",
+		KubeContext: &api.Context{Cluster: "tuned"},
+		Cluster:     &api.Cluster{Server: upstream.URL, InsecureSkipTLSVerify: true},
+		options:     &Options{TransportTuning: TransportTuning{DisableKeepAlives: true}},
+	}
+
+	for i := 0; i < 2; i++ {
+		request, err := http.NewRequestWithContext(context.Background(), "GET", "/version", nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		require.NoError(t, c.ProxyRequest(rr, request))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	assert.Len(t, clients, 2)
+}
+
+// TestLazyProxySetup tests that lazy proxies are set up on their first
+// request, once, instead of when their context is loaded.
+func TestLazyProxySetup(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	config := &api.Config{
+		Clusters: map[string]*api.Cluster{"lazy": {Server: upstream.URL}},
+		Contexts: map[string]*api.Context{"lazy": {Cluster: "lazy"}},
+	}
+
+	contexts, errs := LoadContextsFromAPIConfigWithOptions(config, false, &Options{LazyProxySetup: true})
+	require.Empty(t, errs)
+	require.Len(t, contexts, 1)
+
+	c := &contexts[0]
+	assert.Nil(t, c.proxy, "not set up when loaded")
+	assert.Equal(t, StatusOK, c.Status())
+
+	// Requests arriving together on first use all wait for the setup.
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			request, err := http.NewRequestWithContext(context.Background(), "GET", "/version", nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			rr := httptest.NewRecorder()
+			if assert.NoError(t, c.ProxyRequest(rr, request)) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	proxy := c.proxy
+	require.NotNil(t, proxy, "set up on first use")
+
+	request, err := http.NewRequestWithContext(context.Background(), "GET", "/version", nil)
+	require.NoError(t, err)
+	require.NoError(t, c.ProxyRequest(httptest.NewRecorder(), request))
+	assert.Same(t, proxy, c.proxy, "kept once set up")
+
+	contexts, errs = LoadContextsFromAPIConfig(config, false)
+	require.Empty(t, errs)
+	assert.NotNil(t, contexts[0].proxy, "set up when loaded by default")
+}
@@ -1,17 +1,24 @@
 package kubeconfig
 
 import (
+	"crypto/tls"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync/atomic"
 
+	"github.com/gobwas/glob"
 	zlog "github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -27,6 +34,44 @@ const (
 	InCluster
 )
 
+// ServerNamePlaceholder is replaced by the requested cluster name in the server
+// URL of a wildcard context, eg. "https://api.{cluster}.example.com".
+const ServerNamePlaceholder = "{cluster}"
+
+// HeadlampInfoExtension is the name of the kubeconfig context extension
+// holding Headlamp specific settings of a context.
+const HeadlampInfoExtension = "headlamp_info"
+
+// ErrProxyNotReady is returned when a request arrives while the proxy of a
+// context is still being set up.
+var ErrProxyNotReady = errors.New("proxy is not ready")
+
+// ErrProxyTransport is returned when the transport of the proxy of a context
+// can't be built, eg. from broken credentials. The error is also reported in
+// the status of the context.
+var ErrProxyTransport = errors.New("failed to build proxy transport")
+
+var (
+	// ErrClusterNotFound is returned when a context or its cluster doesn't exist.
+	ErrClusterNotFound = errors.New("cluster not found")
+	// ErrMissingClientKey is returned when a context has a client certificate
+	// but not its key.
+	ErrMissingClientKey = errors.New("client certificate has no client key")
+	// ErrCADataUnavailable is returned when the certificate authority file of a
+	// cluster can't be read.
+	ErrCADataUnavailable = errors.New("certificate authority data is unavailable")
+	// ErrInvalidClusterName is returned when a cluster name can't fill in the
+	// server URL of a wildcard context.
+	ErrInvalidClusterName = errors.New("invalid cluster name")
+	// ErrPathNotAllowed is returned when a context doesn't allow requesting a path
+	// from its cluster.
+	ErrPathNotAllowed = errors.New("path is not allowed for this cluster")
+)
+
+// placeholderLabel stands for ServerNamePlaceholder in a server URL, as a valid
+// host label, to find where the cluster name goes once it is parsed.
+const placeholderLabel = "headlamp-cluster-placeholder"
+
 // Context contains all information related to a kubernetes context.
 type Context struct {
 	Name        string                 `json:"name"`
@@ -37,8 +82,81 @@ type Context struct {
 	OidcConf    *OidcConfig            `json:"oidcConfig"`
 	proxy       *httputil.ReverseProxy `json:"-"`
 	Internal    bool                   `json:"internal"`
+	// proxyBuilding is set to 1 while SetupProxy is running.
+	proxyBuilding int32
+	status        *proxyStatus
+	// transport of the proxy, rebuilt by ReloadCA.
+	transport *swappableTransport
+	// wildcardOf is the name of the wildcard context this one was built from.
+	wildcardOf string
+	// options are the settings of the store of the context, nil for the defaults.
+	options *Options
+	// parsedInfo is the HeadlampInfoExtension of the context, parsed when it
+	// is loaded.
+	parsedInfo *parsedHeadlampInfo
 }
 
+// HeadlampInfo holds the Headlamp specific settings of a context.
+type HeadlampInfo struct {
+	// AllowedPaths are glob patterns of the API paths that can be proxied to
+	// the cluster, eg. "/api/v1/*". All paths are allowed if it is empty.
+	AllowedPaths []string `json:"allowedPaths,omitempty"`
+	// PinnedCertSHA256 is the hex SHA-256 fingerprint of the API server
+	// certificate. If set, only that certificate is accepted, whatever signed it.
+	PinnedCertSHA256 string `json:"pinnedCertSHA256,omitempty"`
+	// RequestLog overrides how requests proxied to the cluster are logged:
+	// RequestLogOff, RequestLogFull or RequestLogRedacted.
+	RequestLog string `json:"requestLog,omitempty"`
+	// Servers are other addresses of the API server of the cluster, eg. of
+	// each control plane node. Requests are balanced across them and the
+	// cluster server in round-robin, skipping the ones which recently failed.
+	// Only their scheme and host are used, paths are the cluster server's.
+	Servers []string `json:"servers,omitempty"`
+	// IgnoreClientAuth overrides whether the Authorization header of clients
+	// is ignored, so requests always use the context's credentials.
+	IgnoreClientAuth *bool `json:"ignoreClientAuth,omitempty"`
+	// UpstreamPathPrefix is prepended to the API paths requested from the
+	// cluster, eg. "/k8s-api" for an API server behind an ingress subpath.
+	UpstreamPathPrefix string `json:"upstreamPathPrefix,omitempty"`
+	// MaxWatches overrides the maximum number of concurrent watches of the
+	// cluster.
+	MaxWatches int `json:"maxWatches,omitempty"`
+	// TrailingSlash is what is done with the trailing slash of the API paths
+	// requested from the cluster: TrailingSlashPreserve, the default, or
+	// TrailingSlashStrip for API servers which don't find paths ending with one.
+	TrailingSlash string `json:"trailingSlash,omitempty"`
+	// HealthCheckPath is the API path requested to check that the cluster is
+	// reachable, for clusters which restrict the default, DefaultHealthCheckPath.
+	HealthCheckPath string `json:"healthCheckPath,omitempty"`
+	// AllowedGroups are the groups of the identities the cluster is listed to,
+	// when clusters are filtered by group. If it is empty, it is listed to all
+	// authenticated identities.
+	AllowedGroups []string `json:"allowedGroups,omitempty"`
+	// Public lists the cluster to anonymous users too, when clusters are
+	// filtered by group.
+	Public bool `json:"public,omitempty"`
+}
+
+// DefaultHealthCheckPath is the API path requested to check that a cluster is
+// reachable, unless it sets another one.
+const DefaultHealthCheckPath = "/version"
+
+// Ways of handling the trailing slash of proxied API paths.
+const (
+	TrailingSlashPreserve = "preserve"
+	TrailingSlashStrip    = "strip"
+)
+
+// Modes of logging proxied requests.
+const (
+	RequestLogOff = "off"
+	// RequestLogFull logs the method and full URL of each request.
+	RequestLogFull = "full"
+	// RequestLogRedacted logs the method and path of each request, with
+	// namespace and resource names replaced by "*" and without the query.
+	RequestLogRedacted = "redacted"
+)
+
 type OidcConfig struct {
 	ClientID     string
 	ClientSecret string
@@ -82,12 +200,98 @@ func (c *Context) ClientConfig() clientcmd.ClientConfig {
 
 // RESTConfig returns a rest.Config for the context.
 func (c *Context) RESTConfig() (*rest.Config, error) {
+	return c.restConfig(nil)
+}
+
+// restConfig returns a rest.Config for the context, trusting caData instead
+// of the cluster's certificate authority if it is set.
+func (c *Context) restConfig(caData []byte) (*rest.Config, error) {
+	if err := c.checkCredentials(caData == nil); err != nil {
+		return nil, err
+	}
+
 	clientConfig := c.ClientConfig()
 	if clientConfig == nil {
 		return nil, errors.New("clientConfig is nil")
 	}
 
-	return clientConfig.ClientConfig()
+	restConf, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	restConf.UserAgent = c.opts().userAgent()
+
+	if dial := c.opts().cachedDial(); dial != nil {
+		restConf.Dial = dial
+	}
+
+	if caData != nil {
+		restConf.CAFile = ""
+		restConf.CAData = caData
+	}
+
+	info, err := c.HeadlampInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.UpstreamPathPrefix != "" {
+		host, err := url.Parse(restConf.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		restConf.Host = withPathPrefix(host, info.UpstreamPathPrefix).String()
+	}
+
+	if err := c.restrictPaths(restConf); err != nil {
+		return nil, err
+	}
+
+	var tlsConf *tls.Config
+
+	if info.PinnedCertSHA256 != "" {
+		tlsConf, err = pinnedTLSConfig(restConf, info.PinnedCertSHA256)
+	} else {
+		tlsConf, err = extraCATLSConfig(restConf, c.opts().ExtraCAs)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConf != nil {
+		proxyURL := ""
+		if c.Cluster != nil {
+			proxyURL = c.Cluster.ProxyURL
+		}
+
+		key := tlsTransportKey(restConf, proxyURL, info.PinnedCertSHA256, c.opts().ExtraCAs.Certs())
+		c.opts().tlsTransports.use(restConf, tlsConf, c.Name, key)
+	}
+
+	return restConf, nil
+}
+
+// checkCredentials returns ErrMissingClientKey if the context has a client
+// certificate without its key and, if checkCA is set, ErrCADataUnavailable if
+// the certificate authority file of the cluster can't be read.
+func (c *Context) checkCredentials(checkCA bool) error {
+	if authInfo := c.AuthInfo; authInfo != nil &&
+		(len(authInfo.ClientCertificateData) > 0 || authInfo.ClientCertificate != "") &&
+		len(authInfo.ClientKeyData) == 0 && authInfo.ClientKey == "" {
+		return fmt.Errorf("%w for context %q", ErrMissingClientKey, c.Name)
+	}
+
+	if checkCA && c.Cluster != nil && len(c.Cluster.CertificateAuthorityData) == 0 &&
+		c.Cluster.CertificateAuthority != "" {
+		if _, err := os.Stat(c.Cluster.CertificateAuthority); err != nil {
+			return fmt.Errorf("%w for context %q: %w", ErrCADataUnavailable, c.Name, err)
+		}
+	}
+
+	return nil
 }
 
 // OidcConfig returns the oidc config for the context.
@@ -109,15 +313,27 @@ func (c *Context) OidcConfig() (*OidcConfig, error) {
 }
 
 // ProxyRequest proxies the given request to the cluster.
+// It returns ErrProxyNotReady if the proxy is being set up by another request,
+// or its setup is being retried, and the error of the setup if it fails.
+// Once set up, the proxy serves requests while it is set up again, until it
+// is replaced.
 func (c *Context) ProxyRequest(writer http.ResponseWriter, request *http.Request) error {
-	if c.proxy == nil {
-		err := c.SetupProxy()
+	// Pending contexts are set up in the background, not on first use.
+	if c.IsPending() {
+		return ErrProxyNotReady
+	}
+
+	proxy := c.getProxy()
+	if proxy == nil {
+		var err error
+
+		proxy, err = c.proxyOnFirstUse()
 		if err != nil {
 			return err
 		}
 	}
 
-	c.proxy.ServeHTTP(writer, request)
+	proxy.ServeHTTP(writer, request)
 
 	return nil
 }
@@ -150,30 +366,332 @@ func (c *Context) SourceStr() string {
 	}
 }
 
+// upstreamURL returns the URL of the cluster server requests are proxied to,
+// with the upstream path prefix of the cluster if it has one.
+func (c *Context) upstreamURL() (*url.URL, error) {
+	URL, err := url.Parse(c.Cluster.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := c.HeadlampInfo()
+	if err != nil || info.UpstreamPathPrefix == "" {
+		return URL, nil //nolint:nilerr // a broken Headlamp info is reported by RESTConfig
+	}
+
+	return withPathPrefix(URL, info.UpstreamPathPrefix), nil
+}
+
+// withPathPrefix returns u with prefix appended to its path. Unlike
+// url.JoinPath, the path stays absolute when u has none.
+func withPathPrefix(u *url.URL, prefix string) *url.URL {
+	prefixed := *u
+	prefixed.Path = path.Join("/", u.Path, prefix)
+	prefixed.RawPath = ""
+
+	return &prefixed
+}
+
+// newTransport returns the transport of the proxy of the context, built from
+// its kubeconfig settings.
+func (c *Context) newTransport() (*swappableTransport, error) {
+	restConf, err := c.RESTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	roundTripper, err := proxyTransportFor(restConf, c.opts().TransportTuning)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSwappableTransport(roundTripper, c.caData()), nil
+}
+
+// Copy returns a copy of the context without its proxy, for setting up a new
+// proxy while the context is in use. The copy shares the status of the context
+// until its own proxy is set up.
+func (c *Context) Copy() *Context {
+	return &Context{
+		Name:        c.Name,
+		KubeContext: c.KubeContext,
+		Cluster:     c.Cluster,
+		AuthInfo:    c.AuthInfo,
+		Source:      c.Source,
+		OidcConf:    c.OidcConf,
+		Internal:    c.Internal,
+		status:      c.status,
+		wildcardOf:  c.wildcardOf,
+		options:     c.options,
+		parsedInfo:  c.parsedInfo,
+	}
+}
+
 // SetupProxy sets up a reverse proxy for the context.
+// Only one setup runs at a time; concurrent calls return ErrProxyNotReady.
+// If the setup fails, the error is recorded in the status of the context and
+// no proxy is installed.
 func (c *Context) SetupProxy() error {
-	URL, err := url.Parse(c.Cluster.Server)
+	if !atomic.CompareAndSwapInt32(&c.proxyBuilding, 0, 1) {
+		return ErrProxyNotReady
+	}
+
+	defer atomic.StoreInt32(&c.proxyBuilding, 0)
+
+	status := &proxyStatus{pending: c.IsPending()}
+
+	URL, err := c.upstreamURL()
 	if err != nil {
+		status.set(err)
+		c.status = status
+
 		return err
 	}
 
 	proxy := httputil.NewSingleHostReverseProxy(URL)
-
-	restConf, err := c.RESTConfig()
-	if err == nil {
-		roundTripper, err := rest.TransportFor(restConf)
+	proxy.ErrorHandler = status.errorHandler
+	proxy.ModifyResponse = status.modifyResponse
+	// Flush every write, so streamed responses of a known length, eg. from
+	// aggregated API servers, are not held back until the buffer fills up.
+	proxy.FlushInterval = -1
+
+	// Always identify as Headlamp upstream, so requests can be attributed in audit logs.
+	director := proxy.Director
+	userAgent := c.opts().userAgent()
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	var transport *swappableTransport
+
+	if roundTripper := customTransport(c); roundTripper != nil {
+		proxy.Transport = roundTripper
+	} else {
+		transport, err = c.newTransport()
 		if err == nil {
-			proxy.Transport = roundTripper
+			proxy.Transport = transport
 		}
 	}
 
-	c.proxy = proxy
+	if err == nil {
+		proxy.Transport, err = c.balanceServers(URL, proxy.Transport)
+	}
+
+	status.set(err)
+	c.status = status
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrProxyTransport, err)
+	}
+
+	proxy.Transport = retryRequests(proxy.Transport, c.opts().RetryPolicy)
+
+	c.setProxy(proxy)
+	c.transport = transport
 
 	zlog.Info().Msgf("Proxy setup for context %q to cluster url %q", c.Name, c.Cluster.Server)
 
 	return nil
 }
 
+// IsWildcardName returns true if the context name is a glob pattern, eg. "team-*".
+func IsWildcardName(name string) bool {
+	return strings.ContainsAny(name, "*?[{")
+}
+
+// ForClusterName returns a copy of a wildcard context for the given cluster name.
+// Occurrences of ServerNamePlaceholder in the server URL are replaced by the name,
+// which must be a DNS label and so can't change the host the URL points to.
+// The copy is internal, so it is not listed as a cluster of its own.
+func (c *Context) ForClusterName(name string) (*Context, error) {
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return nil, fmt.Errorf("%w %q: %s", ErrInvalidClusterName, name, strings.Join(errs, ", "))
+	}
+
+	server, err := serverForClusterName(c.Cluster.Server, name)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := c.Cluster.DeepCopy()
+	cluster.Server = server
+
+	return &Context{
+		Name:        name,
+		KubeContext: c.KubeContext,
+		Cluster:     cluster,
+		AuthInfo:    c.AuthInfo,
+		Source:      c.Source,
+		OidcConf:    c.OidcConf,
+		Internal:    true,
+		wildcardOf:  c.Name,
+		options:     c.options,
+		parsedInfo:  c.parsedInfo,
+	}, nil
+}
+
+// serverForClusterName returns the server URL of a wildcard context with the
+// cluster name in place of ServerNamePlaceholder, checking that its scheme and
+// host are still the ones of the template.
+func serverForClusterName(template, name string) (string, error) {
+	templateURL, err := url.Parse(strings.ReplaceAll(template, ServerNamePlaceholder, placeholderLabel))
+	if err != nil {
+		return "", err
+	}
+
+	server := strings.ReplaceAll(template, ServerNamePlaceholder, name)
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("%w %q: %v", ErrInvalidClusterName, name, err)
+	}
+
+	if serverURL.Scheme != templateURL.Scheme ||
+		serverURL.Host != strings.ReplaceAll(templateURL.Host, placeholderLabel, name) {
+		return "", fmt.Errorf("%w %q: it changes the server host", ErrInvalidClusterName, name)
+	}
+
+	return server, nil
+}
+
+// WildcardOf returns the name of the wildcard context the context was built
+// from by ForClusterName, or "" if it was not.
+func (c *Context) WildcardOf() string {
+	return c.wildcardOf
+}
+
+// parsedHeadlampInfo is the HeadlampInfoExtension of a context, with its
+// allowed paths compiled, so that requests don't parse it again.
+type parsedHeadlampInfo struct {
+	info         *HeadlampInfo
+	err          error
+	allowedPaths []glob.Glob
+}
+
+// parseHeadlampInfo parses the HeadlampInfoExtension of a kubeconfig context.
+// Allowed paths which aren't valid patterns are left out, so they match nothing.
+func parseHeadlampInfo(kubeContext *api.Context) *parsedHeadlampInfo {
+	info, err := decodeHeadlampInfo(kubeContext)
+	if err != nil {
+		return &parsedHeadlampInfo{err: err}
+	}
+
+	parsed := &parsedHeadlampInfo{info: info}
+
+	for _, pattern := range info.AllowedPaths {
+		if g, err := glob.Compile(pattern); err == nil {
+			parsed.allowedPaths = append(parsed.allowedPaths, g)
+		}
+	}
+
+	return parsed
+}
+
+// loadHeadlampInfo parses the HeadlampInfoExtension of the context, unless it
+// was already.
+func (c *Context) loadHeadlampInfo() {
+	if c.parsedInfo == nil {
+		c.parsedInfo = parseHeadlampInfo(c.KubeContext)
+	}
+}
+
+// headlampInfo returns the parsed HeadlampInfoExtension of the context. Contexts
+// which weren't loaded, eg. built by hand, have it parsed on each call.
+func (c *Context) headlampInfo() *parsedHeadlampInfo {
+	if c.parsedInfo != nil {
+		return c.parsedInfo
+	}
+
+	return parseHeadlampInfo(c.KubeContext)
+}
+
+// HeadlampInfo returns the settings stored in the HeadlampInfoExtension of the
+// context, or empty settings if there are none. The settings are parsed once,
+// when the context is loaded, and shared, so they must not be modified.
+func (c *Context) HeadlampInfo() (*HeadlampInfo, error) {
+	parsed := c.headlampInfo()
+
+	return parsed.info, parsed.err
+}
+
+// decodeHeadlampInfo decodes and validates the HeadlampInfoExtension of a
+// kubeconfig context.
+func decodeHeadlampInfo(kubeContext *api.Context) (*HeadlampInfo, error) {
+	info := &HeadlampInfo{}
+
+	if kubeContext == nil || kubeContext.Extensions[HeadlampInfoExtension] == nil {
+		return info, nil
+	}
+
+	raw, err := json.Marshal(kubeContext.Extensions[HeadlampInfoExtension])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(raw, info); err != nil {
+		return nil, fmt.Errorf("invalid %s extension: %w", HeadlampInfoExtension, err)
+	}
+
+	switch info.RequestLog {
+	case "", RequestLogOff, RequestLogFull, RequestLogRedacted:
+	default:
+		return nil, fmt.Errorf("invalid %s extension: unknown requestLog %q", HeadlampInfoExtension, info.RequestLog)
+	}
+
+	return info, nil
+}
+
+// IsPathAllowed returns true if the API path can be proxied to the cluster,
+// i.e. it matches one of the allowed paths of the context, or there are none.
+func (c *Context) IsPathAllowed(apiPath string) bool {
+	parsed := c.headlampInfo()
+	if parsed.err != nil {
+		// Fail closed, a broken allowlist must not expose the whole cluster.
+		return false
+	}
+
+	if len(parsed.info.AllowedPaths) == 0 {
+		return true
+	}
+
+	apiPath = path.Clean("/" + apiPath)
+
+	for _, g := range parsed.allowedPaths {
+		if g.Match(apiPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NormalizeAPIPath returns the API path to request from the cluster: without
+// its trailing slash if the context strips them, unchanged otherwise.
+func (c *Context) NormalizeAPIPath(apiPath string) string {
+	info, err := c.HeadlampInfo()
+	if err != nil || info.TrailingSlash != TrailingSlashStrip {
+		return apiPath
+	}
+
+	if trimmed := strings.TrimRight(apiPath, "/"); trimmed != "" {
+		return trimmed
+	}
+
+	return apiPath
+}
+
+// HealthCheckPath returns the API path requested to check that the cluster is
+// reachable.
+func (c *Context) HealthCheckPath() string {
+	info, err := c.HeadlampInfo()
+	if err != nil || info.HealthCheckPath == "" {
+		return DefaultHealthCheckPath
+	}
+
+	return "/" + strings.TrimPrefix(info.HealthCheckPath, "/")
+}
+
 // AuthType returns the authentication type for the context.
 func (c *Context) AuthType() string {
 	if (c.OidcConf != nil) || (c.AuthInfo != nil && c.AuthInfo.AuthProvider != nil) {
@@ -183,8 +701,49 @@ func (c *Context) AuthType() string {
 	return ""
 }
 
+// Authentication methods of a context, as reported by AuthMethod.
+const (
+	AuthMethodOIDC       = "oidc"
+	AuthMethodToken      = "token"
+	AuthMethodClientCert = "clientcert"
+	AuthMethodAnonymous  = "anonymous"
+)
+
+// AuthMethod returns how requests to the cluster of the context are
+// authenticated: "oidc" if the user logs in with OIDC, "clientcert" or "token"
+// for the credentials of the kubeconfig, and "anonymous" if there are none.
+// The in-cluster context proxies the token given by the user, so it is "token".
+func (c *Context) AuthMethod() string {
+	if c.AuthType() == "oidc" {
+		return AuthMethodOIDC
+	}
+
+	if c.Source == InCluster {
+		return AuthMethodToken
+	}
+
+	info := c.AuthInfo
+	if info == nil {
+		return AuthMethodAnonymous
+	}
+
+	switch {
+	case info.ClientCertificate != "" || len(info.ClientCertificateData) > 0:
+		return AuthMethodClientCert
+	case info.Token != "" || info.TokenFile != "" || info.Exec != nil || info.Username != "":
+		return AuthMethodToken
+	default:
+		return AuthMethodAnonymous
+	}
+}
+
 // LoadContextsFromFile loads contexts from the given kubeconfig file.
 func LoadContextsFromFile(kubeConfigPath string, source int) ([]Context, error) {
+	return loadContextsFromFile(kubeConfigPath, source, nil)
+}
+
+// loadContextsFromFile loads contexts from the given kubeconfig file, with opts.
+func loadContextsFromFile(kubeConfigPath string, source int, opts *Options) ([]Context, error) {
 	// If the file path is relative make it absolute.
 	if !filepath.IsAbs(kubeConfigPath) {
 		absPath, err := filepath.Abs(kubeConfigPath)
@@ -200,7 +759,7 @@ func LoadContextsFromFile(kubeConfigPath string, source int) ([]Context, error)
 		return nil, err
 	}
 
-	contexts, errs := LoadContextsFromAPIConfig(config, false)
+	contexts, errs := LoadContextsFromAPIConfigWithOptions(config, false, opts)
 	if errs == nil {
 		return nil, errors.Join(errs...)
 	}
@@ -217,14 +776,25 @@ func LoadContextsFromFile(kubeConfigPath string, source int) ([]Context, error)
 }
 
 // LoadContextsFromAPIConfig loads contexts from the given api.Config.
+// All the contexts are loaded whether or not there is a current context,
+// as requests are proxied to clusters by name.
 func LoadContextsFromAPIConfig(config *api.Config, skipProxySetup bool) ([]Context, []error) {
+	return LoadContextsFromAPIConfigWithOptions(config, skipProxySetup, nil)
+}
+
+// LoadContextsFromAPIConfigWithOptions loads contexts from the given
+// api.Config, with the options of the store they are added to. Nil options
+// are the defaults.
+func LoadContextsFromAPIConfigWithOptions(config *api.Config, skipProxySetup bool,
+	opts *Options,
+) ([]Context, []error) {
 	contexts := []Context{}
-	errors := []error{}
+	errs := []error{}
 
 	for contextName, context := range config.Contexts {
 		cluster := config.Clusters[context.Cluster]
 		if cluster == nil {
-			errors = append(errors, fmt.Errorf("cluster not found for context: %q", contextName))
+			errs = append(errs, fmt.Errorf("%w for context: %q", ErrClusterNotFound, contextName))
 			continue
 		}
 
@@ -236,12 +806,18 @@ func LoadContextsFromAPIConfig(config *api.Config, skipProxySetup bool) ([]Conte
 			KubeContext: context,
 			Cluster:     cluster,
 			AuthInfo:    authInfo,
+			options:     opts,
 		}
+		context.loadHeadlampInfo()
 
-		if !skipProxySetup {
+		// Wildcard contexts are templates, their proxies are set up per matched cluster.
+		// Lazy proxies are set up on their first request.
+		if !skipProxySetup && !context.opts().LazyProxySetup && !IsWildcardName(contextName) {
+			// Contexts whose transport can't be built are kept, reporting the error
+			// in their status, but those without a proxy at all are skipped.
 			err := context.SetupProxy()
-			if err != nil {
-				errors = append(errors, fmt.Errorf("couldnt setup proxy for context: %q, err:%q", contextName, err))
+			if err != nil && !errors.Is(err, ErrProxyTransport) {
+				errs = append(errs, fmt.Errorf("couldnt setup proxy for context: %q, err: %w", contextName, err))
 				continue
 			}
 		}
@@ -249,11 +825,16 @@ func LoadContextsFromAPIConfig(config *api.Config, skipProxySetup bool) ([]Conte
 		contexts = append(contexts, context)
 	}
 
-	return contexts, errors
+	return contexts, errs
 }
 
 // LoadContextsFromMultipleFiles loads contexts from the given kubeconfig files.
 func LoadContextsFromMultipleFiles(kubeConfigs string, source int) ([]Context, error) {
+	return loadContextsFromMultipleFiles(kubeConfigs, source, nil)
+}
+
+// loadContextsFromMultipleFiles loads contexts from the given kubeconfig files, with opts.
+func loadContextsFromMultipleFiles(kubeConfigs string, source int, opts *Options) ([]Context, error) {
 	var contexts []Context
 
 	var errs []error
@@ -262,7 +843,7 @@ func LoadContextsFromMultipleFiles(kubeConfigs string, source int) ([]Context, e
 	for _, kubeConfigPath := range kubeConfigPaths {
 		kubeConfigPath := kubeConfigPath
 
-		kubeConfigContexts, err := LoadContextsFromFile(kubeConfigPath, source)
+		kubeConfigContexts, err := loadContextsFromFile(kubeConfigPath, source, opts)
 		if err != nil {
 			errs = append(errs, err)
 		}
@@ -273,6 +854,34 @@ func LoadContextsFromMultipleFiles(kubeConfigs string, source int) ([]Context, e
 	return contexts, errors.Join(errs...)
 }
 
+// ListContextsFromFiles returns the contexts of the given kubeconfig files,
+// without setting up their proxies, eg. to list them. Files which can't be
+// loaded are skipped and reported in the returned error.
+func ListContextsFromFiles(kubeConfigs string) ([]Context, error) {
+	var (
+		contexts []Context
+		errs     []error
+	)
+
+	for _, kubeConfigPath := range splitKubeConfigPath(kubeConfigs) {
+		if kubeConfigPath == "" {
+			continue
+		}
+
+		config, err := clientcmd.LoadFromFile(kubeConfigPath)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		fileContexts, fileErrs := LoadContextsFromAPIConfig(config, true)
+		contexts = append(contexts, fileContexts...)
+		errs = append(errs, fileErrs...)
+	}
+
+	return contexts, errors.Join(errs...)
+}
+
 // LoadContextsFromBase64String loads contexts from the given kubeconfig string.
 func LoadContextsFromBase64String(kubeConfig string, source int) ([]Context, error) {
 	var contexts []Context
@@ -314,12 +923,12 @@ func splitKubeConfigPath(path string) []string {
 	return strings.Split(path, delimiter)
 }
 
-// GetInClusterContext returns the in-cluster context.
+// GetInClusterContext returns the in-cluster context, read from the locations of opts.
 func GetInClusterContext(oidcIssuerURL string,
 	oidcClientID string, oidcClientSecret string,
-	oidcScopes string,
+	oidcScopes string, opts InClusterOptions,
 ) (*Context, error) {
-	clusterConfig, err := rest.InClusterConfig()
+	clusterConfig, err := inClusterRESTConfig(opts)
 	if err != nil {
 		return nil, err
 	}
@@ -362,7 +971,7 @@ func GetInClusterContext(oidcIssuerURL string,
 // Note: No need to remove contexts from the store, since
 // adding a context with the same name will overwrite the old one.
 func LoadAndStoreKubeConfigs(kubeConfigStore ContextStore, kubeConfigs string, source int) error {
-	kubeConfigContexts, err := LoadContextsFromMultipleFiles(kubeConfigs, source)
+	kubeConfigContexts, err := loadContextsFromMultipleFiles(kubeConfigs, source, kubeConfigStore.Options())
 	if err != nil {
 		return err
 	}
@@ -2,16 +2,26 @@ package kubeconfig_test
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/headlamp-k8s/headlamp/backend/pkg/config"
 	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd/api"
+	certutil "k8s.io/client-go/util/cert"
 )
 
 func TestLoadAndStoreKubeConfigs(t *testing.T) {
@@ -52,6 +62,38 @@ func TestLoadContextsFromKubeConfigFile(t *testing.T) {
 		require.Equal(t, 2, len(contexts))
 	})
 
+	t.Run("no_current_context", func(t *testing.T) {
+		kubeConfigFile := filepath.Join(t.TempDir(), "kubeconfig")
+		kubeConfig := `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://one.example.com
+  name: one
+- cluster:
+    server: https://two.example.com
+  name: two
+contexts:
+- context:
+    cluster: one
+  name: one
+- context:
+    cluster: two
+  name: two
+`
+		require.NoError(t, os.WriteFile(kubeConfigFile, []byte(kubeConfig), 0o600))
+
+		contexts, err := kubeconfig.LoadContextsFromFile(kubeConfigFile, kubeconfig.KubeConfig)
+		require.NoError(t, err)
+
+		names := make([]string, 0, len(contexts))
+		for _, context := range contexts {
+			names = append(names, context.Name)
+		}
+
+		assert.ElementsMatch(t, []string{"one", "two"}, names)
+	})
+
 	t.Run("invalid_file", func(t *testing.T) {
 		kubeConfigFile := "invalid_kubeconfig"
 
@@ -120,3 +162,618 @@ func TestLoadContextsFromBase64String(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestProxyRequestUserAgent(t *testing.T) {
+	var gotUserAgent string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserAgent = r.Header.Get("User-Agent")
+	}))
+	defer upstream.Close()
+
+	newContext := func(t *testing.T, store kubeconfig.ContextStore) *kubeconfig.Context {
+		t.Helper()
+
+		kContext := &kubeconfig.Context{
+			Name:        "ua-test",
+			KubeContext: &api.Context{Cluster: "ua-test"},
+			Cluster:     &api.Cluster{Server: upstream.URL},
+		}
+		require.NoError(t, store.AddContext(kContext))
+
+		return kContext
+	}
+
+	proxy := func(t *testing.T, store kubeconfig.ContextStore) {
+		t.Helper()
+
+		request, err := http.NewRequestWithContext(context.Background(), "GET", "/version", nil)
+		require.NoError(t, err)
+		request.Header.Set("User-Agent", "Mozilla/5.0")
+
+		err = newContext(t, store).ProxyRequest(httptest.NewRecorder(), request)
+		require.NoError(t, err)
+	}
+
+	t.Run("default", func(t *testing.T) {
+		proxy(t, kubeconfig.NewContextStore())
+		assert.Equal(t, kubeconfig.DefaultUserAgent(), gotUserAgent)
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		store := kubeconfig.NewContextStoreWithOptions(&kubeconfig.Options{UserAgent: "my-agent/1.0"})
+
+		proxy(t, store)
+		assert.Equal(t, "my-agent/1.0", gotUserAgent)
+
+		restConf, err := newContext(t, store).RESTConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "my-agent/1.0", restConf.UserAgent)
+	})
+}
+
+func TestForClusterName(t *testing.T) {
+	assert.True(t, kubeconfig.IsWildcardName("team-*"))
+	assert.False(t, kubeconfig.IsWildcardName("team-blue"))
+
+	wildcard := &kubeconfig.Context{
+		Name:        "team-*",
+		KubeContext: &api.Context{Cluster: "team"},
+		Cluster:     &api.Cluster{Server: "https://api." + kubeconfig.ServerNamePlaceholder + ".example.com"},
+	}
+
+	matched, err := wildcard.ForClusterName("team-blue")
+	require.NoError(t, err)
+	assert.Equal(t, "team-blue", matched.Name)
+	assert.Equal(t, "https://api.team-blue.example.com", matched.Cluster.Server)
+	assert.True(t, matched.Internal)
+	assert.Equal(t, "team-*", matched.WildcardOf())
+
+	// The wildcard context is left untouched.
+	assert.Equal(t, "https://api.{cluster}.example.com", wildcard.Cluster.Server)
+	assert.Empty(t, wildcard.WildcardOf())
+
+	// Names which are not DNS labels could point the server elsewhere.
+	for _, name := range []string{"team-x@evil.com:443/", "evil.com/", "team-x.evil.com", "Team-Blue", ""} {
+		_, err := wildcard.ForClusterName(name)
+		assert.ErrorIs(t, err, kubeconfig.ErrInvalidClusterName, name)
+	}
+}
+
+func TestIsPathAllowed(t *testing.T) {
+	newContext := func(info string) *kubeconfig.Context {
+		return &kubeconfig.Context{
+			Name: "restricted",
+			KubeContext: &api.Context{
+				Cluster: "restricted",
+				Extensions: map[string]runtime.Object{
+					kubeconfig.HeadlampInfoExtension: &runtime.Unknown{Raw: []byte(info)},
+				},
+			},
+		}
+	}
+
+	unrestricted := &kubeconfig.Context{Name: "unrestricted", KubeContext: &api.Context{}}
+	assert.True(t, unrestricted.IsPathAllowed("/apis/batch/v1/jobs"))
+
+	restricted := newContext(`{"allowedPaths": ["/api/v1/*", "/apis/apps/*"]}`)
+	assert.True(t, restricted.IsPathAllowed("/api/v1/pods"))
+	assert.True(t, restricted.IsPathAllowed("apis/apps/v1/namespaces/default/deployments"))
+	assert.False(t, restricted.IsPathAllowed("/apis/batch/v1/jobs"))
+	assert.False(t, restricted.IsPathAllowed("/api/v1/../../apis/batch/v1/jobs"))
+
+	// A broken allowlist denies everything.
+	assert.False(t, newContext(`{"allowedPaths": "/api/v1/*"}`).IsPathAllowed("/api/v1/pods"))
+
+	// Invalid patterns match nothing.
+	invalid := newContext(`{"allowedPaths": ["[", "/api/v1/*"]}`)
+	assert.True(t, invalid.IsPathAllowed("/api/v1/pods"))
+	assert.False(t, invalid.IsPathAllowed("["))
+	assert.False(t, newContext(`{"allowedPaths": ["["]}`).IsPathAllowed("/apis/batch/v1/jobs"))
+
+	// Stored contexts are parsed once, as they are loaded.
+	stored := newContext(`{"allowedPaths": ["/api/v1/*"]}`)
+	require.NoError(t, kubeconfig.NewContextStore().AddContext(stored))
+
+	stored.KubeContext.Extensions[kubeconfig.HeadlampInfoExtension] = &runtime.Unknown{Raw: []byte(`{}`)}
+	assert.False(t, stored.IsPathAllowed("/apis/batch/v1/jobs"))
+}
+
+func TestAllowedPathsClients(t *testing.T) {
+	var requested []string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind": "PodList", "apiVersion": "v1", "items": []}`))
+	}))
+	defer upstream.Close()
+
+	kContext := &kubeconfig.Context{
+		Name: "restricted",
+		KubeContext: &api.Context{
+			Cluster: "restricted",
+			Extensions: map[string]runtime.Object{
+				kubeconfig.HeadlampInfoExtension: &runtime.Unknown{
+					Raw: []byte(`{"allowedPaths": ["/api/v1/*"], "upstreamPathPrefix": "/k8s/clusters/c-1"}`),
+				},
+			},
+		},
+		Cluster: &api.Cluster{Server: upstream.URL},
+	}
+
+	clientset, err := kContext.ClientSetWithToken("")
+	require.NoError(t, err)
+
+	// The server path isn't part of the API path which is checked.
+	_, err = clientset.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+
+	_, err = clientset.AppsV1().Deployments("default").List(context.Background(), metav1.ListOptions{})
+	assert.ErrorIs(t, err, kubeconfig.ErrPathNotAllowed)
+
+	// Clients of the client config, eg. helm's, are restricted too.
+	restConf, err := kContext.RestrictedClientConfig().ClientConfig()
+	require.NoError(t, err)
+
+	clientset, err = kubernetes.NewForConfig(restConf)
+	require.NoError(t, err)
+
+	_, err = clientset.BatchV1().Jobs("default").List(context.Background(), metav1.ListOptions{})
+	assert.ErrorIs(t, err, kubeconfig.ErrPathNotAllowed)
+
+	assert.Equal(t, []string{"/k8s/clusters/c-1/api/v1/namespaces/default/pods"}, requested)
+}
+
+func TestPinnedCertificate(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	fingerprint := sha256.Sum256(upstream.Certificate().Raw)
+
+	proxyWithPin := func(pin string) int {
+		kContext := &kubeconfig.Context{
+			Name: "pinned",
+			KubeContext: &api.Context{
+				Cluster: "pinned",
+				Extensions: map[string]runtime.Object{
+					kubeconfig.HeadlampInfoExtension: &runtime.Unknown{
+						Raw: []byte(`{"pinnedCertSHA256": "` + pin + `"}`),
+					},
+				},
+			},
+			Cluster: &api.Cluster{Server: upstream.URL},
+		}
+
+		request, err := http.NewRequestWithContext(context.Background(), "GET", "/version", nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		err = kContext.ProxyRequest(rr, request)
+		require.NoError(t, err)
+
+		return rr.Code
+	}
+
+	// The self-signed certificate is accepted only with a matching pin.
+	assert.Equal(t, http.StatusOK, proxyWithPin(hex.EncodeToString(fingerprint[:])))
+	assert.Equal(t, http.StatusOK, proxyWithPin(strings.ToUpper(hex.EncodeToString(fingerprint[:]))))
+
+	otherFingerprint := sha256.Sum256([]byte("other certificate"))
+	assert.Equal(t, http.StatusBadGateway, proxyWithPin(hex.EncodeToString(otherFingerprint[:])))
+
+	// The rest configs of the context share their transport.
+	kContext := &kubeconfig.Context{
+		Name: "pinned",
+		KubeContext: &api.Context{
+			Cluster: "pinned",
+			Extensions: map[string]runtime.Object{
+				kubeconfig.HeadlampInfoExtension: &runtime.Unknown{
+					Raw: []byte(`{"pinnedCertSHA256": "` + hex.EncodeToString(fingerprint[:]) + `"}`),
+				},
+			},
+		},
+		Cluster: &api.Cluster{Server: upstream.URL},
+	}
+
+	restConf, err := kContext.RESTConfig()
+	require.NoError(t, err)
+	require.NotNil(t, restConf.Transport)
+
+	again, err := kContext.RESTConfig()
+	require.NoError(t, err)
+	assert.Equal(t, restConf.Transport, again.Transport)
+}
+
+func TestGetInClusterContextOptions(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	caFile := filepath.Join(dir, "ca.crt")
+
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(tokenFile, []byte("sa-token"), 0o600))
+	require.NoError(t, os.WriteFile(caFile, caData, 0o600))
+
+	t.Run("custom_paths", func(t *testing.T) {
+		ctx, err := kubeconfig.GetInClusterContext("", "", "", "", kubeconfig.InClusterOptions{
+			TokenFile: tokenFile,
+			CAFile:    caFile,
+			APIServer: "10.0.0.1:6443",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "https://10.0.0.1:6443", ctx.Cluster.Server)
+		assert.Equal(t, caFile, ctx.Cluster.CertificateAuthority)
+	})
+
+	t.Run("service_env", func(t *testing.T) {
+		t.Setenv("KUBERNETES_SERVICE_HOST", "fd00::1")
+		t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+
+		ctx, err := kubeconfig.GetInClusterContext("", "", "", "", kubeconfig.InClusterOptions{
+			TokenFile: tokenFile,
+			CAFile:    caFile,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "https://[fd00::1]:443", ctx.Cluster.Server)
+	})
+
+	t.Run("missing_token", func(t *testing.T) {
+		_, err := kubeconfig.GetInClusterContext("", "", "", "", kubeconfig.InClusterOptions{
+			TokenFile: filepath.Join(dir, "missing"),
+			CAFile:    caFile,
+			APIServer: "10.0.0.1:6443",
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestReloadCA(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	otherCA, _, err := certutil.GenerateSelfSignedCertKey("other", nil, nil)
+	require.NoError(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, otherCA, 0o600))
+
+	kContext := &kubeconfig.Context{
+		Name:        "rotated",
+		KubeContext: &api.Context{Cluster: "rotated"},
+		Cluster:     &api.Cluster{Server: upstream.URL, CertificateAuthority: caFile},
+	}
+
+	proxyStatus := func() int {
+		request, err := http.NewRequestWithContext(context.Background(), "GET", "/version", nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		require.NoError(t, kContext.ProxyRequest(rr, request))
+
+		return rr.Code
+	}
+
+	// The upstream certificate is not signed by the CA yet.
+	assert.Equal(t, http.StatusBadGateway, proxyStatus())
+
+	reloaded, err := kContext.ReloadCA()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	upstreamCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, upstreamCA, 0o600))
+
+	reloaded, err = kContext.ReloadCA()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, http.StatusOK, proxyStatus())
+}
+
+func TestExtraCAs(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	options := &kubeconfig.Options{ExtraCAs: &kubeconfig.ExtraCAs{}}
+	store := kubeconfig.NewContextStoreWithOptions(options)
+
+	kContext := &kubeconfig.Context{
+		Name:        "behind-proxy",
+		KubeContext: &api.Context{Cluster: "behind-proxy"},
+		Cluster:     &api.Cluster{Server: upstream.URL},
+	}
+
+	require.NoError(t, store.AddContext(kContext))
+	require.NoError(t, kContext.SetupProxy())
+
+	proxyStatus := func() int {
+		request, err := http.NewRequestWithContext(context.Background(), "GET", "/version", nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		require.NoError(t, kContext.ProxyRequest(rr, request))
+
+		return rr.Code
+	}
+
+	externalStatus := func() (int, error) {
+		request, err := http.NewRequestWithContext(context.Background(), "GET", upstream.URL, nil)
+		require.NoError(t, err)
+
+		resp, err := (&http.Client{Transport: options.DefaultTransport()}).Do(request)
+		if err != nil {
+			return 0, err
+		}
+
+		resp.Body.Close()
+
+		return resp.StatusCode, nil
+	}
+
+	// The upstream certificate is not trusted yet.
+	assert.Equal(t, http.StatusBadGateway, proxyStatus())
+
+	_, err := externalStatus()
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	upstreamCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "upstream.pem"), upstreamCA, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0o600))
+
+	count, err := options.ExtraCAs.Load(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	require.NoError(t, kContext.RebuildTransport())
+	assert.Equal(t, http.StatusOK, proxyStatus())
+
+	status, err := externalStatus()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	// The pool and transports are built once, and rebuilt when the CAs change.
+	assert.Same(t, options.ExtraCAs.RootCAs(), options.ExtraCAs.RootCAs())
+	assert.Equal(t, options.DefaultTransport(), options.DefaultTransport())
+
+	restConf, err := kContext.RESTConfig()
+	require.NoError(t, err)
+
+	again, err := kContext.RESTConfig()
+	require.NoError(t, err)
+	assert.Equal(t, restConf.Transport, again.Transport)
+
+	defaultTransport := options.DefaultTransport()
+
+	options.ExtraCAs.Set(append(options.ExtraCAs.Certs(), upstream.Certificate()))
+
+	reloaded, err := kContext.RESTConfig()
+	require.NoError(t, err)
+	assert.NotEqual(t, restConf.Transport, reloaded.Transport)
+	assert.NotEqual(t, defaultTransport, options.DefaultTransport())
+
+	// Contexts of other stores don't trust them.
+	other := &kubeconfig.Context{
+		Name:        "behind-proxy",
+		KubeContext: &api.Context{Cluster: "behind-proxy"},
+		Cluster:     &api.Cluster{Server: upstream.URL},
+	}
+
+	require.NoError(t, kubeconfig.NewContextStore().AddContext(other))
+
+	request, err := http.NewRequestWithContext(context.Background(), "GET", "/version", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	require.NoError(t, other.ProxyRequest(rr, request))
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+}
+
+func TestBalanceServers(t *testing.T) {
+	newUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name))
+		}))
+	}
+
+	first, second := newUpstream("first"), newUpstream("second")
+	defer first.Close()
+
+	kContext := &kubeconfig.Context{
+		Name: "ha",
+		KubeContext: &api.Context{
+			Cluster: "ha",
+			Extensions: map[string]runtime.Object{
+				kubeconfig.HeadlampInfoExtension: &runtime.Unknown{
+					Raw: []byte(`{"servers": ["` + second.URL + `"]}`),
+				},
+			},
+		},
+		Cluster: &api.Cluster{Server: first.URL},
+	}
+
+	proxyCounts := func(requests int) map[string]int {
+		counts := map[string]int{}
+
+		for i := 0; i < requests; i++ {
+			request, err := http.NewRequestWithContext(context.Background(), "GET", "/version", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			require.NoError(t, kContext.ProxyRequest(rr, request))
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			counts[rr.Body.String()]++
+		}
+
+		return counts
+	}
+
+	assert.Equal(t, map[string]int{"first": 2, "second": 2}, proxyCounts(4))
+
+	// Requests fail over to the servers which are still up.
+	second.Close()
+	assert.Equal(t, map[string]int{"first": 4}, proxyCounts(4))
+}
+
+func TestAuthMethod(t *testing.T) {
+	tests := []struct {
+		name    string
+		context kubeconfig.Context
+		want    string
+	}{
+		{
+			name: "oidc",
+			context: kubeconfig.Context{AuthInfo: &api.AuthInfo{
+				AuthProvider: &api.AuthProviderConfig{Name: "oidc"},
+			}},
+			want: kubeconfig.AuthMethodOIDC,
+		},
+		{
+			name:    "token",
+			context: kubeconfig.Context{AuthInfo: &api.AuthInfo{Token: "token"}},
+			want:    kubeconfig.AuthMethodToken,
+		},
+		{
+			name:    "exec",
+			context: kubeconfig.Context{AuthInfo: &api.AuthInfo{Exec: &api.ExecConfig{Command: "login"}}},
+			want:    kubeconfig.AuthMethodToken,
+		},
+		{
+			name:    "clientcert",
+			context: kubeconfig.Context{AuthInfo: &api.AuthInfo{ClientCertificateData: []byte("cert")}},
+			want:    kubeconfig.AuthMethodClientCert,
+		},
+		{
+			name:    "anonymous",
+			context: kubeconfig.Context{AuthInfo: &api.AuthInfo{}},
+			want:    kubeconfig.AuthMethodAnonymous,
+		},
+		{
+			name:    "incluster",
+			context: kubeconfig.Context{AuthInfo: &api.AuthInfo{}, Source: kubeconfig.InCluster},
+			want:    kubeconfig.AuthMethodToken,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.context.AuthMethod())
+		})
+	}
+}
+
+func TestClusterErrors(t *testing.T) {
+	t.Run("cluster_not_found", func(t *testing.T) {
+		conf := &api.Config{
+			Contexts: map[string]*api.Context{"orphan": {Cluster: "missing"}},
+		}
+
+		_, errs := kubeconfig.LoadContextsFromAPIConfig(conf, false)
+		require.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[0], kubeconfig.ErrClusterNotFound)
+
+		_, err := kubeconfig.NewContextStore().GetContext("missing")
+		assert.ErrorIs(t, err, kubeconfig.ErrClusterNotFound)
+	})
+
+	t.Run("missing_client_key", func(t *testing.T) {
+		kContext := kubeconfig.Context{
+			Name:        "nokey",
+			KubeContext: &api.Context{Cluster: "nokey", AuthInfo: "nokey"},
+			Cluster:     &api.Cluster{Server: "https://127.0.0.1:6443"},
+			AuthInfo:    &api.AuthInfo{ClientCertificateData: []byte("cert")},
+		}
+
+		_, err := kContext.RESTConfig()
+		assert.ErrorIs(t, err, kubeconfig.ErrMissingClientKey)
+
+		_, err = kContext.ClientSetWithToken("")
+		assert.ErrorIs(t, err, kubeconfig.ErrMissingClientKey)
+
+		// The proxy setup error is reported in the status of the context.
+		err = kContext.SetupProxy()
+		assert.ErrorIs(t, err, kubeconfig.ErrProxyTransport)
+		assert.ErrorIs(t, err, kubeconfig.ErrMissingClientKey)
+		assert.Contains(t, kContext.LastError(), kubeconfig.ErrMissingClientKey.Error())
+
+		// Without a proxy, requests get the error of the setup.
+		request := httptest.NewRequest(http.MethodGet, "/version", nil)
+		err = kContext.ProxyRequest(httptest.NewRecorder(), request)
+		assert.ErrorIs(t, err, kubeconfig.ErrMissingClientKey)
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		kContext := kubeconfig.Context{
+			Name:        "pending",
+			KubeContext: &api.Context{Cluster: "pending"},
+			Cluster:     &api.Cluster{Server: "https://127.0.0.1:6443"},
+		}
+		kContext.SetPending(true)
+
+		// The proxy of a pending context is not set up on first use.
+		request := httptest.NewRequest(http.MethodGet, "/version", nil)
+		err := kContext.ProxyRequest(httptest.NewRecorder(), request)
+		assert.ErrorIs(t, err, kubeconfig.ErrProxyNotReady)
+		assert.Equal(t, kubeconfig.StatusPending, kContext.Status())
+
+		kContext.SetPending(false)
+		require.NoError(t, kContext.SetupProxy())
+		assert.Equal(t, kubeconfig.StatusOK, kContext.Status())
+	})
+
+	t.Run("invalid_server", func(t *testing.T) {
+		conf := &api.Config{
+			Clusters: map[string]*api.Cluster{
+				"invalid": {Server: "://invalid"},
+				"valid":   {Server: "https://127.0.0.1:6443"},
+			},
+			AuthInfos: map[string]*api.AuthInfo{
+				"nokey": {ClientCertificateData: []byte("cert")},
+			},
+			Contexts: map[string]*api.Context{
+				"invalid": {Cluster: "invalid"},
+				"valid":   {Cluster: "valid"},
+				"nokey":   {Cluster: "valid", AuthInfo: "nokey"},
+			},
+		}
+
+		// Contexts with an invalid server are skipped, but those whose transport
+		// can't be built are kept, reporting the error in their status.
+		contexts, errs := kubeconfig.LoadContextsFromAPIConfig(conf, false)
+		require.Len(t, errs, 1)
+		require.Len(t, contexts, 2)
+
+		statuses := map[string]string{}
+		for _, kContext := range contexts {
+			statuses[kContext.Name] = kContext.Status()
+		}
+
+		assert.Equal(t, map[string]string{"valid": kubeconfig.StatusOK, "nokey": kubeconfig.StatusError}, statuses)
+	})
+
+	t.Run("ca_data_unavailable", func(t *testing.T) {
+		kContext := kubeconfig.Context{
+			Name:        "noca",
+			KubeContext: &api.Context{Cluster: "noca"},
+			Cluster: &api.Cluster{
+				Server:               "https://127.0.0.1:6443",
+				CertificateAuthority: filepath.Join(t.TempDir(), "missing-ca.crt"),
+			},
+		}
+
+		_, err := kContext.RESTConfig()
+		assert.ErrorIs(t, err, kubeconfig.ErrCADataUnavailable)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		_, err = kContext.ClientSetWithToken("")
+		assert.ErrorIs(t, err, kubeconfig.ErrCADataUnavailable)
+	})
+}
@@ -0,0 +1,46 @@
+package kubeconfig
+
+import (
+	"net/http/httputil"
+	"sync"
+)
+
+// proxiesLock guards the proxies of the contexts, which requests read while
+// they may be set up on first use.
+var proxiesLock sync.RWMutex
+
+// firstUseSetupLock serializes the proxy setups on first use, so requests
+// arriving together wait for the first one to set up the proxy instead of
+// getting ErrProxyNotReady. Setups don't reach the cluster, so they are quick.
+var firstUseSetupLock sync.Mutex
+
+func (c *Context) getProxy() *httputil.ReverseProxy {
+	proxiesLock.RLock()
+	defer proxiesLock.RUnlock()
+
+	return c.proxy
+}
+
+func (c *Context) setProxy(proxy *httputil.ReverseProxy) {
+	proxiesLock.Lock()
+	defer proxiesLock.Unlock()
+
+	c.proxy = proxy
+}
+
+// proxyOnFirstUse returns the proxy of the context, setting it up unless a
+// concurrent request did meanwhile.
+func (c *Context) proxyOnFirstUse() (*httputil.ReverseProxy, error) {
+	firstUseSetupLock.Lock()
+	defer firstUseSetupLock.Unlock()
+
+	if proxy := c.getProxy(); proxy != nil {
+		return proxy, nil
+	}
+
+	if err := c.SetupProxy(); err != nil {
+		return nil, err
+	}
+
+	return c.getProxy(), nil
+}
@@ -0,0 +1,50 @@
+package kubeconfig
+
+import (
+	"sync"
+	"time"
+)
+
+// Options are the settings of the contexts of a ContextStore, for the proxies
+// and clients reaching their clusters. The zero value uses the defaults.
+// Options must not be changed once contexts use them.
+type Options struct {
+	// UserAgent is sent on upstream requests, DefaultUserAgent() if it is empty.
+	UserAgent string
+	// RetryPolicy is how requests proxied to clusters are retried.
+	RetryPolicy RetryPolicy
+	// DNSCacheTTL caches the addresses of API server hosts for that long, 0
+	// disables the cache. DNS TTLs are not known to the resolver, so it should
+	// not exceed those of the endpoints, eg. cloud load balancers whose
+	// addresses change.
+	DNSCacheTTL time.Duration
+	// TransportTuning tunes the connections of the proxies to clusters.
+	TransportTuning TransportTuning
+	// TransportFactory returns the transports of the proxies, nil builds them
+	// all from the kubeconfig settings.
+	TransportFactory TransportFactory
+	// LazyProxySetup sets up the proxies of loaded contexts on their first
+	// request instead of when they are loaded, eg. for kubeconfigs with
+	// hundreds of contexts which are mostly not used. Errors setting them up
+	// are reported once they are used then.
+	LazyProxySetup bool
+	// ExtraCAs are certificate authorities trusted on top of the system and
+	// cluster ones, nil if there are none.
+	ExtraCAs *ExtraCAs
+
+	dnsCacheOnce  sync.Once
+	dnsCache      *dnsCache
+	tlsTransports tlsTransportCache
+}
+
+// defaultOptions are the options of the contexts which were not stored.
+var defaultOptions = &Options{}
+
+// opts returns the options of the context, the default ones if it has none.
+func (c *Context) opts() *Options {
+	if c.options == nil {
+		return defaultOptions
+	}
+
+	return c.options
+}
@@ -0,0 +1,99 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+const tlsHandshakeTimeout = 10 * time.Second
+
+// parseCertPin decodes a hex SHA-256 fingerprint. Colons and case are ignored,
+// so the output of `openssl x509 -fingerprint -sha256` can be used as is.
+func parseCertPin(pin string) ([]byte, error) {
+	fingerprint, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+	if err != nil || len(fingerprint) != sha256.Size {
+		return nil, fmt.Errorf("invalid pinned certificate fingerprint %q", pin)
+	}
+
+	return fingerprint, nil
+}
+
+// verifyPinnedCert returns a tls.Config VerifyPeerCertificate function that
+// accepts a connection only if the leaf certificate matches the fingerprint.
+func verifyPinnedCert(fingerprint []byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no server certificate presented")
+		}
+
+		leaf := sha256.Sum256(rawCerts[0])
+		if !bytes.Equal(leaf[:], fingerprint) {
+			return fmt.Errorf("server certificate fingerprint %s does not match the pinned one",
+				hex.EncodeToString(leaf[:]))
+		}
+
+		return nil
+	}
+}
+
+// pinnedTLSConfig returns the TLS config of restConf, accepting only the
+// server certificate with the given fingerprint. The normal chain verification
+// is skipped, so it also works for self-signed certificates. Client
+// certificates are kept.
+func pinnedTLSConfig(restConf *rest.Config, pin string) (*tls.Config, error) {
+	fingerprint, err := parseCertPin(pin)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConf, err := rest.TLSConfigFor(restConf)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConf == nil {
+		tlsConf = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	tlsConf.RootCAs = nil
+	tlsConf.InsecureSkipVerify = true //nolint:gosec // the pin is verified in VerifyPeerCertificate
+	tlsConf.VerifyPeerCertificate = verifyPinnedCert(fingerprint)
+
+	return tlsConf, nil
+}
+
+// useTLSTransport makes restConf use a new transport with the given TLS config.
+func useTLSTransport(restConf *rest.Config, tlsConf *tls.Config) {
+	transport := newTLSTransport(restConf, tlsConf)
+
+	// A custom transport cannot be combined with TLS options in the rest config,
+	// they are carried by the transport instead.
+	restConf.TLSClientConfig = rest.TLSClientConfig{}
+	restConf.Transport = transport
+}
+
+// newTLSTransport returns a transport for restConf with the given TLS config.
+func newTLSTransport(restConf *rest.Config, tlsConf *tls.Config) *http.Transport {
+	proxy := http.ProxyFromEnvironment
+	if restConf.Proxy != nil {
+		proxy = restConf.Proxy
+	}
+
+	return &http.Transport{
+		Proxy:               proxy,
+		TLSClientConfig:     tlsConf,
+		TLSHandshakeTimeout: tlsHandshakeTimeout,
+		ForceAttemptHTTP2:   true,
+		DialContext:         restConf.Dial,
+	}
+}
@@ -0,0 +1,109 @@
+package kubeconfig
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy is how requests proxied to clusters are retried when they fail
+// for a transient reason.
+type RetryPolicy struct {
+	// Retries is the maximum number of retries of a request, 0 disables them.
+	Retries int
+	// Backoff is the delay before the first retry, doubled for each next one.
+	Backoff time.Duration
+}
+
+// isTransientError tells whether a request failed for a reason which may go
+// away by itself, eg. the API server restarting: the connection was refused
+// or reset, or timed out, including the TLS handshake.
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isTransientStatus tells whether a response status reports an upstream
+// failure which may go away by itself. Client errors, eg. 400, 401 or 404,
+// are permanent: the same request fails the same way.
+func isTransientStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// isRetryableRequest tells whether a request can safely be sent again: it is
+// a GET, HEAD or OPTIONS one, and has no body which would have been consumed.
+func isRetryableRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return req.Body == nil || req.Body == http.NoBody
+	}
+
+	return false
+}
+
+// retryTransport retries retryable requests which failed for a transient reason.
+type retryTransport struct {
+	transport http.RoundTripper
+	policy    RetryPolicy
+}
+
+// retryRequests returns transport wrapped to retry requests according to
+// policy, or transport itself if retries are disabled.
+func retryRequests(transport http.RoundTripper, policy RetryPolicy) http.RoundTripper {
+	if policy.Retries <= 0 {
+		return transport
+	}
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &retryTransport{transport: transport, policy: policy}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isRetryableRequest(req) {
+		return t.transport.RoundTrip(req)
+	}
+
+	backoff := t.policy.Backoff
+
+	for retry := 0; ; retry++ {
+		resp, err := t.transport.RoundTrip(req)
+
+		transient := isTransientError(err) || (err == nil && isTransientStatus(resp.StatusCode))
+		if !transient || retry == t.policy.Retries {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
@@ -0,0 +1,117 @@
+package kubeconfig
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// Status values reported for a context.
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+	// StatusPending is reported while the proxy setup is retried in the background.
+	StatusPending = "pending"
+)
+
+// proxyStatus records the outcome of the last proxy setup or request of a context.
+// It is shared by copies of a context, so it is kept behind a pointer.
+type proxyStatus struct {
+	lock    sync.RWMutex
+	err     string
+	pending bool
+}
+
+// set records err as the last error, or clears it if err is nil.
+func (s *proxyStatus) set(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.err = ""
+	if err != nil {
+		s.err = err.Error()
+	}
+}
+
+func (s *proxyStatus) get() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.err
+}
+
+func (s *proxyStatus) setPending(pending bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.pending = pending
+}
+
+func (s *proxyStatus) isPending() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.pending
+}
+
+// errorHandler is used as the proxy ErrorHandler. It records the error and
+// responds with a bad gateway like the default handler does.
+func (s *proxyStatus) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	// The client going away says nothing about the cluster.
+	if !errors.Is(err, context.Canceled) {
+		s.set(err)
+	}
+
+	zlog.Error().Err(err).Str("url", r.URL.String()).Msg("proxy request failed")
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+// modifyResponse is used as the proxy ModifyResponse. Any response from the
+// cluster means it is reachable, so the last error is cleared.
+func (s *proxyStatus) modifyResponse(*http.Response) error {
+	s.set(nil)
+
+	return nil
+}
+
+// Status returns StatusPending if the proxy setup of the context is being
+// retried, StatusError if the last proxy setup or request of the context
+// failed, and StatusOK otherwise.
+func (c *Context) Status() string {
+	if c.IsPending() {
+		return StatusPending
+	}
+
+	if c.LastError() != "" {
+		return StatusError
+	}
+
+	return StatusOK
+}
+
+// LastError returns the message of the last failed proxy setup or request, if any.
+func (c *Context) LastError() string {
+	if c.status == nil {
+		return ""
+	}
+
+	return c.status.get()
+}
+
+// SetPending marks the proxy setup of the context as being retried. Requests
+// to a pending context fail with ErrProxyNotReady until it is unmarked.
+func (c *Context) SetPending(pending bool) {
+	if c.status == nil {
+		c.status = &proxyStatus{}
+	}
+
+	c.status.setPending(pending)
+}
+
+// IsPending returns true if the proxy setup of the context is being retried.
+func (c *Context) IsPending() bool {
+	return c.status != nil && c.status.isPending()
+}
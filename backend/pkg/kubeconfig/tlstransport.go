@@ -0,0 +1,94 @@
+package kubeconfig
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"sync"
+
+	"k8s.io/client-go/rest"
+)
+
+// tlsTransportCache holds the transports of the rest configs with custom TLS
+// settings, by context name, so the configs built for each request reuse their
+// connections instead of opening new ones. A context's transport is replaced
+// when its settings change, including the extra certificate authorities.
+type tlsTransportCache struct {
+	lock       sync.Mutex
+	transports map[string]cachedTLSTransport
+}
+
+type cachedTLSTransport struct {
+	// key identifies the settings the transport was built with.
+	key       string
+	transport *http.Transport
+}
+
+// tlsTransportKey returns a key of the settings the transport of restConf is
+// built with: its TLS options, including the content of their files, the
+// proxy, the pinned certificate and the extra certificate authorities.
+func tlsTransportKey(restConf *rest.Config, proxyURL, pin string, extraCAs []*x509.Certificate) string {
+	tlsConf := restConf.TLSClientConfig
+	hash := sha256.New()
+
+	for _, part := range [][]byte{
+		[]byte(restConf.Host), []byte(proxyURL), []byte(pin), []byte(tlsConf.ServerName),
+		tlsConf.CAData, tlsConf.CertData, tlsConf.KeyData,
+		readFileOrNil(tlsConf.CAFile), readFileOrNil(tlsConf.CertFile), readFileOrNil(tlsConf.KeyFile),
+	} {
+		hash.Write(part)
+		hash.Write([]byte{0})
+	}
+
+	for _, cert := range extraCAs {
+		hash.Write(cert.Raw)
+		hash.Write([]byte{0})
+	}
+
+	if tlsConf.Insecure {
+		hash.Write([]byte("insecure"))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func readFileOrNil(path string) []byte {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
+
+// use makes restConf use the transport of the context with the given TLS
+// config, built with the settings of key. It is built only if the context has
+// none yet, or its settings changed.
+func (t *tlsTransportCache) use(restConf *rest.Config, tlsConf *tls.Config, name, key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	cached, ok := t.transports[name]
+	if !ok || cached.key != key {
+		if ok {
+			cached.transport.CloseIdleConnections()
+		}
+
+		if t.transports == nil {
+			t.transports = make(map[string]cachedTLSTransport)
+		}
+
+		cached = cachedTLSTransport{key: key, transport: newTLSTransport(restConf, tlsConf)}
+		t.transports[name] = cached
+	}
+
+	restConf.TLSClientConfig = rest.TLSClientConfig{}
+	restConf.Transport = cached.transport
+}
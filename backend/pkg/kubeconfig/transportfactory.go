@@ -0,0 +1,22 @@
+package kubeconfig
+
+import (
+	"net/http"
+)
+
+// TransportFactory returns the transport of the proxy of a context, or nil to
+// use the one built from its kubeconfig settings. A transport it returns
+// replaces the built one entirely, including the TLS settings and the
+// credentials of the context, which it is responsible for.
+type TransportFactory func(c *Context) http.RoundTripper
+
+// customTransport returns the transport of the proxy of the context from the
+// transport factory of its options, or nil if there is none.
+func customTransport(c *Context) http.RoundTripper {
+	factory := c.opts().TransportFactory
+	if factory == nil {
+		return nil
+	}
+
+	return factory(c)
+}
@@ -0,0 +1,74 @@
+package kubeconfig
+
+import (
+	"errors"
+	"net/http"
+
+	"k8s.io/client-go/rest"
+)
+
+// TransportTuning tunes the connections of the proxies to the API servers,
+// eg. to cap them for many small clusters or keep more idle ones for a few
+// busy clusters. Zero values keep the defaults of client-go.
+type TransportTuning struct {
+	// MaxConnsPerHost caps the connections to each API server, idle or in
+	// use. Further requests wait for one to be available. 0 is unlimited.
+	MaxConnsPerHost int
+	// MaxIdleConns is the number of idle connections kept to each API server
+	// for reuse. 0 is the default of client-go, defaultIdleConnsPerHost.
+	MaxIdleConns int
+	// DisableKeepAlives closes connections after each request, instead of
+	// reusing them.
+	DisableKeepAlives bool
+}
+
+// defaultIdleConnsPerHost is the number of idle connections client-go keeps
+// to each API server.
+const defaultIdleConnsPerHost = 25
+
+// proxyTransportFor returns the transport of a proxy for restConf, tuned as set.
+func proxyTransportFor(restConf *rest.Config, tuning TransportTuning) (http.RoundTripper, error) {
+	// The transport is shared with the other rest configs of the context, and
+	// must not be tuned for them too.
+	if transport, ok := restConf.Transport.(*http.Transport); ok {
+		restConf.Transport = transport.Clone()
+	}
+
+	if err := tuneTransport(restConf, tuning); err != nil {
+		return nil, err
+	}
+
+	return rest.TransportFor(restConf)
+}
+
+// tuneTransport makes restConf use a transport tuned as set. client-go shares
+// its transports between configs, so a custom one is used instead of tuning them.
+func tuneTransport(restConf *rest.Config, tuning TransportTuning) error {
+	if tuning == (TransportTuning{}) {
+		return nil
+	}
+
+	if restConf.Transport == nil {
+		tlsConf, err := rest.TLSConfigFor(restConf)
+		if err != nil {
+			return err
+		}
+
+		useTLSTransport(restConf, tlsConf)
+	}
+
+	transport, ok := restConf.Transport.(*http.Transport)
+	if !ok {
+		return errors.New("the transport of the cluster can't be tuned")
+	}
+
+	transport.MaxConnsPerHost = tuning.MaxConnsPerHost
+	transport.DisableKeepAlives = tuning.DisableKeepAlives
+
+	transport.MaxIdleConnsPerHost = defaultIdleConnsPerHost
+	if tuning.MaxIdleConns > 0 {
+		transport.MaxIdleConnsPerHost = tuning.MaxIdleConns
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package kubeconfig
+
+import (
+	"net/http"
+
+	"k8s.io/client-go/transport"
+)
+
+// Version is the Headlamp version reported in the default User-Agent.
+// It can be set at build time with
+// -ldflags "-X github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig.Version=<version>".
+var Version = "dev"
+
+// DefaultUserAgent returns the User-Agent sent on upstream requests when none is configured.
+func DefaultUserAgent() string {
+	return "headlamp/" + Version
+}
+
+// userAgent returns the User-Agent sent on upstream requests.
+func (o *Options) userAgent() string {
+	if o.UserAgent == "" {
+		return DefaultUserAgent()
+	}
+
+	return o.UserAgent
+}
+
+// UserAgentRoundTripper wraps rt so that requests without a User-Agent
+// header are sent with the configured one.
+func (o *Options) UserAgentRoundTripper(rt http.RoundTripper) http.RoundTripper {
+	return transport.NewUserAgentRoundTripper(o.userAgent(), rt)
+}
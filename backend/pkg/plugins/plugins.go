@@ -18,14 +18,40 @@ import (
 const (
 	PluginRefreshKey       = "PLUGIN_REFRESH"
 	PluginListKey          = "PLUGIN_LIST"
+	PluginManifestKey      = "PLUGIN_MANIFEST"
 	subFolderWatchInterval = 5 * time.Second
 )
 
+const (
+	// StatusLoaded is the manifest status of the plugins given to the frontend.
+	StatusLoaded = "loaded"
+	// StatusLimitReached is the manifest status of the plugins ignored because
+	// there are more than the maximum number of plugins.
+	StatusLimitReached = "not loaded (limit reached)"
+)
+
+// PluginStatus is the manifest entry of a plugin found in the plugin directories.
+type PluginStatus struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+// maxPlugins is the maximum number of plugins loaded, 0 is unlimited.
+var maxPlugins int
+
+// SetMaxPlugins sets the maximum number of plugins loaded, 0 is unlimited.
+// Static plugins come first, so user plugins are the ones ignored.
+func SetMaxPlugins(limit int) {
+	maxPlugins = limit
+}
+
 // Watch watches the given path for changes and sends the events to the notify channel.
 func Watch(path string, notify chan<- string) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		log.Println("watcher init error:", err)
+		return
 	}
 	defer watcher.Close()
 
@@ -72,7 +98,57 @@ func periodicallyWatchSubfolders(watcher *fsnotify.Watcher, path string, interva
 }
 
 // GeneratePluginPaths takes the basePath, staticPluginDir and pluginDir and returns a list of plugin paths.
+// Plugins over the maximum number of plugins are left out.
 func GeneratePluginPaths(basePath string, staticPluginDir string, pluginDir string) ([]string, error) {
+	manifest, err := GeneratePluginManifest(basePath, staticPluginDir, pluginDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadedPluginPaths(manifest), nil
+}
+
+// GeneratePluginManifest returns the plugins found in staticPluginDir and
+// pluginDir, with whether they are loaded.
+func GeneratePluginManifest(basePath string, staticPluginDir string, pluginDir string) ([]PluginStatus, error) {
+	pluginPaths, err := allPluginPaths(basePath, staticPluginDir, pluginDir)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make([]PluginStatus, 0, len(pluginPaths))
+
+	for i, pluginPath := range pluginPaths {
+		status := StatusLoaded
+
+		if maxPlugins > 0 && i >= maxPlugins {
+			log.Printf("Warning, not loading plugin '%s': the limit of %d plugins is reached\n", pluginPath, maxPlugins)
+
+			status = StatusLimitReached
+		}
+
+		manifest = append(manifest, PluginStatus{Name: filepath.Base(pluginPath), Path: pluginPath, Status: status})
+	}
+
+	return manifest, nil
+}
+
+// loadedPluginPaths returns the paths of the loaded plugins of the manifest.
+func loadedPluginPaths(manifest []PluginStatus) []string {
+	pluginPaths := make([]string, 0, len(manifest))
+
+	for _, plugin := range manifest {
+		if plugin.Status == StatusLoaded {
+			pluginPaths = append(pluginPaths, plugin.Path)
+		}
+	}
+
+	return pluginPaths
+}
+
+// allPluginPaths returns the paths of the plugins in staticPluginDir and
+// pluginDir, static ones first.
+func allPluginPaths(basePath string, staticPluginDir string, pluginDir string) ([]string, error) {
 	var pluginListURLStatic []string
 
 	if staticPluginDir != "" {
@@ -149,16 +225,7 @@ func HandlePluginEvents(basePath, staticPluginDir, pluginDir string,
 			log.Println("Error setting plugin refresh key", err)
 		}
 
-		// generate the plugin list
-		pluginList, err := GeneratePluginPaths(basePath, staticPluginDir, pluginDir)
-		if err != nil && !os.IsNotExist(err) {
-			log.Println("Error generating plugins path", err)
-		}
-
-		err = cache.Set(context.Background(), PluginListKey, pluginList)
-		if err != nil {
-			log.Println("Error setting plugin list key", err)
-		}
+		setPluginList(basePath, staticPluginDir, pluginDir, cache)
 	}
 }
 
@@ -170,16 +237,25 @@ func PopulatePluginsCache(basePath, staticPluginDir, pluginDir string, cache cac
 		log.Println("Error setting plugin refresh key", err)
 	}
 
-	// generate the plugin list
-	pluginList, err := GeneratePluginPaths(basePath, staticPluginDir, pluginDir)
+	setPluginList(basePath, staticPluginDir, pluginDir, cache)
+}
+
+// setPluginList sets the plugin list and plugin manifest in the cache.
+func setPluginList(basePath, staticPluginDir, pluginDir string, cache cache.Cache[interface{}]) {
+	manifest, err := GeneratePluginManifest(basePath, staticPluginDir, pluginDir)
 	if err != nil && !os.IsNotExist(err) {
 		log.Println("Error generating plugins path", err)
 	}
 
-	err = cache.Set(context.Background(), PluginListKey, pluginList)
+	err = cache.Set(context.Background(), PluginListKey, loadedPluginPaths(manifest))
 	if err != nil {
 		log.Println("Error setting plugin list key", err)
 	}
+
+	err = cache.Set(context.Background(), PluginManifestKey, manifest)
+	if err != nil {
+		log.Println("Error setting plugin manifest key", err)
+	}
 }
 
 // HandlePluginReload checks if the plugin refresh key is set to true
@@ -319,3 +319,51 @@ func TestPopulatePluginsCache(t *testing.T) {
 	require.True(t, ok)
 	require.Empty(t, pluginListArr)
 }
+
+func TestMaxPlugins(t *testing.T) {
+	testDirName := t.TempDir()
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		subDir := path.Join(testDirName, name)
+		require.NoError(t, os.Mkdir(subDir, 0o755))
+		require.NoError(t, os.WriteFile(path.Join(subDir, "main.js"), nil, 0o600))
+	}
+
+	plugins.SetMaxPlugins(3)
+	t.Cleanup(func() { plugins.SetMaxPlugins(0) })
+
+	pathList, err := plugins.GeneratePluginPaths("", "", testDirName)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"plugins/a", "plugins/b", "plugins/c"}, pathList)
+
+	ch := cache.New[interface{}]()
+	plugins.PopulatePluginsCache("", "", testDirName, ch)
+
+	pluginList, err := ch.Get(context.Background(), plugins.PluginListKey)
+	require.NoError(t, err)
+	assert.Len(t, pluginList, 3)
+
+	manifest, err := ch.Get(context.Background(), plugins.PluginManifestKey)
+	require.NoError(t, err)
+
+	manifestArr, ok := manifest.([]plugins.PluginStatus)
+	require.True(t, ok)
+	require.Len(t, manifestArr, 5)
+
+	for i, plugin := range manifestArr {
+		if i < 3 {
+			assert.Equal(t, plugins.StatusLoaded, plugin.Status, plugin.Name)
+		} else {
+			assert.Equal(t, plugins.StatusLimitReached, plugin.Status, plugin.Name)
+		}
+	}
+
+	assert.Equal(t, "e", manifestArr[4].Name)
+
+	// Without a limit, all the plugins are loaded.
+	plugins.SetMaxPlugins(0)
+
+	pathList, err = plugins.GeneratePluginPaths("", "", testDirName)
+	require.NoError(t, err)
+	assert.Len(t, pathList, 5)
+}
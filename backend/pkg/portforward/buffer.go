@@ -0,0 +1,41 @@
+package portforward
+
+import "sync"
+
+// DefaultOutputBufferSize is the number of bytes of port forward output kept when none is configured.
+const DefaultOutputBufferSize = 4096
+
+// ringBuffer is an io.Writer that only keeps the most recent size bytes written to it.
+type ringBuffer struct {
+	lock sync.Mutex
+	size int
+	data []byte
+}
+
+// newRingBuffer creates a ringBuffer that keeps at most size bytes.
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{size: size}
+}
+
+// Write appends p to the buffer, dropping the oldest bytes if it is full.
+func (b *ringBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.data = append(b.data, p...)
+
+	if over := len(b.data) - b.size; over > 0 {
+		copy(b.data, b.data[over:])
+		b.data = b.data[:b.size]
+	}
+
+	return len(p), nil
+}
+
+// String returns the retained output.
+func (b *ringBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return string(b.data)
+}
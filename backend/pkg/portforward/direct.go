@@ -0,0 +1,158 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// directProbeTimeout is how long checking that a pod can be reached directly
+// may take, before falling back to forwarding through the API server.
+const directProbeTimeout = 2 * time.Second
+
+// directPodAddress returns the address to connect to the target port of the
+// pod directly, if Headlamp runs in the cluster and can reach it. Otherwise
+// the port forward goes through the API server.
+func directPodAddress(ctx context.Context, clientset kubernetes.Interface, conf Config,
+	p portForwardRequest,
+) (string, bool) {
+	if !conf.InCluster {
+		return "", false
+	}
+
+	// Named ports would need to be resolved from the pod spec, the API server does that.
+	if _, err := strconv.Atoi(p.TargetPort); err != nil {
+		return "", false
+	}
+
+	// Dialing the pod goes out as Headlamp, so the user must be allowed the forward itself.
+	if !canPortForward(ctx, clientset, p) {
+		return "", false
+	}
+
+	pod, err := clientset.CoreV1().Pods(p.Namespace).Get(ctx, p.Pod, metav1.GetOptions{})
+	if err != nil || pod.Status.PodIP == "" {
+		return "", false
+	}
+
+	address := net.JoinHostPort(pod.Status.PodIP, p.TargetPort)
+
+	conn, err := net.DialTimeout("tcp", address, directProbeTimeout)
+	if err != nil {
+		log.Printf("portforward: pod %s/%s not reachable directly, using the API server: %s", p.Namespace, p.Pod, err)
+		return "", false
+	}
+
+	conn.Close()
+
+	return address, true
+}
+
+// canPortForward tells whether the client of the clientset may create a port
+// forward to the pod, which the API server would check for a forward through it.
+func canPortForward(ctx context.Context, clientset kubernetes.Interface, p portForwardRequest) bool {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   p.Namespace,
+				Verb:        "create",
+				Resource:    "pods",
+				Subresource: "portforward",
+				Name:        p.Pod,
+			},
+		},
+	}
+
+	resp, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		log.Printf("portforward: failed to check access to pod %s/%s, using the API server: %s", p.Namespace, p.Pod, err)
+		return false
+	}
+
+	return resp.Status.Allowed
+}
+
+// startDirectPortForward forwards the local port to the pod address directly,
+// without going through the API server, until stopChan gets a value. done is
+// closed once the local port is freed.
+func startDirectPortForward(clientset kubernetes.Interface, cache cache.Cache[interface{}], conf Config,
+	p portForwardRequest, podAddress string, stopChan chan struct{}, done chan struct{},
+	restart func(pod string) error,
+) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(conf.address(), p.Port))
+	if err != nil {
+		return fmt.Errorf("portforward request: failed to listen: %v", err)
+	}
+
+	out, errOut := newRingBuffer(conf.outputBufferSize()), newRingBuffer(conf.outputBufferSize())
+
+	fmt.Fprintf(out, "Forwarding from %s -> %s (direct)\n", listener.Addr(), podAddress)
+
+	go func() {
+		<-stopChan
+		listener.Close()
+		close(done)
+	}()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return // The listener was closed by stopping the forward.
+			}
+
+			go forwardConn(conn, podAddress, conf.keepAliveInterval(), errOut)
+		}
+	}()
+
+	portForwardToStore := newPortForward(p, stopChan, done, out, errOut)
+	portforwardstore(cache, portForwardToStore)
+
+	checkPodPeriodically(clientset, cache, conf, &portForwardToStore, restart)
+
+	return nil
+}
+
+// forwardConn copies the data between a local connection and the pod address,
+// until either side closes.
+func forwardConn(conn net.Conn, podAddress string, keepAlive time.Duration, errOut io.Writer) {
+	defer conn.Close()
+
+	dialer := net.Dialer{Timeout: directProbeTimeout, KeepAlive: keepAlive}
+
+	podConn, err := dialer.Dial("tcp", podAddress)
+	if err != nil {
+		fmt.Fprintf(errOut, "error connecting to %s: %s\n", podAddress, err)
+		return
+	}
+
+	defer podConn.Close()
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	copyAndClose := func(dst, src net.Conn) {
+		defer wg.Done()
+
+		_, _ = io.Copy(dst, src)
+
+		// Unblocks the copy in the other direction.
+		dst.Close()
+	}
+
+	go copyAndClose(podConn, conn)
+	go copyAndClose(conn, podConn)
+
+	wg.Wait()
+}
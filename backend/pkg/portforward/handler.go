@@ -1,7 +1,6 @@
 package portforward
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -12,7 +11,6 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,7 +18,10 @@ import (
 	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	httpspdy "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/portforward"
 	"k8s.io/client-go/transport/spdy"
 )
@@ -32,6 +33,120 @@ const (
 
 const PodAvailabilityCheckTimer = 5 // seconds
 
+// DefaultKeepAliveInterval is the interval used for keepalive probes on the
+// upstream connection of a port forward when none is configured.
+const DefaultKeepAliveInterval = 30 * time.Second
+
+const dialTimeout = 30 * time.Second
+
+// listenCheckTimeout is how long connecting to the local port of a port
+// forward may take when checking that it is listening.
+const listenCheckTimeout = time.Second
+
+// DefaultSetupTimeout is how long starting a port forward may take, from
+// connecting to the cluster until the local port is ready, when none is configured.
+const DefaultSetupTimeout = time.Minute
+
+// errSetupTimeout is returned when a port forward isn't ready within the setup timeout.
+var errSetupTimeout = errors.New("timed out starting the port forward")
+
+// maxLabelLength is the maximum length of the label of a port forward.
+const maxLabelLength = 256
+
+// DefaultAddress is the local address port forwards listen on when none is configured.
+const DefaultAddress = "localhost"
+
+// Config holds the settings used when starting port forwards.
+type Config struct {
+	// KeepAliveInterval is the interval between TCP keepalive probes and SPDY
+	// pings on the upstream connection. Zero means DefaultKeepAliveInterval.
+	KeepAliveInterval time.Duration
+	// OutputBufferSize is the number of bytes of output kept for each port forward.
+	// Zero means DefaultOutputBufferSize.
+	OutputBufferSize int
+	// AvailabilityCheckJitter is the maximum random fraction added to the pod
+	// availability check interval, so checks of forwards started together
+	// spread out. Zero disables the jitter.
+	AvailabilityCheckJitter float64
+	// Address is the local address port forwards listen on, eg. "127.0.0.1"
+	// or "::1". Free ports are looked up on it too. Empty means DefaultAddress.
+	Address string
+	// SetupTimeout is how long starting a port forward may take before it is
+	// given up on. Zero means DefaultSetupTimeout.
+	SetupTimeout time.Duration
+	// InCluster is set when Headlamp runs in the cluster. Port forwards then
+	// connect to the pod directly if they can, instead of through the API server.
+	InCluster bool
+	// PodRestartGrace is how long the pod of a port forward may not run, eg.
+	// while it is restarted, before the forward is stopped. Forwards to services
+	// move to another running pod of the service meanwhile. Zero stops them at once.
+	PodRestartGrace time.Duration
+	// SetupQueue caps the number of port forwards being set up at once.
+	// Nil means no cap.
+	SetupQueue *SetupQueue
+	// IgnoreClientAuth tells whether the Authorization header of clients is
+	// ignored for the cluster, so the context's credentials are used instead.
+	// Nil means it is never ignored.
+	IgnoreClientAuth func(kContext *kubeconfig.Context) bool
+}
+
+// clientToken returns the token a client sent for the cluster, or "" if the
+// cluster ignores client auth.
+func (c Config) clientToken(kContext *kubeconfig.Context, token string) string {
+	if c.IgnoreClientAuth != nil && c.IgnoreClientAuth(kContext) {
+		return ""
+	}
+
+	return token
+}
+
+// keepAliveInterval returns the configured keepalive interval or the default.
+func (c Config) keepAliveInterval() time.Duration {
+	if c.KeepAliveInterval <= 0 {
+		return DefaultKeepAliveInterval
+	}
+
+	return c.KeepAliveInterval
+}
+
+// setupTimeout returns the configured setup timeout or the default.
+func (c Config) setupTimeout() time.Duration {
+	if c.SetupTimeout <= 0 {
+		return DefaultSetupTimeout
+	}
+
+	return c.SetupTimeout
+}
+
+// availabilityCheckInterval returns the interval between pod availability checks.
+func (c Config) availabilityCheckInterval() time.Duration {
+	interval := PodAvailabilityCheckTimer * time.Second
+	if c.AvailabilityCheckJitter <= 0 {
+		return interval
+	}
+
+	return wait.Jitter(interval, c.AvailabilityCheckJitter)
+}
+
+// address returns the configured listen address without IPv6 brackets, or the default.
+func (c Config) address() string {
+	address := strings.TrimSuffix(strings.TrimPrefix(c.Address, "["), "]")
+	if address == "" {
+		return DefaultAddress
+	}
+
+	return address
+}
+
+// outputBufferSize returns the configured output buffer size or the default.
+func (c Config) outputBufferSize() int {
+	if c.OutputBufferSize <= 0 {
+		return DefaultOutputBufferSize
+	}
+
+	return c.OutputBufferSize
+}
+
 type portForwardRequest struct {
 	ID               string `json:"id"`
 	Namespace        string `json:"namespace"`
@@ -41,17 +156,39 @@ type portForwardRequest struct {
 	TargetPort       string `json:"targetPort"`
 	Cluster          string `json:"cluster"`
 	Port             string `json:"port"`
+	// PodDNSName is the DNS name of a pod of a headless service, which the pod
+	// and namespace are resolved from if set.
+	PodDNSName string `json:"podDNSName,omitempty"`
+	// Node is the name of a node to forward to instead of a pod, through the
+	// node proxy of the API server, eg. to reach the kubelet.
+	Node string `json:"node,omitempty"`
+	// Label is a description of the port forward given by the user, eg.
+	// "debugging the payment service", to tell forwards apart.
+	Label string `json:"label,omitempty"`
 }
 
+// PortForwardPayload is the body of the requests starting and stopping port
+// forwards, eg. to describe it.
+type PortForwardPayload = portForwardRequest
+
 func (p *portForwardRequest) Validate() error {
-	if p.Namespace == "" {
+	if p.Node != "" {
+		return p.validateTarget()
+	}
+
+	if p.Namespace == "" && p.PodDNSName == "" {
 		return fmt.Errorf("namespace is required")
 	}
 
-	if p.Pod == "" {
+	if p.Pod == "" && p.PodDNSName == "" {
 		return fmt.Errorf("pod name is required")
 	}
 
+	return p.validateTarget()
+}
+
+// validateTarget checks the fields needed by forwards to pods and nodes alike.
+func (p *portForwardRequest) validateTarget() error {
 	if p.TargetPort == "" {
 		return fmt.Errorf("targetPort is required")
 	}
@@ -60,12 +197,18 @@ func (p *portForwardRequest) Validate() error {
 		return fmt.Errorf("cluster name is required")
 	}
 
+	if len(p.Label) > maxLabelLength {
+		return fmt.Errorf("label is longer than %d bytes", maxLabelLength)
+	}
+
 	return nil
 }
 
 type portForward struct {
-	ID               string `json:"id"`
-	closeChan        chan struct{}
+	ID        string `json:"id"`
+	closeChan chan struct{}
+	// done is closed once the forward stopped listening on its port.
+	done             <-chan struct{}
 	Pod              string `json:"pod"`
 	Service          string `json:"service"`
 	ServiceNamespace string `json:"serviceNamespace"`
@@ -73,12 +216,19 @@ type portForward struct {
 	Cluster          string `json:"cluster"`
 	Port             string `json:"port"`
 	TargetPort       string `json:"targetPort"`
+	Node             string `json:"node,omitempty"`
+	Label            string `json:"label,omitempty"`
 	Status           string `json:"status"`
 	Error            string `json:"error"`
+	output           *ringBuffer
+	errOutput        *ringBuffer
+	// CreatedAt is when the port forward was started, in RFC3339 format.
+	CreatedAt string `json:"createdAt"`
 }
 
-func getFreePort() (int, error) {
-	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
+// getFreePort returns a port that is free on the given address.
+func getFreePort(address string) (int, error) {
+	addr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(address, "0"))
 	if err != nil {
 		return 0, err
 	}
@@ -94,7 +244,7 @@ func getFreePort() (int, error) {
 }
 
 // StartPortForward handles the port forward request.
-func StartPortForward(kubeConfigStore kubeconfig.ContextStore, cache cache.Cache[interface{}],
+func StartPortForward(kubeConfigStore kubeconfig.ContextStore, cache cache.Cache[interface{}], conf Config,
 	w http.ResponseWriter, r *http.Request,
 ) {
 	var p portForwardRequest
@@ -123,7 +273,7 @@ func StartPortForward(kubeConfigStore kubeconfig.ContextStore, cache cache.Cache
 
 	if p.Port == "" {
 		// if no port is specified find a available port
-		freePort, err := getFreePort()
+		freePort, err := getFreePort(conf.address())
 		if err != nil || freePort == 0 {
 			http.Error(w, "can't find any available port "+err.Error(), http.StatusInternalServerError)
 		}
@@ -134,9 +284,41 @@ func StartPortForward(kubeConfigStore kubeconfig.ContextStore, cache cache.Cache
 	kContext, err := kubeConfigStore.GetContext(p.Cluster)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token = conf.clientToken(kContext, token)
+
+	if err := conf.SetupQueue.acquire(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	defer conf.SetupQueue.release()
+
+	if p.PodDNSName != "" {
+		if status, err := resolvePodDNSNameInCluster(kContext, conf, &p, token); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	if p.Node != "" {
+		err = startNodePortForward(kContext, cache, conf, p, token)
+	} else {
+		err = startPortForward(kContext, cache, conf, p, token)
+	}
+
+	if errors.Is(err, errNodeNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, errSetupTimeout) {
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
 	}
 
-	err = startPortForward(kContext, cache, p, token)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -152,22 +334,46 @@ func StartPortForward(kubeConfigStore kubeconfig.ContextStore, cache cache.Cache
 // startPortForward starts a port forward.
 //
 //nolint:funlen
-func startPortForward(kContext *kubeconfig.Context, cache cache.Cache[interface{}],
+func startPortForward(kContext *kubeconfig.Context, cache cache.Cache[interface{}], conf Config,
 	p portForwardRequest, token string,
 ) error {
+	ctx, cancel := context.WithTimeout(context.Background(), conf.setupTimeout())
+	defer cancel()
+
 	clientset, err := kContext.ClientSetWithToken(token)
 	if err != nil {
 		return fmt.Errorf("failed to create portforward request: %v", err)
 	}
 
+	stopChan := make(chan struct{})
+	// done is closed once the forward stopped listening on its port.
+	done := make(chan struct{})
+
+	// restart moves the forward to another pod of its service.
+	restart := func(pod string) error {
+		// The new forward listens on the same port, once it is freed.
+		stopAndWait(stopChan, done)
+
+		p.Pod = pod
+
+		return startPortForward(kContext, cache, conf, p, token)
+	}
+
+	if podAddress, ok := directPodAddress(ctx, clientset, conf, p); ok {
+		return startDirectPortForward(clientset, cache, conf, p, podAddress, stopChan, done, restart)
+	}
+
 	rConf, err := kContext.RESTConfig()
 	if err != nil {
 		return fmt.Errorf("failed to create portforward request: %v", err)
 	}
 
-	rConf.BearerToken = token
+	// Without a client token, the context's credentials are used.
+	if token != "" {
+		rConf.BearerToken = token
+	}
 
-	roundTripper, upgrader, err := spdy.RoundTripperFor(rConf)
+	roundTripper, upgrader, err := roundTripperFor(rConf, conf.keepAliveInterval())
 	if err != nil {
 		log.Printf("Error: failed to create round tripper: %s", err)
 		return fmt.Errorf("failed to create portforward request")
@@ -180,74 +386,189 @@ func startPortForward(kContext *kubeconfig.Context, cache cache.Cache[interface{
 		return fmt.Errorf("portforward request: failed to parse url: %v", err)
 	}
 
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, reqURL)
-	stopChan, readyChan := make(chan struct{}), make(chan struct{}, 1)
-	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+	// Only the connection to the cluster is bounded by the setup timeout, not the forward.
+	client := &http.Client{Transport: setupRoundTripper{ctx: ctx, next: roundTripper}}
+	dialer := spdy.NewDialer(upgrader, client, http.MethodPost, reqURL)
+	readyChan := make(chan struct{}, 1)
+	out, errOut := newRingBuffer(conf.outputBufferSize()), newRingBuffer(conf.outputBufferSize())
 
-	forwarder, err := portforward.New(dialer, []string{fmt.Sprintf(p.Port + ":" + p.TargetPort)},
-		stopChan, readyChan, out, errOut)
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{conf.address()},
+		[]string{fmt.Sprintf(p.Port + ":" + p.TargetPort)}, stopChan, readyChan, out, errOut)
 	if err != nil {
 		return fmt.Errorf("portforward request: failed to create portforward: %v", err)
 	}
 
-	portForwardToStore := portForward{
+	portForwardToStore := newPortForward(p, stopChan, done, out, errOut)
+
+	// setupErr gets the error of a forward which failed before being ready.
+	setupErr := make(chan error, 1)
+
+	go func() {
+		err := forwarder.ForwardPorts() // Locks until stopChan is closed.
+		// The listeners are closed once ForwardPorts returns.
+		close(done)
+
+		if err == nil {
+			return
+		}
+
+		log.Printf("Error: failed to forward ports: %s", err)
+
+		select {
+		case <-readyChan:
+			portForwardToStore.Error = err.Error()
+			portforwardstore(cache, portForwardToStore)
+		default:
+			setupErr <- err
+		}
+	}()
+
+	select {
+	case <-readyChan:
+	case err := <-setupErr:
+		return fmt.Errorf("portforward request: failed to forward ports: %v", err)
+	case <-ctx.Done():
+		// Stops the forward as soon as it is ready, if it gets there.
+		close(stopChan)
+
+		return errSetupTimeout
+	}
+
+	if errOut.String() == "" {
+		portforwardstore(cache, portForwardToStore)
+	}
+
+	checkPodPeriodically(clientset, cache, conf, &portForwardToStore, restart)
+
+	return nil
+}
+
+// stopAndWait stops a running forward and waits until it stopped listening on
+// its port, which done is closed for. A forward which already stopped is not
+// waited for.
+func stopAndWait(stopChan chan<- struct{}, done <-chan struct{}) {
+	select {
+	case stopChan <- struct{}{}:
+		<-done
+	case <-done:
+	}
+}
+
+// newPortForward returns the record of a port forward being started.
+func newPortForward(p portForwardRequest, stopChan chan struct{}, done <-chan struct{},
+	out, errOut *ringBuffer,
+) portForward {
+	return portForward{
 		ID:               p.ID,
 		closeChan:        stopChan,
+		done:             done,
 		Pod:              p.Pod,
 		Cluster:          p.Cluster,
 		Namespace:        p.Namespace,
 		Service:          p.Service,
 		ServiceNamespace: p.ServiceNamespace,
 		TargetPort:       p.TargetPort,
+		Node:             p.Node,
+		Label:            p.Label,
 		Status:           RUNNING,
 		Port:             p.Port,
 		Error:            "",
+		output:           out,
+		errOutput:        errOut,
+		CreatedAt:        time.Now().UTC().Format(time.RFC3339),
 	}
+}
+
+// checkPodPeriodically stops the port forward once its pod is not running for
+// longer than the restart grace period. restart, if set, restarts the forward
+// to another pod of its service in the meantime.
+func checkPodPeriodically(clientset kubernetes.Interface, cache cache.Cache[interface{}], conf Config,
+	pf *portForward, restart func(pod string) error,
+) {
+	watcher := &podWatcher{clientset: clientset, pf: pf, grace: conf.PodRestartGrace, restart: restart}
+	ticker := time.NewTicker(conf.availabilityCheckInterval())
 
 	go func() {
-		if err = forwarder.ForwardPorts(); err != nil { // Locks until stopChan is closed.
-			log.Printf("Error: failed to forward ports: %s", err)
-			stopChan <- struct{}{}
+		defer ticker.Stop()
 
-			portForwardToStore.Error = err.Error()
-			portforwardstore(cache, portForwardToStore)
+		for range ticker.C {
+			err := watcher.check(time.Now())
+			if err == nil {
+				continue
+			}
+
+			if errors.Is(err, errForwardRestarted) {
+				return
+			}
+
+			log.Printf("portforward: failed to get pod: %s", err)
+			stopAndWait(pf.closeChan, pf.done)
+
+			pf.Error = err.Error()
+
+			portforwardstore(cache, *pf)
+
+			return
 		}
 	}()
+}
 
-	<-readyChan
+// setupRoundTripper sends the upgrade request of a port forward with the
+// context of its setup, so dialing the cluster and the TLS handshake give up
+// with it. The upgraded connection does not depend on the context.
+type setupRoundTripper struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
 
-	if errOut.String() == "" {
-		portforwardstore(cache, portForwardToStore)
+func (rt setupRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt.next.RoundTrip(req.WithContext(rt.ctx))
+}
+
+// roundTripperFor returns a round tripper and upgrader to use for a port forward.
+// It mirrors spdy.RoundTripperFor but enables TCP keepalive on the dialed
+// connection, so forwards to rarely-used ports survive NAT and idle timeouts.
+func roundTripperFor(rConf *rest.Config,
+	keepAlive time.Duration,
+) (http.RoundTripper, *httpspdy.SpdyRoundTripper, error) {
+	tlsConfig, err := rest.TLSConfigFor(rConf)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	/* check every PodAvailabilityCheckTimer seconds if the pod for which we started a portforward is running
-	if not then we close the channel
-	*/
-	ticker := time.NewTicker(PodAvailabilityCheckTimer * time.Second)
+	// Contexts with a pinned certificate carry their TLS settings in a custom transport.
+	if transport, ok := rConf.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+		tlsConfig = transport.TLSClientConfig.Clone()
+	}
 
-	go func() {
-		for range ticker.C {
-			err := checkIfPodIsRunning(clientset, p.Namespace, p.Pod)
-			if err != nil {
-				if errors.Is(err, syscall.ECONNREFUSED) {
-					continue
-				}
+	proxy := http.ProxyFromEnvironment
+	if rConf.Proxy != nil {
+		proxy = rConf.Proxy
+	}
 
-				log.Printf("portforward: failed to get pod: %s", err)
-				stopChan <- struct{}{}
+	upgradeRoundTripper, err := httpspdy.NewRoundTripperWithConfig(httpspdy.RoundTripperConfig{
+		TLS:        tlsConfig,
+		Proxier:    proxy,
+		PingPeriod: keepAlive,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 
-				portForwardToStore.Error = err.Error()
+	upgradeRoundTripper.Dialer = &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: keepAlive,
+	}
 
-				portforwardstore(cache, portForwardToStore)
-				ticker.Stop()
-			}
-		}
-	}()
+	wrapper, err := rest.HTTPWrappersForConfig(rConf, upgradeRoundTripper)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return nil
+	return wrapper, upgradeRoundTripper, nil
 }
 
-func checkIfPodIsRunning(clientset *kubernetes.Clientset, namespace string, pod string) error {
+func checkIfPodIsRunning(clientset kubernetes.Interface, namespace string, pod string) error {
 	ctx := context.Background()
 
 	p, err := clientset.CoreV1().Pods(namespace).Get(ctx, pod, v1.GetOptions{})
@@ -255,6 +576,10 @@ func checkIfPodIsRunning(clientset *kubernetes.Clientset, namespace string, pod
 		return err
 	}
 
+	if p.DeletionTimestamp != nil {
+		return fmt.Errorf("%w: %s/%s", errPodTerminating, namespace, pod)
+	}
+
 	if p.Status.Phase != corev1.PodRunning {
 		return errors.New("pod is not running")
 	}
@@ -327,6 +652,56 @@ func GetPortForwards(cache cache.Cache[interface{}], w http.ResponseWriter, r *h
 	}
 }
 
+// portForwardCounts are the numbers of port forwards by status. Forwards which
+// failed after starting are counted as errored, whatever their status.
+type portForwardCounts struct {
+	Running int `json:"running"`
+	Stopped int `json:"stopped"`
+	Errored int `json:"errored"`
+	Total   int `json:"total"`
+}
+
+func (c *portForwardCounts) add(p portForward) {
+	c.Total++
+
+	switch {
+	case p.Error != "":
+		c.Errored++
+	case p.Status == STOPPED:
+		c.Stopped++
+	default:
+		c.Running++
+	}
+}
+
+// GetPortForwardSummary handles the port forward summary request.
+// It returns the number of port forwards by status, per cluster and in total.
+func GetPortForwardSummary(cache cache.Cache[interface{}], w http.ResponseWriter, r *http.Request) {
+	type payload struct {
+		Clusters map[string]*portForwardCounts `json:"clusters"`
+		Total    portForwardCounts             `json:"total"`
+	}
+
+	summary := payload{Clusters: map[string]*portForwardCounts{}}
+
+	for _, p := range getPortForwardList(cache, "") {
+		counts, ok := summary.Clusters[p.Cluster]
+		if !ok {
+			counts = &portForwardCounts{}
+			summary.Clusters[p.Cluster] = counts
+		}
+
+		counts.add(p)
+		summary.Total.add(p)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		http.Error(w, "failed to write json payload to response "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
 // GetPortForwardByID handles get port forward by id request.
 func GetPortForwardByID(cache cache.Cache[interface{}], w http.ResponseWriter, r *http.Request) {
 	cluster := r.URL.Query().Get("cluster")
@@ -347,25 +722,185 @@ func GetPortForwardByID(cache cache.Cache[interface{}], w http.ResponseWriter, r
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		http.Error(w, "failed to write json payload "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// GetPortForwardLogs handles get port forward logs request.
+// It returns the most recent output of the port forward.
+func GetPortForwardLogs(cache cache.Cache[interface{}], w http.ResponseWriter, r *http.Request) {
+	cluster := r.URL.Query().Get("cluster")
+	if cluster == "" {
+		http.Error(w, "cluster is required", http.StatusBadRequest)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	p, err := getPortForwardByID(cache, cluster, id)
+	if err != nil {
+		http.Error(w, "no portforward running with id "+id, http.StatusNotFound)
+		return
+	}
+
+	type payload struct {
+		ID     string `json:"id"`
+		Output string `json:"output"`
+		Error  string `json:"error"`
+	}
+
+	logs := payload{ID: p.ID}
+
+	if p.output != nil {
+		logs.Output = p.output.String()
+	}
+
+	if p.errOutput != nil {
+		logs.Error = p.errOutput.String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(logs); err != nil {
+		http.Error(w, "failed to write json payload "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// GetPortForwardStatus handles the port forward status request.
+// It reports whether the local port of the port forward accepts connections,
+// along with the stored status and error.
+func GetPortForwardStatus(cache cache.Cache[interface{}], conf Config, w http.ResponseWriter, r *http.Request) {
+	cluster := r.URL.Query().Get("cluster")
+	if cluster == "" {
+		http.Error(w, "cluster is required", http.StatusBadRequest)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	p, err := getPortForwardByID(cache, cluster, id)
+	if err != nil {
+		http.Error(w, "no portforward running with id "+id, http.StatusNotFound)
+		return
+	}
+
 	type payload struct {
 		ID        string `json:"id"`
-		Pod       string `json:"pod"`
-		Service   string `json:"service"`
-		Cluster   string `json:"cluster"`
-		Namespace string `json:"namespace"`
+		Port      string `json:"port"`
+		Status    string `json:"status"`
+		Error     string `json:"error"`
+		Listening bool   `json:"listening"`
 	}
 
-	portForwardStruct := payload{
+	status := payload{
 		ID:        p.ID,
-		Pod:       p.Pod,
-		Namespace: p.Namespace,
-		Cluster:   p.Cluster,
-		Service:   p.Service,
+		Port:      p.Port,
+		Status:    p.Status,
+		Error:     p.Error,
+		Listening: isListening(net.JoinHostPort(conf.address(), p.Port)),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, "failed to write json payload "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// isListening returns whether a TCP connection to the address can be opened.
+func isListening(address string) bool {
+	conn, err := net.DialTimeout("tcp", address, listenCheckTimeout)
+	if err != nil {
+		return false
+	}
+
+	conn.Close()
+
+	return true
+}
+
+// checkPortForwardTarget checks that the pod is running and that one of its
+// containers exposes targetPort, given as a number or a port name.
+func checkPortForwardTarget(clientset kubernetes.Interface, namespace, pod, targetPort string) error {
+	p, err := clientset.CoreV1().Pods(namespace).Get(context.Background(), pod, v1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if p.Status.Phase != corev1.PodRunning {
+		return errors.New("pod is not running")
+	}
+
+	portNumber, err := strconv.Atoi(targetPort)
+	isNamed := err != nil
+
+	for _, container := range p.Spec.Containers {
+		for _, port := range container.Ports {
+			if (isNamed && port.Name == targetPort) || (!isNamed && int(port.ContainerPort) == portNumber) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("pod does not expose port %s", targetPort)
+}
+
+// CheckPortForward handles the port forward pre-flight check request.
+// It reports whether a port forward to the target could be started, without starting it.
+func CheckPortForward(kubeConfigStore kubeconfig.ContextStore, conf Config, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	p := portForwardRequest{
+		Cluster:    query.Get("cluster"),
+		Namespace:  query.Get("namespace"),
+		Pod:        query.Get("pod"),
+		TargetPort: query.Get("targetPort"),
+	}
+
+	if err := p.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	kContext, err := kubeConfigStore.GetContext(p.Cluster)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	token := conf.clientToken(kContext, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+
+	clientset, err := kContext.ClientSetWithToken(token)
+	if err != nil {
+		http.Error(w, "failed to create clientset "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type payload struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+	}
+
+	result := payload{OK: true}
+
+	if err := checkPortForwardTarget(clientset, p.Namespace, p.Pod, p.TargetPort); err != nil {
+		result = payload{Error: err.Error()}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
-	if err := json.NewEncoder(w).Encode(portForwardStruct); err != nil {
+	if err := json.NewEncoder(w).Encode(result); err != nil {
 		http.Error(w, "failed to write json payload "+err.Error(), http.StatusInternalServerError)
 	}
 }
@@ -100,7 +100,7 @@ func TestStartPortForward(t *testing.T) {
 
 	req.Body = io.NopCloser(bytes.NewReader(jsonReq))
 
-	portforward.StartPortForward(kubeConfigStore, ch, resp, req)
+	portforward.StartPortForward(kubeConfigStore, ch, portforward.Config{}, resp, req)
 
 	res := resp.Result()
 	defer res.Body.Close()
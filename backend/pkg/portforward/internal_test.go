@@ -2,11 +2,32 @@ package portforward
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	httpspdy "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd/api"
 )
 
 // TestPortforwardKeyGenerator tests portforwardKeyGenerator function.
@@ -76,9 +97,14 @@ func TestGetPortForwardByID(t *testing.T) {
 // TestStopOrDeletePortForward tests stopOrDeletePortForward function.
 func TestStopOrDeletePortForward(t *testing.T) {
 	cache := cache.New[interface{}]()
-	ch := make(chan struct{}, 1)
+	closeChan, done := make(chan struct{}), make(chan struct{})
 
-	p := portForward{ID: "id", Cluster: "cluster", closeChan: ch}
+	go func() {
+		<-closeChan
+		close(done)
+	}()
+
+	p := portForward{ID: "id", Cluster: "cluster", closeChan: closeChan, done: done}
 
 	err := cache.Set(context.Background(), portforwardKeyGenerator(p), p)
 	require.NoError(t, err)
@@ -86,8 +112,15 @@ func TestStopOrDeletePortForward(t *testing.T) {
 	err = stopOrDeletePortForward(cache, "cluster", "id", true)
 	assert.NoError(t, err)
 
-	chanValue := <-ch
-	assert.Equal(t, struct{}{}, chanValue)
+	select {
+	case <-done:
+	default:
+		t.Fatal("the port forward was not stopped")
+	}
+
+	// Stopping a forward which already stopped does not block.
+	err = stopOrDeletePortForward(cache, "cluster", "id", true)
+	assert.NoError(t, err)
 
 	pFromCache, err := getPortForwardByID(cache, "cluster", "id")
 	require.NoError(t, err)
@@ -127,6 +160,166 @@ func TestGetPortForwardList(t *testing.T) {
 	assert.ElementsMatch(t, []portForward{p3}, pfList)
 }
 
+// TestPortForwardCreatedAt tests that the start time is served by the list and get handlers.
+func TestPortForwardCreatedAt(t *testing.T) {
+	cache := cache.New[interface{}]()
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	portforwardstore(cache, portForward{ID: "id", Cluster: "cluster", CreatedAt: createdAt})
+
+	req := httptest.NewRequest(http.MethodGet, "/portforward/list?cluster=cluster", nil)
+	rr := httptest.NewRecorder()
+	GetPortForwards(cache, rr, req)
+
+	var list []map[string]interface{}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&list))
+	require.Len(t, list, 1)
+	assert.Equal(t, createdAt, list[0]["createdAt"])
+
+	req = httptest.NewRequest(http.MethodGet, "/portforward?cluster=cluster&id=id", nil)
+	rr = httptest.NewRecorder()
+	GetPortForwardByID(cache, rr, req)
+
+	var pf map[string]interface{}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&pf))
+	assert.Equal(t, createdAt, pf["createdAt"])
+
+	_, err := time.Parse(time.RFC3339, pf["createdAt"].(string))
+	assert.NoError(t, err)
+}
+
+// TestStartPortForwardSetupTimeout tests that a port forward to a cluster which
+// never answers fails once the setup timeout is over, without being stored.
+func TestStartPortForwardSetupTimeout(t *testing.T) {
+	// The upstream accepts connections but never answers.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var (
+		lock  sync.Mutex
+		conns []net.Conn
+	)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			lock.Lock()
+			conns = append(conns, conn)
+			lock.Unlock()
+		}
+	}()
+
+	t.Cleanup(func() {
+		listener.Close()
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+
+	kubeConfigStore := kubeconfig.NewContextStore()
+	require.NoError(t, kubeConfigStore.AddContext(&kubeconfig.Context{
+		Name:        "slow",
+		KubeContext: &api.Context{Cluster: "slow"},
+		Cluster:     &api.Cluster{Server: "http://" + listener.Addr().String()},
+	}))
+
+	cache := cache.New[interface{}]()
+	body := `{"cluster": "slow", "namespace": "default", "pod": "pod", "targetPort": "80"}`
+	req := httptest.NewRequest(http.MethodPost, "/portforward", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	start := time.Now()
+	StartPortForward(kubeConfigStore, cache, Config{SetupTimeout: 200 * time.Millisecond}, rr, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Empty(t, getPortForwardList(cache, "slow"))
+}
+
+// TestPortForwardOutlivesSetupTimeout tests that the setup timeout only bounds
+// the connection to the cluster, not the forward once it is ready.
+//
+//nolint:funlen
+func TestPortForwardOutlivesSetupTimeout(t *testing.T) {
+	// The cluster upgrades port forward requests and echoes what it gets.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := httpstream.Handshake(r, w, []string{"portforward.k8s.io"}); err != nil {
+			return
+		}
+
+		streams := make(chan httpstream.Stream, 2)
+
+		conn := httpspdy.NewResponseUpgrader().UpgradeResponse(w, r,
+			func(stream httpstream.Stream, _ <-chan struct{}) error {
+				streams <- stream
+				return nil
+			})
+		if conn == nil {
+			return
+		}
+
+		defer conn.Close()
+
+		for {
+			select {
+			case stream := <-streams:
+				if stream.Headers().Get(corev1.StreamType) == corev1.StreamTypeData {
+					go func() {
+						_, _ = io.Copy(stream, stream)
+						stream.Close()
+					}()
+				}
+			case <-conn.CloseChan():
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	kContext := &kubeconfig.Context{
+		Name:        "cluster",
+		KubeContext: &api.Context{Cluster: "cluster"},
+		Cluster:     &api.Cluster{Server: server.URL},
+	}
+
+	localPort, err := getFreePort("127.0.0.1")
+	require.NoError(t, err)
+
+	cache := cache.New[interface{}]()
+	conf := Config{Address: "127.0.0.1", SetupTimeout: 200 * time.Millisecond}
+	p := portForwardRequest{
+		ID: "id", Cluster: "cluster", Namespace: "default", Pod: "pod",
+		Port: strconv.Itoa(localPort), TargetPort: "80",
+	}
+	require.NoError(t, startPortForward(kContext, cache, conf, p, ""))
+
+	list := getPortForwardList(cache, "cluster")
+	require.Len(t, list, 1)
+	t.Cleanup(func() { list[0].closeChan <- struct{}{} })
+
+	time.Sleep(2 * conf.SetupTimeout)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", p.Port))
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(conn, reply)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(reply))
+}
+
 // Test portForwardRequest.Validate() function.
 func TestPortForwardRequestValidate(t *testing.T) {
 	req := portForwardRequest{}
@@ -153,6 +346,16 @@ func TestPortForwardRequestValidate(t *testing.T) {
 
 	err = req.Validate()
 	assert.NoError(t, err)
+
+	node := portForwardRequest{Node: "node", Cluster: "cluster"}
+
+	err = node.Validate()
+	assert.EqualError(t, err, "targetPort is required", "forwards to nodes need no pod")
+
+	node.TargetPort = "10250"
+
+	err = node.Validate()
+	assert.NoError(t, err)
 }
 
 // TestStopOrDeletePortForwardRequest.Validate() function.
@@ -172,3 +375,931 @@ func TestStopOrDeletePortForwardRequestValidate(t *testing.T) {
 	err = req.Validate()
 	assert.NoError(t, err)
 }
+
+// TestRoundTripperForKeepAlive tests that roundTripperFor configures keepalive on the dialer.
+func TestRoundTripperForKeepAlive(t *testing.T) {
+	keepAlive := 42 * time.Second
+
+	roundTripper, upgrader, err := roundTripperFor(&rest.Config{Host: "https://127.0.0.1:6443"}, keepAlive)
+	require.NoError(t, err)
+	require.NotNil(t, roundTripper)
+	require.NotNil(t, upgrader.Dialer)
+
+	assert.Equal(t, keepAlive, upgrader.Dialer.KeepAlive)
+	assert.Equal(t, dialTimeout, upgrader.Dialer.Timeout)
+}
+
+// TestConfigKeepAliveInterval tests the default keepalive interval.
+func TestConfigKeepAliveInterval(t *testing.T) {
+	assert.Equal(t, DefaultKeepAliveInterval, Config{}.keepAliveInterval())
+	assert.Equal(t, time.Minute, Config{KeepAliveInterval: time.Minute}.keepAliveInterval())
+}
+
+// TestRingBuffer tests that ringBuffer only keeps the most recent output.
+func TestRingBuffer(t *testing.T) {
+	b := newRingBuffer(8)
+
+	n, err := b.Write([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "hello", b.String())
+
+	n, err = b.Write([]byte(" world"))
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, "lo world", b.String())
+
+	_, err = b.Write([]byte("a much longer line than the cap"))
+	require.NoError(t, err)
+	assert.Equal(t, " the cap", b.String())
+	assert.Len(t, b.data, 8)
+}
+
+// TestAvailabilityCheckInterval tests that availability checks are jittered.
+func TestAvailabilityCheckInterval(t *testing.T) {
+	base := PodAvailabilityCheckTimer * time.Second
+
+	assert.Equal(t, base, Config{}.availabilityCheckInterval())
+
+	conf := Config{AvailabilityCheckJitter: 0.5}
+	intervals := map[time.Duration]bool{}
+
+	// Forwards started together should not check in lockstep.
+	for i := 0; i < 10; i++ {
+		interval := conf.availabilityCheckInterval()
+		assert.GreaterOrEqual(t, interval, base)
+		assert.LessOrEqual(t, interval, base+base/2)
+
+		intervals[interval] = true
+	}
+
+	assert.Greater(t, len(intervals), 1)
+}
+
+// TestGetFreePort tests looking up free ports on IPv4 and IPv6 addresses.
+func TestGetFreePort(t *testing.T) {
+	assert.Equal(t, DefaultAddress, Config{}.address())
+	assert.Equal(t, "::1", Config{Address: "[::1]"}.address())
+
+	port, err := getFreePort(Config{}.address())
+	require.NoError(t, err)
+	assert.NotZero(t, port)
+
+	// The port must be free on the requested IPv6 address.
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 is not available: %v", err)
+	}
+
+	l.Close()
+
+	port, err = getFreePort(Config{Address: "[::1]"}.address())
+	require.NoError(t, err)
+	assert.NotZero(t, port)
+
+	l, err = net.Listen("tcp", net.JoinHostPort("::1", strconv.Itoa(port)))
+	require.NoError(t, err)
+	l.Close()
+}
+
+// TestCheckPortForwardTarget tests the port forward pre-flight check.
+func TestCheckPortForwardTarget(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "web",
+				Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	})
+
+	assert.NoError(t, checkPortForwardTarget(clientset, "default", "web", "8080"))
+	assert.NoError(t, checkPortForwardTarget(clientset, "default", "web", "http"))
+
+	err := checkPortForwardTarget(clientset, "default", "web", "9090")
+	assert.ErrorContains(t, err, "does not expose port 9090")
+
+	err = checkPortForwardTarget(clientset, "default", "missing", "8080")
+	assert.ErrorContains(t, err, "not found")
+}
+
+// TestDirectPortForward tests that in-cluster port forwards connect to
+// reachable pods directly, and go through the API server otherwise.
+func TestDirectPortForward(t *testing.T) {
+	// The pod echoes what it gets.
+	podListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { podListener.Close() })
+
+	go func() {
+		for {
+			conn, err := podListener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	_, targetPort, err := net.SplitHostPort(podListener.Addr().String())
+	require.NoError(t, err)
+
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "127.0.0.1"},
+	})
+
+	// The user may forward to the pod unless denied.
+	var denied int32
+
+	clientset.PrependReactor("create", "selfsubjectaccessreviews",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+			attributes := review.Spec.ResourceAttributes
+			review.Status.Allowed = atomic.LoadInt32(&denied) == 0 && attributes.Verb == "create" &&
+				attributes.Resource == "pods" && attributes.Subresource == "portforward" && attributes.Name == "web"
+
+			return true, review, nil
+		})
+
+	p := portForwardRequest{ID: "id", Cluster: "cluster", Namespace: "default", Pod: "web", TargetPort: targetPort}
+	ctx := context.Background()
+
+	_, ok := directPodAddress(ctx, clientset, Config{}, p)
+	assert.False(t, ok, "not in cluster")
+
+	atomic.StoreInt32(&denied, 1)
+	_, ok = directPodAddress(ctx, clientset, Config{InCluster: true}, p)
+	assert.False(t, ok, "forward denied")
+	atomic.StoreInt32(&denied, 0)
+
+	address, ok := directPodAddress(ctx, clientset, Config{InCluster: true}, p)
+	assert.True(t, ok)
+	assert.Equal(t, podListener.Addr().String(), address)
+
+	named := p
+	named.TargetPort = "http"
+	_, ok = directPodAddress(ctx, clientset, Config{InCluster: true}, named)
+	assert.False(t, ok, "named port")
+
+	missing := p
+	missing.Pod = "missing"
+	_, ok = directPodAddress(ctx, clientset, Config{InCluster: true}, missing)
+	assert.False(t, ok, "missing pod")
+
+	closedPort, err := getFreePort("127.0.0.1")
+	require.NoError(t, err)
+
+	unreachable := p
+	unreachable.TargetPort = strconv.Itoa(closedPort)
+	_, ok = directPodAddress(ctx, clientset, Config{InCluster: true}, unreachable)
+	assert.False(t, ok, "unreachable pod")
+
+	localPort, err := getFreePort("127.0.0.1")
+	require.NoError(t, err)
+
+	p.Port = strconv.Itoa(localPort)
+	cache := cache.New[interface{}]()
+	require.NoError(t, startDirectPortForward(clientset, cache, Config{Address: "127.0.0.1"}, p, address,
+		make(chan struct{}), make(chan struct{}), nil))
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", p.Port))
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(conn, reply)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(reply))
+	conn.Close()
+
+	list := getPortForwardList(cache, "cluster")
+	require.Len(t, list, 1)
+	assert.Contains(t, list[0].output.String(), "(direct)")
+
+	list[0].closeChan <- struct{}{}
+
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", p.Port))
+		if err == nil {
+			conn.Close()
+		}
+
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// TestRestartServicePortForward tests that a forward to a service whose pod
+// was replaced is restarted to the new pod, on the same local port.
+//
+//nolint:funlen
+func TestRestartServicePortForward(t *testing.T) {
+	// The pods echo what they get.
+	podListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { podListener.Close() })
+
+	go func() {
+		for {
+			conn, err := podListener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	_, targetPort, err := net.SplitHostPort(podListener.Addr().String())
+	require.NoError(t, err)
+
+	var replaced int32
+
+	writeJSON := func(w http.ResponseWriter, obj interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(obj)
+	}
+
+	runningPod := func(name string) corev1.Pod {
+		return corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "web"}},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "127.0.0.1"},
+		}
+	}
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/default/pods/web-old" && atomic.LoadInt32(&replaced) == 0:
+			writeJSON(w, runningPod("web-old"))
+		case r.URL.Path == "/api/v1/namespaces/default/pods/web-new":
+			writeJSON(w, runningPod("web-new"))
+		case r.URL.Path == "/api/v1/namespaces/default/pods":
+			writeJSON(w, corev1.PodList{
+				TypeMeta: metav1.TypeMeta{Kind: "PodList", APIVersion: "v1"},
+				Items:    []corev1.Pod{runningPod("web-new")},
+			})
+		case r.URL.Path == "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews":
+			writeJSON(w, authorizationv1.SelfSubjectAccessReview{
+				TypeMeta: metav1.TypeMeta{Kind: "SelfSubjectAccessReview", APIVersion: "authorization.k8s.io/v1"},
+				Status:   authorizationv1.SubjectAccessReviewStatus{Allowed: true},
+			})
+		case r.URL.Path == "/api/v1/namespaces/default/services/web":
+			writeJSON(w, corev1.Service{
+				TypeMeta:   metav1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+			})
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(metav1.Status{
+				TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   metav1.StatusFailure,
+				Reason:   metav1.StatusReasonNotFound,
+				Code:     http.StatusNotFound,
+			})
+		}
+	}))
+	t.Cleanup(apiServer.Close)
+
+	kubeConfigStore := kubeconfig.NewContextStore()
+	require.NoError(t, kubeConfigStore.AddContext(&kubeconfig.Context{
+		Name:        "cluster",
+		KubeContext: &api.Context{Cluster: "cluster"},
+		Cluster:     &api.Cluster{Server: apiServer.URL},
+	}))
+
+	cache := cache.New[interface{}]()
+	conf := Config{Address: "127.0.0.1", InCluster: true, PodRestartGrace: time.Minute}
+
+	req := httptest.NewRequest(http.MethodPost, "/portforward", strings.NewReader(`{"id": "web", "cluster": "cluster",
+		"namespace": "default", "pod": "web-old", "service": "web", "targetPort": "`+targetPort+`"}`))
+	rr := httptest.NewRecorder()
+	StartPortForward(kubeConfigStore, cache, conf, rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var p portForwardRequest
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+
+	echo := func() error {
+		conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", p.Port))
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			return err
+		}
+
+		reply := make([]byte, 4)
+		_, err = io.ReadFull(conn, reply)
+
+		return err
+	}
+
+	require.NoError(t, echo())
+
+	// The pod is replaced, and the forward restarted to the new one on the
+	// next check, not on a later retry.
+	atomic.StoreInt32(&replaced, 1)
+
+	assert.Eventually(t, func() bool {
+		list := getPortForwardList(cache, "cluster")
+		return len(list) == 1 && list[0].Pod == "web-new"
+	}, (PodAvailabilityCheckTimer+3)*time.Second, 50*time.Millisecond)
+
+	list := getPortForwardList(cache, "cluster")
+	require.Len(t, list, 1)
+	assert.Equal(t, p.Port, list[0].Port)
+	assert.Empty(t, list[0].Error)
+	require.NoError(t, echo())
+
+	require.NoError(t, stopOrDeletePortForward(cache, "cluster", "web", true))
+}
+
+// TestResolvePodDNSName tests that the pod DNS name of a headless service is
+// resolved to the pod and namespace to forward to.
+func TestResolvePodDNSName(t *testing.T) {
+	statefulSetPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "db", Labels: map[string]string{"app": "db"}},
+			Spec:       corev1.PodSpec{Hostname: name, Subdomain: "db"},
+		}
+	}
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "db"},
+			Spec:       corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone, Selector: map[string]string{"app": "db"}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "db"},
+			Spec:       corev1.ServiceSpec{ClusterIP: "10.0.0.1", Selector: map[string]string{"app": "web"}},
+		},
+		statefulSetPod("db-0"),
+		statefulSetPod("db-1"),
+	)
+
+	tests := []struct {
+		name      string
+		dnsName   string
+		namespace string
+		wantPod   string
+		wantErr   string
+	}{
+		{name: "fqdn", dnsName: "db-1.db.db.svc.cluster.local", wantPod: "db-1"},
+		{name: "trailing_dot", dnsName: "db-0.db.db.svc.cluster.local.", wantPod: "db-0"},
+		{name: "short", dnsName: "db-0.db.db.svc", namespace: "db", wantPod: "db-0"},
+		{name: "malformed", dnsName: "db-0.db", wantErr: "invalid pod DNS name"},
+		{name: "other_namespace", dnsName: "db-0.db.db.svc", namespace: "web", wantErr: "is not in namespace"},
+		{name: "not_headless", dnsName: "web-0.web.db.svc", wantErr: "is not headless"},
+		{name: "unknown_service", dnsName: "db-0.cache.db.svc", wantErr: "not found"},
+		{name: "unknown_pod", dnsName: "db-2.db.db.svc", wantErr: "not found"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p := portForwardRequest{Cluster: "cluster", Namespace: tt.namespace, PodDNSName: tt.dnsName, TargetPort: "5432"}
+			require.NoError(t, p.Validate())
+
+			err := resolvePodDNSName(context.Background(), clientset, &p)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPod, p.Pod)
+			assert.Equal(t, "db", p.Namespace)
+		})
+	}
+}
+
+// TestPodRestartGrace tests that a port forward survives its pod not running
+// for less than the restart grace period, and moves to another pod of its
+// service meanwhile.
+func TestPodRestartGrace(t *testing.T) {
+	pod := func(name string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "web"}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+
+	setPhase := func(t *testing.T, clientset *fake.Clientset, name string, phase corev1.PodPhase) {
+		_, err := clientset.CoreV1().Pods("default").Update(context.Background(), pod(name, phase),
+			metav1.UpdateOptions{})
+		require.NoError(t, err)
+	}
+
+	start := time.Now()
+
+	t.Run("restart_within_grace", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(pod("web-0", corev1.PodRunning))
+		w := &podWatcher{
+			clientset: clientset,
+			pf:        &portForward{Namespace: "default", Pod: "web-0"},
+			grace:     30 * time.Second,
+		}
+
+		require.NoError(t, w.check(start))
+
+		// The pod restarts, and comes back before the grace period is over.
+		setPhase(t, clientset, "web-0", corev1.PodPending)
+		require.NoError(t, w.check(start.Add(5*time.Second)))
+		require.NoError(t, w.check(start.Add(25*time.Second)))
+
+		setPhase(t, clientset, "web-0", corev1.PodRunning)
+		require.NoError(t, w.check(start.Add(40*time.Second)))
+
+		// The grace period starts over on the next restart.
+		setPhase(t, clientset, "web-0", corev1.PodPending)
+		require.NoError(t, w.check(start.Add(50*time.Second)))
+		assert.Error(t, w.check(start.Add(80*time.Second)))
+	})
+
+	t.Run("no_grace", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(pod("web-0", corev1.PodPending))
+		w := &podWatcher{clientset: clientset, pf: &portForward{Namespace: "default", Pod: "web-0"}}
+
+		assert.Error(t, w.check(start))
+	})
+
+	t.Run("service_pod_replaced", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+			},
+			pod("web-new", corev1.PodPending),
+		)
+
+		var restartedTo []string
+
+		w := &podWatcher{
+			clientset: clientset,
+			pf:        &portForward{Namespace: "default", Pod: "web-old", Service: "web"},
+			grace:     30 * time.Second,
+			restart: func(pod string) error {
+				restartedTo = append(restartedTo, pod)
+				return nil
+			},
+		}
+
+		// The old pod is gone and the new one is not running yet.
+		require.NoError(t, w.check(start))
+		assert.Empty(t, restartedTo)
+
+		setPhase(t, clientset, "web-new", corev1.PodRunning)
+		assert.ErrorIs(t, w.check(start.Add(5*time.Second)), errForwardRestarted)
+		assert.Equal(t, []string{"web-new"}, restartedTo)
+	})
+}
+
+// TestTerminatingPodForward tests that port forwards to a pod being deleted,
+// or in a namespace being deleted, are stopped with a terminating error.
+func TestTerminatingPodForward(t *testing.T) {
+	deletedAt := metav1.Now()
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+	runningPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	terminatingPod := runningPod.DeepCopy()
+	terminatingPod.DeletionTimestamp = &deletedAt
+
+	terminatingNamespace := namespace.DeepCopy()
+	terminatingNamespace.Status.Phase = corev1.NamespaceTerminating
+
+	t.Run("terminating_pod", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(namespace, terminatingPod)
+		w := &podWatcher{clientset: clientset, pf: &portForward{Namespace: "default", Pod: "web-0"}}
+
+		err := w.check(time.Now())
+		assert.ErrorIs(t, err, errPodTerminating)
+		assert.EqualError(t, err, "pod is terminating: default/web-0")
+	})
+
+	t.Run("terminating_pod_within_grace", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(namespace, terminatingPod)
+		// The pod won't come back, so the grace period does not apply.
+		w := &podWatcher{
+			clientset: clientset,
+			pf:        &portForward{Namespace: "default", Pod: "web-0"},
+			grace:     time.Minute,
+		}
+
+		assert.ErrorIs(t, w.check(time.Now()), errPodTerminating)
+	})
+
+	t.Run("terminating_service_pod", func(t *testing.T) {
+		oldPod := terminatingPod.DeepCopy()
+		oldPod.Labels = map[string]string{"app": "web"}
+
+		newPod := runningPod.DeepCopy()
+		newPod.Name = "web-1"
+		newPod.Labels = map[string]string{"app": "web"}
+
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+		}
+
+		var restartedTo []string
+
+		w := &podWatcher{
+			clientset: fake.NewSimpleClientset(namespace, service, oldPod, newPod),
+			pf:        &portForward{Namespace: "default", Pod: "web-0", Service: "web"},
+			grace:     time.Minute,
+			restart: func(pod string) error {
+				restartedTo = append(restartedTo, pod)
+				return nil
+			},
+		}
+
+		// Forwards to services move to another pod right away.
+		assert.ErrorIs(t, w.check(time.Now()), errForwardRestarted)
+		assert.Equal(t, []string{"web-1"}, restartedTo)
+	})
+
+	t.Run("terminating_namespace", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(terminatingNamespace, terminatingPod)
+		// The namespace won't come back, so the grace period does not apply.
+		w := &podWatcher{
+			clientset: clientset,
+			pf:        &portForward{Namespace: "default", Pod: "web-0"},
+			grace:     time.Minute,
+		}
+
+		err := w.check(time.Now())
+		assert.ErrorIs(t, err, errNamespaceTerminating)
+		assert.EqualError(t, err, "namespace is terminating: default")
+	})
+
+	t.Run("running", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(namespace, runningPod)
+		w := &podWatcher{clientset: clientset, pf: &portForward{Namespace: "default", Pod: "web-0"}}
+
+		assert.NoError(t, w.check(time.Now()))
+
+		// The namespace is only checked once the pod is not running.
+		for _, action := range clientset.Actions() {
+			assert.Equal(t, "pods", action.GetResource().Resource)
+		}
+	})
+
+	t.Run("forward_stopped", func(t *testing.T) {
+		cache := cache.New[interface{}]()
+		closeChan, done := make(chan struct{}), make(chan struct{})
+		pf := portForward{ID: "id", Cluster: "cluster", Namespace: "default", Pod: "web-0",
+			closeChan: closeChan, done: done}
+
+		go func() {
+			<-closeChan
+			close(done)
+		}()
+
+		portforwardstore(cache, pf)
+		checkPodPeriodically(fake.NewSimpleClientset(namespace, terminatingPod), cache, Config{}, &pf, nil)
+
+		select {
+		case <-done:
+		case <-time.After(2 * PodAvailabilityCheckTimer * time.Second):
+			t.Fatal("the port forward to the terminating pod was not stopped")
+		}
+
+		require.Eventually(t, func() bool {
+			stored, err := getPortForwardByID(cache, "cluster", "id")
+			return err == nil && stored.Error == "pod is terminating: default/web-0"
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("forward_already_stopped", func(t *testing.T) {
+		cache := cache.New[interface{}]()
+		done := make(chan struct{})
+		close(done)
+
+		// Nothing receives from the close channel of a forward which stopped.
+		pf := portForward{ID: "id", Cluster: "cluster", Namespace: "default", Pod: "web-0",
+			closeChan: make(chan struct{}), done: done}
+
+		portforwardstore(cache, pf)
+		checkPodPeriodically(fake.NewSimpleClientset(namespace, terminatingPod), cache, Config{}, &pf, nil)
+
+		require.Eventually(t, func() bool {
+			stored, err := getPortForwardByID(cache, "cluster", "id")
+			return err == nil && stored.Error == "pod is terminating: default/web-0"
+		}, 2*PodAvailabilityCheckTimer*time.Second, 10*time.Millisecond)
+	})
+}
+
+// TestGetPortForwardStatus tests that the status of a port forward reports
+// whether its local port is listening, while running and once stopped.
+func TestGetPortForwardStatus(t *testing.T) {
+	podListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { podListener.Close() })
+
+	_, targetPort, err := net.SplitHostPort(podListener.Addr().String())
+	require.NoError(t, err)
+
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "127.0.0.1"},
+	})
+
+	localPort, err := getFreePort("127.0.0.1")
+	require.NoError(t, err)
+
+	conf := Config{Address: "127.0.0.1"}
+	p := portForwardRequest{
+		ID: "id", Cluster: "cluster", Namespace: "default", Pod: "web",
+		TargetPort: targetPort, Port: strconv.Itoa(localPort),
+	}
+	cache := cache.New[interface{}]()
+	require.NoError(t, startDirectPortForward(clientset, cache, conf, p, podListener.Addr().String(),
+		make(chan struct{}), make(chan struct{}), nil))
+
+	getStatus := func() map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/portforward/status?cluster=cluster&id=id", nil)
+		rr := httptest.NewRecorder()
+		GetPortForwardStatus(cache, conf, rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var status map[string]interface{}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&status))
+
+		return status
+	}
+
+	status := getStatus()
+	assert.Equal(t, true, status["listening"])
+	assert.Equal(t, RUNNING, status["status"])
+	assert.Equal(t, p.Port, status["port"])
+
+	require.NoError(t, stopOrDeletePortForward(cache, "cluster", "id", true))
+
+	assert.Eventually(t, func() bool {
+		return getStatus()["listening"] == false
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, STOPPED, getStatus()["status"])
+
+	req := httptest.NewRequest(http.MethodGet, "/portforward/status?cluster=cluster&id=missing", nil)
+	rr := httptest.NewRecorder()
+	GetPortForwardStatus(cache, conf, rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// TestSetupQueue tests that at most the queue size of port forwards are set
+// up at once, and that the others fail once they waited too long.
+func TestSetupQueue(t *testing.T) {
+	queue := NewSetupQueue(2, 5*time.Second)
+
+	var (
+		lock          sync.Mutex
+		active, most  int
+		wg            sync.WaitGroup
+		acquireErrors = make(chan error, 10)
+	)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := queue.acquire(context.Background()); err != nil {
+				acquireErrors <- err
+				return
+			}
+
+			defer queue.release()
+
+			lock.Lock()
+			active++
+			if active > most {
+				most = active
+			}
+			lock.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			lock.Lock()
+			active--
+			lock.Unlock()
+		}()
+	}
+
+	wg.Wait()
+	close(acquireErrors)
+
+	assert.Empty(t, acquireErrors)
+	assert.Equal(t, 2, most)
+
+	// Requests waiting longer than the timeout fail with 503.
+	full := NewSetupQueue(1, 50*time.Millisecond)
+	require.NoError(t, full.acquire(context.Background()))
+
+	assert.ErrorIs(t, full.acquire(context.Background()), errSetupQueueTimeout)
+
+	// Without a timeout, a free slot is always taken and a full queue fails right away.
+	noWait := NewSetupQueue(1, 0)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, noWait.acquire(context.Background()))
+		noWait.release()
+	}
+
+	require.NoError(t, noWait.acquire(context.Background()))
+	assert.ErrorIs(t, noWait.acquire(context.Background()), errSetupQueueTimeout)
+
+	kubeConfigStore := kubeconfig.NewContextStore()
+	require.NoError(t, kubeConfigStore.AddContext(&kubeconfig.Context{
+		Name:        "busy",
+		KubeContext: &api.Context{Cluster: "busy"},
+		Cluster:     &api.Cluster{Server: "https://busy.invalid"},
+	}))
+
+	body := `{"cluster": "busy", "namespace": "default", "pod": "pod", "targetPort": "80"}`
+	req := httptest.NewRequest(http.MethodPost, "/portforward", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	StartPortForward(kubeConfigStore, cache.New[interface{}](), Config{SetupQueue: full}, rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	// A nil queue doesn't cap anything.
+	var unlimited *SetupQueue
+	require.NoError(t, unlimited.acquire(context.Background()))
+	unlimited.release()
+}
+
+// TestGetPortForwardSummary tests that port forwards are counted by status,
+// per cluster and in total.
+func TestGetPortForwardSummary(t *testing.T) {
+	cache := cache.New[interface{}]()
+	portforwardstore(cache, portForward{ID: "1", Cluster: "first", Status: RUNNING})
+	portforwardstore(cache, portForward{ID: "2", Cluster: "first", Status: RUNNING})
+	portforwardstore(cache, portForward{ID: "3", Cluster: "first", Status: STOPPED})
+	portforwardstore(cache, portForward{ID: "4", Cluster: "second", Status: RUNNING, Error: "lost connection"})
+	portforwardstore(cache, portForward{ID: "5", Cluster: "second", Status: STOPPED})
+
+	req := httptest.NewRequest(http.MethodGet, "/portforward/summary", nil)
+	rr := httptest.NewRecorder()
+	GetPortForwardSummary(cache, rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{
+		"clusters": {
+			"first": {"running": 2, "stopped": 1, "errored": 0, "total": 3},
+			"second": {"running": 0, "stopped": 1, "errored": 1, "total": 2}
+		},
+		"total": {"running": 2, "stopped": 2, "errored": 1, "total": 5}
+	}`, rr.Body.String())
+}
+
+// newNodeProxyCluster returns a store with the context "cluster", whose fake
+// API server has the node "node-1" and proxies to its port 10250.
+func newNodeProxyCluster(t *testing.T) kubeconfig.ContextStore {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/nodes/node-1":
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(corev1.Node{
+				TypeMeta:   metav1.TypeMeta{Kind: "Node", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			})
+		case strings.HasPrefix(r.URL.Path, "/api/v1/nodes/node-1:10250/proxy/"):
+			assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte("kubelet " + strings.TrimPrefix(r.URL.Path, "/api/v1/nodes/node-1:10250/proxy")))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(metav1.Status{
+				TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   metav1.StatusFailure,
+				Reason:   metav1.StatusReasonNotFound,
+				Code:     http.StatusNotFound,
+			})
+		}
+	}))
+	t.Cleanup(apiServer.Close)
+
+	kubeConfigStore := kubeconfig.NewContextStore()
+	require.NoError(t, kubeConfigStore.AddContext(&kubeconfig.Context{
+		Name:        "cluster",
+		KubeContext: &api.Context{Cluster: "cluster"},
+		Cluster:     &api.Cluster{Server: apiServer.URL},
+	}))
+
+	return kubeConfigStore
+}
+
+// TestNodePortForward tests that forwards to nodes go through the node proxy
+// of the API server.
+func TestNodePortForward(t *testing.T) {
+	kubeConfigStore := newNodeProxyCluster(t)
+	cache := cache.New[interface{}]()
+	conf := Config{Address: "127.0.0.1"}
+
+	startForward := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/portforward", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token")
+
+		rr := httptest.NewRecorder()
+		StartPortForward(kubeConfigStore, cache, conf, rr, req)
+
+		return rr
+	}
+
+	rr := startForward(`{"id": "missing", "cluster": "cluster", "node": "missing", "targetPort": "10250"}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = startForward(`{"id": "kubelet", "cluster": "cluster", "node": "node-1", "targetPort": "10250"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var p portForwardRequest
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+
+	resp, err := http.Get("http://" + net.JoinHostPort("127.0.0.1", p.Port) + "/healthz") //nolint:noctx
+	require.NoError(t, err)
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "kubelet /healthz", string(body))
+
+	list := getPortForwardList(cache, "cluster")
+	require.Len(t, list, 1)
+	assert.Equal(t, "node-1", list[0].Node)
+	assert.Equal(t, RUNNING, list[0].Status)
+
+	require.NoError(t, stopOrDeletePortForward(cache, "cluster", "kubelet", true))
+
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", p.Port))
+		if err == nil {
+			conn.Close()
+		}
+
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// TestPortForwardLabel tests that the label and node of a port forward are
+// returned by the list of port forwards and by its id.
+func TestPortForwardLabel(t *testing.T) {
+	kubeConfigStore := newNodeProxyCluster(t)
+	cache := cache.New[interface{}]()
+
+	body := `{"id": "labeled", "cluster": "cluster", "node": "node-1", "targetPort": "10250",
+		"label": "debugging the payment service"}`
+	req := httptest.NewRequest(http.MethodPost, "/portforward", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+
+	rr := httptest.NewRecorder()
+	StartPortForward(kubeConfigStore, cache, Config{Address: "127.0.0.1"}, rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	t.Cleanup(func() { _ = stopOrDeletePortForward(cache, "cluster", "labeled", true) })
+
+	rr = httptest.NewRecorder()
+	GetPortForwards(cache, rr, httptest.NewRequest(http.MethodGet, "/portforward/list?cluster=cluster", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var list []map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, "debugging the payment service", list[0]["label"])
+
+	rr = httptest.NewRecorder()
+	GetPortForwardByID(cache, rr, httptest.NewRequest(http.MethodGet, "/portforward?cluster=cluster&id=labeled", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var pf map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &pf))
+	assert.Equal(t, list[0], pf)
+	assert.Equal(t, "debugging the payment service", pf["label"])
+	assert.Equal(t, "node-1", pf["node"])
+
+	tooLong := portForwardRequest{Node: "node-1", Cluster: "cluster", TargetPort: "10250",
+		Label: strings.Repeat("a", maxLabelLength+1)}
+	assert.EqualError(t, tooLong.Validate(), "label is longer than 256 bytes")
+}
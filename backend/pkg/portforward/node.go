@@ -0,0 +1,121 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/cache"
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// errNodeNotFound is returned when the node of a node port forward does not exist.
+var errNodeNotFound = errors.New("node not found")
+
+// nodeProxyURL returns the URL of the API server node proxy to the port of
+// the node, eg. "https://cluster/api/v1/nodes/node-1:10250/proxy".
+func nodeProxyURL(host, node, port string) (*url.URL, error) {
+	proxyURL, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+
+	// The host may have a path, eg. for clusters behind a proxy.
+	proxyURL.Path = strings.TrimSuffix(proxyURL.Path, "/") + "/api/v1/nodes/" + node + ":" + port + "/proxy"
+
+	return proxyURL, nil
+}
+
+// startNodePortForward forwards the local port to the port of a node, eg. the
+// kubelet, through the node proxy of the API server. The node proxy carries
+// HTTP only, so the local port serves HTTP too, until stopChan gets a value.
+func startNodePortForward(kContext *kubeconfig.Context, cache cache.Cache[interface{}], conf Config,
+	p portForwardRequest, token string,
+) error {
+	ctx, cancel := context.WithTimeout(context.Background(), conf.setupTimeout())
+	defer cancel()
+
+	clientset, err := kContext.ClientSetWithToken(token)
+	if err != nil {
+		return fmt.Errorf("failed to create portforward request: %v", err)
+	}
+
+	_, err = clientset.CoreV1().Nodes().Get(ctx, p.Node, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%w: %s", errNodeNotFound, p.Node)
+	}
+
+	if err != nil {
+		return fmt.Errorf("portforward request: failed to get node: %v", err)
+	}
+
+	rConf, err := kContext.RESTConfig()
+	if err != nil {
+		return fmt.Errorf("failed to create portforward request: %v", err)
+	}
+
+	// Without a client token, the context's credentials are used.
+	if token != "" {
+		rConf.BearerToken = token
+	}
+
+	transport, err := rest.TransportFor(rConf)
+	if err != nil {
+		return fmt.Errorf("failed to create portforward request: %v", err)
+	}
+
+	target, err := nodeProxyURL(rConf.Host, p.Node, p.TargetPort)
+	if err != nil {
+		return fmt.Errorf("portforward request: failed to parse url: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(conf.address(), p.Port))
+	if err != nil {
+		return fmt.Errorf("portforward request: failed to listen: %v", err)
+	}
+
+	out, errOut := newRingBuffer(conf.outputBufferSize()), newRingBuffer(conf.outputBufferSize())
+
+	fmt.Fprintf(out, "Forwarding from %s -> %s\n", listener.Addr(), target)
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = transport
+
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = target.Host
+	}
+
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		fmt.Fprintf(errOut, "error forwarding %s: %s\n", r.URL.Path, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	server := &http.Server{Handler: proxy, ReadHeaderTimeout: dialTimeout}
+
+	stopChan := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		<-stopChan
+		server.Close()
+		close(done)
+	}()
+
+	go func() {
+		_ = server.Serve(listener) // Returns once the forward is stopped.
+	}()
+
+	portforwardstore(cache, newPortForward(p, stopChan, done, out, errOut))
+
+	return nil
+}
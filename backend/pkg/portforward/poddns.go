@@ -0,0 +1,111 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/headlamp-k8s/headlamp/backend/pkg/kubeconfig"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// errPodNotFound is returned when no pod of the cluster has a pod DNS name.
+var errPodNotFound = errors.New("pod not found")
+
+// parsePodDNSName splits the DNS name of a pod of a headless service,
+// "<hostname>.<service>.<namespace>.svc[.<cluster domain>]".
+func parsePodDNSName(name string) (hostname, service, namespace string, err error) {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	if len(labels) < 4 || labels[3] != "svc" {
+		return "", "", "", fmt.Errorf("invalid pod DNS name %q, expected <hostname>.<service>.<namespace>.svc", name)
+	}
+
+	for _, label := range labels[:3] {
+		if label == "" {
+			return "", "", "", fmt.Errorf("invalid pod DNS name %q", name)
+		}
+	}
+
+	return labels[0], labels[1], labels[2], nil
+}
+
+// resolvePodDNSName sets the pod and namespace of the request to those of the
+// pod its DNS name points to. The name is looked up in the cluster of the
+// clientset, so it fails for pods of other clusters.
+func resolvePodDNSName(ctx context.Context, clientset kubernetes.Interface, p *portForwardRequest) error {
+	hostname, serviceName, namespace, err := parsePodDNSName(p.PodDNSName)
+	if err != nil {
+		return err
+	}
+
+	if p.Namespace != "" && p.Namespace != namespace {
+		return fmt.Errorf("pod DNS name %q is not in namespace %q", p.PodDNSName, p.Namespace)
+	}
+
+	service, err := clientset.CoreV1().Services(namespace).Get(ctx, serviceName, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%w: service %s/%s not found", errPodNotFound, namespace, serviceName)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if service.Spec.ClusterIP != corev1.ClusterIPNone {
+		return fmt.Errorf("service %s/%s is not headless", namespace, serviceName)
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(service.Spec.Selector).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods.Items {
+		podHostname := pod.Spec.Hostname
+		if podHostname == "" {
+			podHostname = pod.Name
+		}
+
+		if podHostname == hostname && pod.Spec.Subdomain == serviceName {
+			p.Pod = pod.Name
+			p.Namespace = namespace
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no pod of service %s/%s has hostname %q", errPodNotFound, namespace, serviceName, hostname)
+}
+
+// resolvePodDNSNameInCluster resolves the pod DNS name of the request in the
+// cluster of kContext. On error, it returns the HTTP status to answer with.
+func resolvePodDNSNameInCluster(kContext *kubeconfig.Context, conf Config, p *portForwardRequest,
+	token string,
+) (int, error) {
+	clientset, err := kContext.ClientSetWithToken(token)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to create clientset: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), conf.setupTimeout())
+	defer cancel()
+
+	err = resolvePodDNSName(ctx, clientset, p)
+	if errors.Is(err, errPodNotFound) {
+		return http.StatusNotFound, err
+	}
+
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	return http.StatusOK, nil
+}
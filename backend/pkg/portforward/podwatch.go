@@ -0,0 +1,154 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"syscall"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// errForwardRestarted is returned by podWatcher.check once the port forward
+// was restarted to another pod of its service, which has its own watcher.
+var errForwardRestarted = errors.New("port forward restarted to another pod")
+
+var (
+	// errNamespaceTerminating is returned when the namespace of a port forward
+	// is being deleted, so its pods won't come back.
+	errNamespaceTerminating = errors.New("namespace is terminating")
+	// errPodTerminating is returned when the pod of a port forward is being deleted.
+	errPodTerminating = errors.New("pod is terminating")
+)
+
+// podWatcher checks that the pod of a port forward is running. The pod may not
+// run for up to the grace period, eg. while it is rescheduled during a rolling
+// update, before the forward is stopped.
+type podWatcher struct {
+	clientset kubernetes.Interface
+	pf        *portForward
+	grace     time.Duration
+	// restart restarts the port forward to another pod. It is used for forwards
+	// to services, whose pods may be replaced by pods with other names.
+	restart func(pod string) error
+	// notRunningSince is when the pod was first seen not running, or zero if
+	// it is running.
+	notRunningSince time.Time
+}
+
+// check checks the pod once, at now. It returns an error once the port forward
+// must be stopped, or errForwardRestarted if it was moved to another pod.
+func (w *podWatcher) check(now time.Time) error {
+	err := checkIfPodIsRunning(w.clientset, w.pf.Namespace, w.pf.Pod)
+	if err == nil {
+		w.notRunningSince = time.Time{}
+		return nil
+	}
+
+	// The cluster is not reachable, which says nothing about the pod.
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return nil
+	}
+
+	// The pods of a terminating namespace won't come back, nor can the forward
+	// move to other pods, so it is stopped right away instead of lingering.
+	if err := checkNamespaceNotTerminating(w.clientset, w.pf.Namespace); err != nil {
+		return err
+	}
+
+	// A pod being deleted won't come back, so the grace period does not apply,
+	// but forwards to services can still move to another of their pods.
+	if errors.Is(err, errPodTerminating) {
+		if w.restartToServicePod() {
+			return errForwardRestarted
+		}
+
+		return err
+	}
+
+	if w.notRunningSince.IsZero() {
+		w.notRunningSince = now
+	}
+
+	if now.Sub(w.notRunningSince) >= w.grace {
+		return err
+	}
+
+	if w.restartToServicePod() {
+		return errForwardRestarted
+	}
+
+	return nil
+}
+
+// restartToServicePod restarts a forward to a service to another of its running
+// pods, if there is one. It returns whether the forward was restarted.
+func (w *podWatcher) restartToServicePod() bool {
+	if w.pf.Service == "" || w.restart == nil {
+		return false
+	}
+
+	pod, ok := runningServicePod(w.clientset, w.pf)
+	if !ok || pod == w.pf.Pod {
+		return false
+	}
+
+	if err := w.restart(pod); err != nil {
+		log.Printf("portforward: failed to restart the forward to pod %s: %s", pod, err)
+		return false
+	}
+
+	return true
+}
+
+// checkNamespaceNotTerminating returns errNamespaceTerminating if the namespace
+// is being deleted. Failing to get the namespace, eg. without the permission to,
+// is not an error: the pod check covers it.
+func checkNamespaceNotTerminating(clientset kubernetes.Interface, namespace string) error {
+	ns, err := clientset.CoreV1().Namespaces().Get(context.Background(), namespace, v1.GetOptions{})
+	if err != nil {
+		return nil //nolint:nilerr
+	}
+
+	if ns.Status.Phase == corev1.NamespaceTerminating || ns.DeletionTimestamp != nil {
+		return fmt.Errorf("%w: %s", errNamespaceTerminating, namespace)
+	}
+
+	return nil
+}
+
+// runningServicePod returns the name of a running pod of the service of the
+// port forward.
+func runningServicePod(clientset kubernetes.Interface, pf *portForward) (string, bool) {
+	namespace := pf.ServiceNamespace
+	if namespace == "" {
+		namespace = pf.Namespace
+	}
+
+	ctx := context.Background()
+
+	service, err := clientset.CoreV1().Services(namespace).Get(ctx, pf.Service, v1.GetOptions{})
+	if err != nil || len(service.Spec.Selector) == 0 {
+		return "", false
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(service.Spec.Selector).String(),
+	})
+	if err != nil {
+		return "", false
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			return pod.Name, true
+		}
+	}
+
+	return "", false
+}
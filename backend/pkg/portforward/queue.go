@@ -0,0 +1,69 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errSetupQueueTimeout is returned when a port forward waited for a setup slot
+// for longer than the queue timeout.
+var errSetupQueueTimeout = errors.New("too many port forwards being started, try again later")
+
+// SetupQueue caps the number of port forwards being set up at once, so a burst
+// of them doesn't hit the API server all together. The others wait for a slot,
+// up to a timeout.
+type SetupQueue struct {
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// NewSetupQueue returns a queue letting size port forwards be set up at once,
+// the others waiting up to timeout for their turn.
+func NewSetupQueue(size int, timeout time.Duration) *SetupQueue {
+	return &SetupQueue{
+		slots:   make(chan struct{}, size),
+		timeout: timeout,
+	}
+}
+
+// acquire waits for a setup slot. It returns errSetupQueueTimeout if none is
+// free within the timeout, or right away if the timeout is 0. A nil queue has
+// unlimited slots.
+func (q *SetupQueue) acquire(ctx context.Context) error {
+	if q == nil {
+		return nil
+	}
+
+	// A free slot is taken first, which an expired timer would race with.
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if q.timeout <= 0 {
+		return errSetupQueueTimeout
+	}
+
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return errSetupQueueTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken with acquire.
+func (q *SetupQueue) release() {
+	if q == nil {
+		return
+	}
+
+	<-q.slots
+}
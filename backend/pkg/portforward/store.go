@@ -50,8 +50,8 @@ func stopOrDeletePortForward(cache cache.Cache[interface{}], cluster string, id
 	}
 
 	if isStopRequest {
-		// close the channel to stop the portforward
-		portforward.closeChan <- struct{}{}
+		// A forward which already stopped is not waited for.
+		stopAndWait(portforward.closeChan, portforward.done)
 		portforward.Status = STOPPED
 		portforwardstore(cache, portforward)
 	} else {